@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+const (
+	actionDelete  = "delete"
+	actionPin     = "pin"
+	actionPromote = "promote:"
+)
+
+func validateReactionAction(action string) error {
+	switch {
+	case action == actionDelete, action == actionPin:
+		return nil
+	case strings.HasPrefix(action, actionPromote):
+		_, err := ParseChannel(strings.TrimPrefix(action, actionPromote))
+		return err
+	}
+	return fmt.Errorf("Unknown action %q", action)
+}
+
+// runReactionAction runs action on the bridged message ts in channel,
+// which may be the source message or one of its mirrors.
+func runReactionAction(ctx context.Context, action string, channel Channel, ts string) error {
+	source, sourceTs, ok := mirrors.Source(channel, ts)
+	if !ok {
+		source, sourceTs = channel, ts
+	}
+
+	switch {
+	case action == actionDelete:
+		return eachMirror(source, sourceTs, func(dest Channel, destTs string) error {
+			return dest.DeleteMessage(ctx, destTs)
+		})
+	case action == actionPin:
+		return eachMirror(source, sourceTs, func(dest Channel, destTs string) error {
+			return dest.Pin(ctx, destTs)
+		})
+	case strings.HasPrefix(action, actionPromote):
+		target, err := ParseChannel(strings.TrimPrefix(action, actionPromote))
+		if err != nil {
+			return err
+		}
+		return source.Promote(ctx, sourceTs, target.Group())
+	}
+	return fmt.Errorf("Unknown action %q", action)
+}
+
+// eachMirror calls f with every recorded mirror of source message ts,
+// returning the first error.
+func eachMirror(source Channel, ts string, f func(Channel, string) error) error {
+	var first error
+	for dest, destTs := range mirrors.Destinations(source, ts) {
+		if err := f(dest, destTs); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// DeleteMessage deletes message ts, posted by the bridge, from the channel.
+func (c Channel) DeleteMessage(ctx context.Context, ts string) error {
+	target, err := c.Target(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Deleting %v from %v", ts, c)
+	return c.Poster().apiCall(ctx, "chat.delete", url.Values{"channel": {target}, "ts": {ts}}, nil)
+}
+
+// Pin pins message ts in the channel.
+func (c Channel) Pin(ctx context.Context, ts string) error {
+	target, err := c.Target(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Poster().apiCall(ctx, "pins.add", url.Values{"channel": {target}, "timestamp": {ts}}, nil)
+}
+
+// FetchMessage reads message ts from the channel with
+// conversations.history.
+func (c Channel) FetchMessage(ctx context.Context, ts string) (slackMessage, error) {
+	var response struct {
+		Messages []messageEvent `json:"messages"`
+	}
+	values := url.Values{"channel": {c.ChannelId}, "latest": {ts}, "inclusive": {"true"}, "limit": {"1"}}
+	if err := c.GetTeam().apiCall(ctx, "conversations.history", values, &response); err != nil {
+		return slackMessage{}, err
+	}
+	if len(response.Messages) == 0 || response.Messages[0].Timestamp != ts {
+		return slackMessage{}, fmt.Errorf("Message %v not found in %v", ts, c)
+	}
+	return response.Messages[0].message(c), nil
+}
+
+var errNoPromoteGroup = errors.New("promote target is not in a group")
+
+// Promote forwards source message ts, transformed by its own group, to
+// every channel of group outside the message's group.
+func (c Channel) Promote(ctx context.Context, ts string, group *Group) error {
+	if group == nil {
+		return errNoPromoteGroup
+	}
+	msg, err := c.FetchMessage(ctx, ts)
+	if err != nil {
+		return err
+	}
+	if msg.BotId == "" {
+		msg.FetchUserIcon()
+	}
+	msg.Transform(ctx)
+
+	var first error
+	for _, dest := range group.Channels {
+		if dest.Group() == c.Group() || !dest.Permitted() {
+			continue
+		}
+		if err := dest.Deliver(ctx, msg); err != nil && err != errBatched && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReactionActions(t *testing.T) {
+	source := Channel{teamA, chanA}
+	dest := Channel{teamB, chanB}
+	tests := []struct {
+		name       string
+		users      string
+		reaction   string
+		channel    Channel
+		ts         string
+		wantMethod string
+		wantCalls  int
+	}{
+		{"delete from mirror", `["U0000000B"]`, "no_entry_sign", dest, "9.000", "chat.delete", 1},
+		{"delete from source", `["U0000000B"]`, "no_entry_sign", source, "1.000", "chat.delete", 1},
+		{"pin", `["U0000000B"]`, "pushpin", dest, "9.000", "pins.add", 1},
+		{"promote", `["U0000000B"]`, "white_check_mark", dest, "9.000", "webhook", 2},
+		{"unauthorized user", `["U0000000C"]`, "no_entry_sign", dest, "9.000", "chat.delete", 0},
+		{"no action", `["U0000000B"]`, "eyes", dest, "9.000", "chat.delete", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.history", func(fakeCall) string {
+				return `{"ok":true,"messages":[{"type":"message","user":"U0000000A","text":"ship it","ts":"1.000"}]}`
+			})
+			options := `{"reaction_actions": {"no_entry_sign": "delete", "pushpin": "pin", "white_check_mark": "promote:` +
+				teamA + "/" + chanC + `"}, "reaction_action_users": ` + test.users + `}`
+			useConfig(t, testConfig("", `"groups": [
+				{"channels": ["`+teamA+"/"+chanA+`", "`+teamB+"/"+chanB+`"], "options": `+options+`},
+				{"channels": ["`+teamA+"/"+chanC+`", "`+teamB+"/"+chanC+`"]}
+			]`))
+			mirrors.Record(source, "1.000", dest, "9.000")
+
+			handleReaction(reactionEnvelope(test.channel, test.ts, test.reaction))
+
+			calls := slack.Calls(test.wantMethod)
+			if len(calls) != test.wantCalls {
+				t.Fatalf("Made %d %v calls, want %d", len(calls), test.wantMethod, test.wantCalls)
+			}
+			switch test.wantMethod {
+			case "chat.delete", "pins.add":
+				if test.wantCalls > 0 && (calls[0].Get("channel") != chanB || calls[0].Get("ts")+calls[0].Get("timestamp") != "9.000") {
+					t.Errorf("Ran %v on %v", test.wantMethod, calls[0].Form)
+				}
+			case "webhook":
+				for _, call := range calls {
+					if call.Get("text") != "ship it" || call.Get("channel") != chanC {
+						t.Errorf("Promoted %q to %v, want %q in %v", call.Get("text"), call.Get("channel"), "ship it", chanC)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateReactionAction(t *testing.T) {
+	tests := []struct {
+		action  string
+		wantErr bool
+	}{
+		{"delete", false},
+		{"pin", false},
+		{"promote:" + teamA + "/" + chanC, false},
+		{"promote:" + chanC, true},
+		{"archive", true},
+	}
+	for _, test := range tests {
+		if err := validateReactionAction(test.action); (err != nil) != test.wantErr {
+			t.Errorf("validateReactionAction(%q) = %v, want error %v", test.action, err, test.wantErr)
+		}
+	}
+}
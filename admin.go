@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nlopes/slack"
+)
+
+// requireAdmin rejects requests to the admin endpoints that don't carry
+// one of the admin tokens as a bearer token.
+func requireAdmin(c *gin.Context) {
+	token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	if !config().settings.AdminTokens.Accepts(token) {
+		log.Printf("Rejecting unauthenticated request to %v", c.Request.URL.Path)
+		c.AbortWithStatus(403)
+	}
+}
+
+type previewRequest struct {
+	// Channel is the TID/CID of a source channel, identifying its group.
+	Channel     string             `json:"channel"`
+	Username    string             `json:"user_name"`
+	UserId      string             `json:"user_id"`
+	Text        string             `json:"text"`
+	Attachments []slack.Attachment `json:"attachments"`
+}
+
+type destinationPreview struct {
+	Channel string          `json:"channel"`
+	Text    string          `json:"text"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// previewHandler runs a sample message through its group's pipeline and
+// returns what would be posted to each destination, without calling
+// Slack or the translator: mentions and user groups without a name are
+// left unresolved, no permalink is fetched and only cached translations
+// are used.
+func previewHandler(c *gin.Context) {
+	var request previewRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	channel, err := ParseChannel(request.Channel)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg := slackMessage{
+		Channel:     channel,
+		Username:    request.Username,
+		UserId:      request.UserId,
+		Text:        request.Text,
+		Attachments: request.Attachments,
+		Preview:     true,
+	}
+	if msg.Group() == nil {
+		c.JSON(404, gin.H{"error": channel.String() + " is not in a group"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	msg.Transform(ctx)
+
+	previews := []destinationPreview{}
+	msg.Forward(func(dest Channel) {
+		out := msg
+		dest.prepare(ctx, &out)
+		out.Channel = dest
+
+		var payload bytes.Buffer
+		payload.ReadFrom(out.payload())
+		previews = append(previews, destinationPreview{dest.String(), out.Text, payload.Bytes()})
+	})
+
+	c.JSON(200, gin.H{"text": msg.Text, "destinations": previews})
+}
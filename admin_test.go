@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		name         string
+		destination  string
+		channel      string
+		text         string
+		username     string
+		wantStatus   int
+		wantText     string
+		wantUsername string
+	}{
+		{"unchanged", `{}`, teamA + "/" + chanA, "hello", "alice", 200, "hello", "alice"},
+		{"unmapped", `{}`, teamA + "/" + chanC, "hello", "alice", 404, "", ""},
+		{"untranslated", `{"language": "de"}`, teamA + "/" + chanA, "hello", "alice", 200, "hello", "alice"},
+		{"cached translation", `{"language": "de"}`, teamA + "/" + chanA, "cached", "alice", 200, "CACHED", "alice"},
+		{"broadcast downgraded", `{"broadcast_member_limit": 10}`, teamA + "/" + chanA, "<!here> hi", "alice", 200, "@⁠here hi", "alice"},
+		{"username sanitized", `{"disallowed_username_chars": "!", "max_username_length": 5}`, teamA + "/" + chanA, "hello", "a!lice\nsmith", 200, "hello", "alice"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.destination+`}`))
+			translator := &fakeTranslator{}
+			useTranslator(t, translator)
+			// Previews translate only what was translated for a post.
+			(Channel{teamB, chanB}).Translate(context.Background(), slackMessage{Text: "cached"})
+			translator.calls = 0
+
+			body := mustMarshal(t, previewRequest{Channel: test.channel, Username: test.username, Text: test.text})
+			w := serveRequest(previewHandler, "/preview", httptest.NewRequest("POST", "/preview", strings.NewReader(string(body))))
+			if w.Code != test.wantStatus {
+				t.Fatalf("previewHandler returned %v, want %v", w.Code, test.wantStatus)
+			}
+			if len(slack.calls) != 0 {
+				t.Errorf("Preview called Slack: %+v", slack.calls)
+			}
+			if translator.calls != 0 {
+				t.Errorf("Preview called the translator %d times", translator.calls)
+			}
+			if test.wantStatus != 200 {
+				return
+			}
+
+			var response struct {
+				Destinations []struct {
+					Channel string
+					Text    string
+					Payload struct {
+						Username string `json:"username"`
+					}
+				}
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Destinations) != 1 {
+				t.Fatalf("Got %d destinations, want 1", len(response.Destinations))
+			}
+			got := response.Destinations[0]
+			if got.Channel != teamB+"/"+chanB || got.Text != test.wantText || got.Payload.Username != test.wantUsername {
+				t.Errorf("Got %v %q from %q, want %v/%v %q from %q", got.Channel, got.Text, got.Payload.Username, teamB, chanB, test.wantText, test.wantUsername)
+			}
+		})
+	}
+}
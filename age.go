@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// parseTimestamp converts a Slack message timestamp such as
+// "1392734382.000200" to a time.
+func parseTimestamp(ts string) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+// Stale reports whether the message is older than the max_message_age
+// setting. Replayed messages and messages without a timestamp are never
+// stale.
+func (msg *slackMessage) Stale() bool {
+	maxAge := config().settings.MaxMessageAge.Duration
+	if maxAge == 0 || msg.Replay || msg.Timestamp == "" {
+		return false
+	}
+	sent, err := parseTimestamp(msg.Timestamp)
+	if err != nil {
+		return false
+	}
+	return now().Sub(sent) > maxAge
+}
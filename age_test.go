@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		ts      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"1488369600.000100", time.Unix(1488369600, 100000), false},
+		{"1488369600", time.Unix(1488369600, 0), false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, test := range tests {
+		got, err := parseTimestamp(test.ts)
+		if (err != nil) != test.wantErr || got.Sub(test.want).Abs() > time.Microsecond {
+			t.Errorf("parseTimestamp(%q) = %v, %v; want %v", test.ts, got, err, test.want)
+		}
+	}
+}
+
+func TestStaleMessages(t *testing.T) {
+	// The fake clock is at 1488369600.
+	tests := []struct {
+		name     string
+		settings string
+		ts       string
+		replay   bool
+		want     bool
+	}{
+		{"fresh", `{"max_message_age": "1h"}`, "1488369000.000100", false, true},
+		{"stale", `{"max_message_age": "1h"}`, "1488362400.000100", false, false},
+		{"stale replay", `{"max_message_age": "1h"}`, "1488362400.000100", true, true},
+		{"no limit", `{"max_message_age": "0s"}`, "1388362400.000100", false, true},
+		{"no timestamp", `{"max_message_age": "1h"}`, "", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeClock(t)
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: test.ts, Replay: test.replay}
+			Bridge(msg)
+			if forwarded := len(slack.Posts()) == 1; forwarded != test.want {
+				t.Errorf("Forwarded = %v, want %v", forwarded, test.want)
+			}
+			if dropped := stats.Snapshot(false).Dropped[dropStale]; (dropped == 1) == test.want {
+				t.Errorf("Counted %d stale drops", dropped)
+			}
+		})
+	}
+}
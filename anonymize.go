@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const defaultPseudonymPrefix = "User-"
+
+// pseudonym returns the stable pseudonym of user under the group's salt,
+// distinct for each destination when dest is set.
+func pseudonym(options GroupOptions, dest DestinationInfo, user string) string {
+	prefix := options.PseudonymPrefix
+	if prefix == "" {
+		prefix = defaultPseudonymPrefix
+	}
+	sum := sha256.Sum256([]byte(options.AnonymizeSalt + "/" + dest.Channel.String() + "/" + user))
+	return prefix + hex.EncodeToString(sum[:3])
+}
+
+// Anonymize replaces the author's name with a pseudonym derived from their
+// ID and the group's AnonymizeSalt, drops their picture for the group's
+// fallback icon and replaces user mentions with the mentioned users'
+// pseudonyms. Mentions are only recognized ahead of the mentions
+// transform. Run again for a destination, it gives the author and the
+// users already mentioned by pseudonym the destination's pseudonyms, so a
+// message never mixes the two. Groups without a salt are left alone.
+func (msg *slackMessage) Anonymize(_ context.Context, dest DestinationInfo) error {
+	options := msg.Group().Options
+	if options.AnonymizeSalt == "" {
+		return nil
+	}
+
+	author := msg.author()
+	if author != "" {
+		msg.Username = pseudonym(options, dest, author)
+		msg.Icon, msg.IconEmoji = "", ""
+		msg.setFallbackIcon()
+	}
+	pseudonyms := make(map[string]string)
+	for previous, user := range msg.Pseudonyms {
+		name := pseudonym(options, dest, user)
+		msg.Text = strings.Replace(msg.Text, "@"+previous, "@"+name, -1)
+		pseudonyms[name] = user
+	}
+	msg.Text = mentionRegexp.ReplaceAllStringFunc(msg.Text, func(s string) string {
+		user := s[2 : len(s)-1]
+		if bar := strings.IndexByte(user, '|'); bar >= 0 {
+			user = user[:bar]
+		}
+		name := pseudonym(options, dest, user)
+		pseudonyms[name] = user
+		return "@" + name
+	})
+	msg.Pseudonyms = pseudonyms
+	return nil
+}
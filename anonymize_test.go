@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPseudonym(t *testing.T) {
+	salted := GroupOptions{AnonymizeSalt: "salt"}
+	dest := DestinationInfo{Channel: Channel{teamB, chanB}}
+	tests := []struct {
+		name     string
+		a, b     string
+		options  GroupOptions
+		destA    DestinationInfo
+		destB    DestinationInfo
+		wantSame bool
+	}{
+		{"same user", "U0000000A", "U0000000A", salted, DestinationInfo{}, DestinationInfo{}, true},
+		{"different users", "U0000000A", "U0000000B", salted, DestinationInfo{}, DestinationInfo{}, false},
+		{"same user in a destination", "U0000000A", "U0000000A", salted, dest, dest, true},
+		{"destination scope", "U0000000A", "U0000000A", salted, DestinationInfo{}, dest, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := pseudonym(test.options, test.destA, test.a)
+			b := pseudonym(test.options, test.destB, test.b)
+			if (a == b) != test.wantSame {
+				t.Errorf("Pseudonyms %q and %q, want the same %v", a, b, test.wantSame)
+			}
+			if !strings.HasPrefix(a, defaultPseudonymPrefix) {
+				t.Errorf("Pseudonym %q lacks the prefix %q", a, defaultPseudonymPrefix)
+			}
+		})
+	}
+	if other := pseudonym(GroupOptions{AnonymizeSalt: "pepper"}, DestinationInfo{}, "U0000000A"); other == pseudonym(salted, DestinationInfo{}, "U0000000A") {
+		t.Errorf("Different salts gave the same pseudonym")
+	}
+	if got := pseudonym(GroupOptions{AnonymizeSalt: "salt", PseudonymPrefix: "Anon "}, DestinationInfo{}, "U0000000A"); !strings.HasPrefix(got, "Anon ") {
+		t.Errorf("Pseudonym %q lacks the configured prefix", got)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     string
+		destination string
+		wantScope   DestinationInfo
+	}{
+		{"group", `{"anonymize_salt": "salt"}`, `{}`, DestinationInfo{}},
+		{"destination", `{"anonymize_salt": "salt"}`, `{"pipeline": ["anonymize"]}`, DestinationInfo{Channel: Channel{teamB, chanB}}},
+		{"destination only", `{"anonymize_salt": "salt", "pipeline": ["template"]}`, `{"pipeline": ["anonymize"]}`, DestinationInfo{Channel: Channel{teamB, chanB}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options, `"destinations": {"`+teamB+"/"+chanB+`": `+test.destination+`}`))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, UserId: "U0000000A", Username: "alice", Text: "ask <@U0000000B> and <@U0000000A|alice>", Timestamp: "1.000"}
+			msg.Transform(context.Background())
+			if err := (Channel{teamB, chanB}).PostMessage(testContext(t), msg); err != nil {
+				t.Fatalf("PostMessage: %v", err)
+			}
+
+			posts := slack.Posts()
+			if len(posts) != 1 {
+				t.Fatalf("Made %d posts, want 1", len(posts))
+			}
+			options := msg.Group().Options
+			author := pseudonym(options, test.wantScope, "U0000000A")
+			mentioned := pseudonym(options, test.wantScope, "U0000000B")
+			if got := posts[0].Get("username"); got != author {
+				t.Errorf("Posted as %q, want %q", got, author)
+			}
+			if got, want := posts[0].Get("text"), "ask @"+mentioned+" and @"+author; got != want {
+				t.Errorf("Posted %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAnonymizeWithoutSalt(t *testing.T) {
+	useConfig(t, testConfig(""))
+	msg := slackMessage{Channel: Channel{teamA, chanA}, UserId: "U0000000A", Username: "alice", Text: "ask <@U0000000B>"}
+	msg.Anonymize(context.Background(), DestinationInfo{})
+	if msg.Username != "alice" || msg.Text != "ask <@U0000000B>" {
+		t.Errorf("Anonymized a group without a salt: %q from %q", msg.Text, msg.Username)
+	}
+}
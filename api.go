@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var apiURL = "https://slack.com/api/"
+
+type apiResponse struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// apiCall invokes a Slack Web API method with form-encoded values and
+// decodes the response into v, which may be nil. It covers the methods
+// the vendored client doesn't expose.
+func (t *Team) apiCall(ctx context.Context, method string, values url.Values, v interface{}) error {
+	values.Set("token", t.APIToken)
+	return t.doAPI(ctx, method, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()), v)
+}
+
+// apiCallJSON is like apiCall but sends a JSON body, as accepted by the
+// write methods such as chat.postMessage.
+func (t *Team) apiCallJSON(ctx context.Context, method string, body io.Reader, v interface{}) error {
+	return t.doAPI(ctx, method, "application/json; charset=utf-8", body, v)
+}
+
+// apiUpload is like apiCall but sends a multipart body with content as the
+// file part, as required by files.upload.
+func (t *Team) apiUpload(ctx context.Context, method string, values url.Values, filename string, content io.Reader, v interface{}) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key := range values {
+		writer.WriteField(key, values.Get(key))
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return t.doAPI(ctx, method, writer.FormDataContentType(), &body, v)
+}
+
+// apiError is a Web API call that Slack answered with ok: false.
+type apiError struct {
+	Method string
+	Code   string
+}
+
+func (e *apiError) Error() string {
+	return e.Method + ": " + e.Code
+}
+
+func (t *Team) doAPI(ctx context.Context, method string, contentType string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest("POST", apiURL+method, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+t.APIToken)
+
+	if !methodLimits.Wait(ctx, t.Id, method) {
+		return ctx.Err()
+	}
+	if err := t.acquire(ctx); err != nil {
+		return err
+	}
+	defer t.release()
+
+	err = t.doRequest(req, method, v)
+	methodLimits.Record(method, err)
+	return err
+}
+
+// doRequest sends a Web API request and decodes its response into v.
+func (t *Team) doRequest(req *http.Request, method string, v interface{}) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != 200 {
+		err := fmt.Errorf("%v: %v - %v", method, res.Status, string(content))
+		return classifyResponse(err, res, strings.TrimSpace(string(content)))
+	}
+
+	var status apiResponse
+	if err := json.Unmarshal(content, &status); err != nil {
+		return fmt.Errorf("%v: %v", method, err)
+	}
+	if !status.Ok {
+		return &apiError{method, status.Error}
+	}
+	if v != nil {
+		return json.Unmarshal(content, v)
+	}
+	return nil
+}
+
+// APIPostMessage posts msg to the channel using chat.postMessage and the
+// team's API token, returning the timestamp of the posted message.
+func (c Channel) APIPostMessage(ctx context.Context, msg slackMessage) (string, error) {
+	target, err := c.Target(ctx)
+	if err != nil {
+		log.Printf("Unable to resolve %v: %v", c, err)
+		return "", err
+	}
+	msg.Channel = Channel{c.TeamId, target}
+	team := c.Poster()
+	if msg.AsUser {
+		override := *team
+		override.APIToken = c.Options().UserToken
+		team = &override
+	}
+
+	log.Printf("Posting message to %v via chat.postMessage", c)
+
+	var response struct {
+		Timestamp string `json:"ts"`
+	}
+	post := func() error {
+		if !c.Captured() {
+			return team.apiCallJSON(ctx, "chat.postMessage", msg.payload(), &response)
+		}
+		body, _ := ioutil.ReadAll(msg.payload())
+		var raw json.RawMessage
+		err := team.apiCallJSON(ctx, "chat.postMessage", bytes.NewReader(body), &raw)
+		if err != nil {
+			c.logCapture("chat.postMessage", body, err.Error())
+			return err
+		}
+		c.logCapture("chat.postMessage", body, string(raw))
+		return json.Unmarshal(raw, &response)
+	}
+	err = post()
+	if apiErr, ok := err.(*apiError); ok && apiErr.Code == "not_in_channel" && c.Options().AutoJoin {
+		if joinErr := team.Join(ctx, target); joinErr != nil {
+			log.Printf("Unable to join %v, invite the bridge if it is a private channel: %v", c, joinErr)
+		} else {
+			log.Printf("Joined %v, retrying post", c)
+			err = post()
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		return "", classifyPostError(err)
+	}
+	return response.Timestamp, nil
+}
+
+// Join adds the team's bot to a public channel with conversations.join.
+// Private channels can't be joined this way.
+func (t *Team) Join(ctx context.Context, channel string) error {
+	return t.apiCall(ctx, "conversations.join", url.Values{"channel": {channel}}, nil)
+}
+
+// PostEphemeral shows text to user in channel with chat.postEphemeral.
+func (t *Team) PostEphemeral(ctx context.Context, channel string, user string, text string) error {
+	values := url.Values{"channel": {channel}, "user": {user}, "text": {text}}
+	return t.apiCall(ctx, "chat.postEphemeral", values, nil)
+}
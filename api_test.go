@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestUserToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    string
+		rejected   bool
+		wantTokens []string
+		wantAsUser []string
+	}{
+		{"bot", `{"token": "xoxb-dest"}`, false, []string{"Bearer xoxb-dest"}, []string{""}},
+		{"user token", `{"user_token": "xoxp-user"}`, false, []string{"Bearer xoxp-user"}, []string{"true"}},
+		{"rejected user token", `{"user_token": "xoxp-user"}`, true,
+			[]string{"Bearer xoxp-user", "Bearer xoxb-b"}, []string{"true", ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("chat.postMessage", func(call fakeCall) string {
+				if test.rejected && call.Header.Get("Authorization") == "Bearer xoxp-user" {
+					return `{"ok":false,"error":"invalid_auth"}`
+				}
+				return `{"ok":true,"ts":"9.000"}`
+			})
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.options+`}`))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello", Timestamp: "1.000"}
+			if err := (Channel{teamB, chanB}).PostMessage(context.Background(), msg); err != nil {
+				t.Fatalf("PostMessage: %v", err)
+			}
+			posts := slack.Calls("chat.postMessage")
+			if len(posts) != len(test.wantTokens) {
+				t.Fatalf("Made %d posts, want %d", len(posts), len(test.wantTokens))
+			}
+			for i, post := range posts {
+				if token, asUser := post.Header.Get("Authorization"), post.Get("as_user"); token != test.wantTokens[i] || asUser != test.wantAsUser[i] {
+					t.Errorf("Post %d used %q with as_user %q, want %q with %q", i, token, asUser, test.wantTokens[i], test.wantAsUser[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAutoJoin(t *testing.T) {
+	tests := []struct {
+		name      string
+		autoJoin  bool
+		join      string
+		wantJoins int
+		wantPosts int
+		wantErr   bool
+	}{
+		{"joined and retried", true, `{"ok":true}`, 1, 2, false},
+		{"private channel", true, `{"ok":false,"error":"method_not_supported_for_channel_type"}`, 1, 1, true},
+		{"disabled", false, `{"ok":true}`, 0, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			joined := false
+			slack.Handle("conversations.join", func(fakeCall) string {
+				joined = test.join == `{"ok":true}`
+				return test.join
+			})
+			slack.Handle("chat.postMessage", func(fakeCall) string {
+				if !joined {
+					return `{"ok":false,"error":"not_in_channel"}`
+				}
+				return `{"ok":true,"ts":"9.000"}`
+			})
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"token": "xoxb-dest", "auto_join": `+fmt.Sprint(test.autoJoin)+`}}`))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello", Timestamp: "1.000"}
+			err := (Channel{teamB, chanB}).PostMessage(context.Background(), msg)
+			if (err != nil) != test.wantErr {
+				t.Errorf("PostMessage = %v, want error %v", err, test.wantErr)
+			}
+			joins := slack.Calls("conversations.join")
+			if len(joins) != test.wantJoins {
+				t.Errorf("Made %d joins, want %d", len(joins), test.wantJoins)
+			}
+			if len(joins) > 0 && joins[0].Get("channel") != chanB {
+				t.Errorf("Joined %v, want %v", joins[0].Get("channel"), chanB)
+			}
+			if posts := len(slack.Calls("chat.postMessage")); posts != test.wantPosts {
+				t.Errorf("Made %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+)
+
+type archiveState struct {
+	archived bool
+	checked  time.Time
+}
+
+// archivedChannels caches whether each destination was archived when last
+// checked.
+var archivedChannels = newCache(10000, 0)
+
+// IsArchived reports whether channel is archived, using conversations.info.
+func (t *Team) IsArchived(ctx context.Context, channel string) (bool, error) {
+	var response struct {
+		Channel struct {
+			IsArchived bool `json:"is_archived"`
+		} `json:"channel"`
+	}
+	if err := t.apiCall(ctx, "conversations.info", url.Values{"channel": {channel}}, &response); err != nil {
+		return false, err
+	}
+	return response.Channel.IsArchived, nil
+}
+
+// Archived reports whether the destination is archived, checking again
+// once ArchiveCheckInterval has passed since the last check. A warning is
+// logged when a destination is found archived and when it is unarchived.
+// Destinations whose state can't be checked are assumed active, and a
+// failed check keeps the previous state until the next interval.
+func (c Channel) Archived(ctx context.Context) bool {
+	interval := config().settings.ArchiveCheckInterval.Duration
+	if interval <= 0 || c.IsUser() || c.GetTeam() == nil {
+		return false
+	}
+	poster := c.Poster()
+	if poster.APIToken == "" {
+		// Webhook-only teams can't call conversations.info.
+		return false
+	}
+
+	key := c.String()
+	var previous archiveState
+	if value, present := archivedChannels.Get(key); present {
+		previous = value.(archiveState)
+		if now().Sub(previous.checked) < interval {
+			return previous.archived
+		}
+	}
+
+	archived, err := poster.IsArchived(ctx, c.ChannelId)
+	if err != nil {
+		log.Printf("Unable to check whether %v is archived: %v", c, err)
+		archivedChannels.Set(key, archiveState{previous.archived, now()})
+		return previous.archived
+	}
+	switch {
+	case archived && !previous.archived:
+		log.Printf("Warning: %v is archived, skipping posts to it until it is unarchived", c)
+	case !archived && previous.archived:
+		log.Printf("%v is no longer archived, resuming posts to it", c)
+	}
+	archivedChannels.Set(key, archiveState{archived, now()})
+	return archived
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestArchivedDestinations(t *testing.T) {
+	archived := `{"ok":true,"channel":{"is_archived":true}}`
+	active := `{"ok":true,"channel":{"is_archived":false}}`
+	type step struct {
+		wait       time.Duration
+		response   string
+		wantPosted bool
+	}
+	tests := []struct {
+		name      string
+		extra     string
+		steps     []step
+		wantCalls int
+	}{
+		{"active", "", []step{{0, active, true}}, 1},
+		{"archived", "", []step{{0, archived, false}, {time.Minute, archived, false}}, 1},
+		{"unarchived", "", []step{{0, archived, false}, {11 * time.Minute, active, true}}, 2},
+		{"failed check", "", []step{{0, "", true}, {time.Minute, archived, true}, {11 * time.Minute, archived, false}}, 2},
+		{"failed check keeps the archived state", "", []step{{0, archived, false}, {11 * time.Minute, "", false}, {time.Minute, active, false}}, 2},
+		{"no API token", `"teams": [
+			{"id": "` + teamA + `", "api_token": "xoxb-a", "incoming_token": "hook-a"},
+			{"id": "` + teamB + `", "api_token": "", "incoming_token": "hook-b"}
+		]`, []step{{0, archived, true}}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			var extra []string
+			if test.extra != "" {
+				extra = append(extra, test.extra)
+			}
+			useConfig(t, testConfig("", extra...))
+			advance := fakeClock(t)
+
+			response := ""
+			slack.Handle("conversations.info", func(fakeCall) string {
+				if response == "" {
+					return `{"ok":false,"error":"internal_error"}`
+				}
+				return response
+			})
+			for i, step := range test.steps {
+				advance(step.wait)
+				response = step.response
+				before := len(slack.Posts())
+				Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: fmt.Sprint("message ", i), Timestamp: fmt.Sprintf("%d.000", i+1)})
+				if posted := len(slack.Posts()) > before; posted != step.wantPosted {
+					t.Errorf("Message %d posted %v, want %v", i, posted, step.wantPosted)
+				}
+			}
+			if calls := len(slack.Calls("conversations.info")); calls != test.wantCalls {
+				t.Errorf("Made %d conversations.info calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// attachmentText renders the readable parts of an attachment (pretext,
+// title, text and fields) as plain lines.
+func attachmentText(a slack.Attachment) string {
+	lines := make([]string, 0, 3+len(a.Fields))
+	for _, part := range []string{a.Pretext, a.Title, a.Text} {
+		if part != "" {
+			lines = append(lines, part)
+		}
+	}
+	for _, field := range a.Fields {
+		switch {
+		case field.Title != "" && field.Value != "":
+			lines = append(lines, "*"+field.Title+"*: "+field.Value)
+		case field.Value != "":
+			lines = append(lines, field.Value)
+		}
+	}
+	if len(lines) == 0 {
+		return a.Fallback
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TextFromAttachments replaces the message's attachments with their text.
+func (msg *slackMessage) TextFromAttachments() {
+	parts := make([]string, 0, len(msg.Attachments))
+	for _, a := range msg.Attachments {
+		if text := attachmentText(a); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	msg.Text = strings.Join(parts, "\n")
+	msg.Attachments = nil
+}
+
+// PrepareAttachments readies a message's attachments for forwarding. By
+// default the attachments are kept, including their fields, with a
+// fallback filled in for clients that can't show them. Their color is
+// kept unless the source team has an accent color, or a default one is
+// set. Groups with FlattenAttachments get them rendered into the text
+// instead.
+func (msg *slackMessage) PrepareAttachments() {
+	if len(msg.Attachments) == 0 {
+		return
+	}
+
+	if !msg.Group().Options.FlattenAttachments {
+		accent := msg.GetTeam().Options.Color
+		if accent == "" {
+			accent = config().settings.DefaultColor
+		}
+		// The attachments are shared with the message's other destinations
+		// and records, so they are changed in a copy.
+		attachments := append([]slack.Attachment(nil), msg.Attachments...)
+		for i := range attachments {
+			if attachments[i].Fallback == "" {
+				attachments[i].Fallback = attachmentText(attachments[i])
+			}
+			if accent != "" {
+				attachments[i].Color = accent
+			}
+		}
+		msg.Attachments = attachments
+		return
+	}
+
+	parts := make([]string, 0, len(msg.Attachments)+1)
+	if msg.Text != "" {
+		parts = append(parts, msg.Text)
+	}
+	for _, a := range msg.Attachments {
+		if text := attachmentText(a); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	msg.Text = strings.Join(parts, "\n")
+	msg.Attachments = nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+// ciAttachment is an attachment as posted by a typical CI integration.
+const ciAttachment = `[{
+	"fallback": "Build #42 failed",
+	"color": "danger",
+	"pretext": "Build failed on master",
+	"title": "Build #42",
+	"text": "3 tests failed",
+	"fields": [
+		{"title": "Branch", "value": "master", "short": true},
+		{"title": "Duration", "value": "4m12s", "short": true}
+	]
+}]`
+
+func TestAttachmentText(t *testing.T) {
+	tests := []struct {
+		name       string
+		attachment slack.Attachment
+		want       string
+	}{
+		{"empty", slack.Attachment{}, ""},
+		{"fallback only", slack.Attachment{Fallback: "Deployed"}, "Deployed"},
+		{"text over fallback", slack.Attachment{Fallback: "Deployed", Text: "Deployed v2"}, "Deployed v2"},
+		{"parts", slack.Attachment{Pretext: "pre", Title: "title", Text: "text"}, "pre\ntitle\ntext"},
+		{"fields", slack.Attachment{Fields: []slack.AttachmentField{
+			{Title: "Branch", Value: "master"},
+			{Value: "untitled"},
+			{Title: "Empty"},
+		}}, "*Branch*: master\nuntitled"},
+	}
+	for _, test := range tests {
+		if got := attachmentText(test.attachment); got != test.want {
+			t.Errorf("%v: attachmentText() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPrepareAttachments(t *testing.T) {
+	var attachments []slack.Attachment
+	if err := json.Unmarshal([]byte(ciAttachment), &attachments); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name            string
+		options         string
+		settings        string
+		wantText        string
+		wantAttachments int
+		wantColor       string
+	}{
+		{"kept", "", `{}`, "", 1, "danger"},
+		{"default color", "", `{"default_color": "#36a64f"}`, "", 1, "#36a64f"},
+		{"flattened", `{"flatten_attachments": true}`, `{}`,
+			"Build failed on master\nBuild #42\n3 tests failed\n*Branch*: master\n*Duration*: 4m12s", 0, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(test.options, `"settings": `+test.settings))
+			shared := append([]slack.Attachment(nil), attachments...)
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Attachments: shared}
+			msg.PrepareAttachments()
+
+			// Other destinations of the message see the attachments as sent.
+			if shared[0].Color != attachments[0].Color || shared[0].Fallback != attachments[0].Fallback {
+				t.Errorf("Changed the shared attachment to color %q, fallback %q", shared[0].Color, shared[0].Fallback)
+			}
+
+			if msg.Text != test.wantText {
+				t.Errorf("Text = %q, want %q", msg.Text, test.wantText)
+			}
+			if len(msg.Attachments) != test.wantAttachments {
+				t.Fatalf("Got %d attachments, want %d", len(msg.Attachments), test.wantAttachments)
+			}
+			if len(msg.Attachments) > 0 && msg.Attachments[0].Color != test.wantColor {
+				t.Errorf("Color = %q, want %q", msg.Attachments[0].Color, test.wantColor)
+			}
+		})
+	}
+}
+
+func TestBridgeBotAttachments(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig(""))
+	useQueue(t)
+
+	w := serveRequest(bridgeHandler, "/bridge", postForm("/bridge", url.Values{
+		"token":       {"out-a"},
+		"team_id":     {teamA},
+		"channel_id":  {chanA},
+		"user_name":   {"ci"},
+		"timestamp":   {"1488369600.000100"},
+		"attachments": {ciAttachment},
+	}))
+	if w.Code != 200 {
+		t.Fatalf("bridgeHandler returned %v", w.Code)
+	}
+	waitFor(t, "the post", func() bool { return len(slack.Posts()) > 0 })
+
+	post := slack.Posts()[0]
+	if !strings.HasSuffix(post.Path, "/"+teamB+"/hook-b") {
+		t.Errorf("Posted to %v, want the webhook of %v", post.Path, teamB)
+	}
+	for _, want := range []string{"Build #42", "3 tests failed", "Branch", "4m12s", "danger"} {
+		if !strings.Contains(post.Get("attachments"), want) {
+			t.Errorf("Posted attachments %v, missing %q", post.Get("attachments"), want)
+		}
+	}
+}
+
+func TestAccentColor(t *testing.T) {
+	tests := []struct {
+		name      string
+		team      string
+		settings  string
+		wantColor string
+		wantErr   bool
+	}{
+		{"own color", `{}`, `{}`, "danger", false},
+		{"team color", `{"color": "#ff0000"}`, `{}`, "#ff0000", false},
+		{"default color", `{}`, `{"default_color": "#36a64f"}`, "#36a64f", false},
+		{"team over default", `{"color": "#ff0000"}`, `{"default_color": "#36a64f"}`, "#ff0000", false},
+		{"invalid team color", `{"color": "red"}`, `{}`, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := withTeamOptions(testConfig("", `"settings": `+test.settings), test.team)
+			fc, err := parseFileConfig([]byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := BuildConfiguration(fc, &ConfigErrors{}); (err != nil) != test.wantErr {
+				t.Fatalf("BuildConfiguration = %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			useConfig(t, content)
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Attachments: []slack.Attachment{{Text: "build", Color: "danger"}}}
+			msg.PrepareAttachments()
+			if payload := string(mustMarshal(t, msg.Attachments)); !strings.Contains(payload, `"color":"`+test.wantColor+`"`) {
+				t.Errorf("Attachments %s, want color %v", payload, test.wantColor)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	auditDelivered = "delivered"
+	auditFailed    = "failed"
+)
+
+// auditEvent is the record of one delivery sent to a group's audit
+// webhook.
+type auditEvent struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Timestamp   string    `json:"ts,omitempty"`
+	Status      string    `json:"status"`
+	LatencyMs   int64     `json:"latency_ms"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty"`
+	At          time.Time `json:"at"`
+
+	webhook WebhookOptions
+}
+
+// auditQueue buffers audit events for a single sender, so deliveries
+// never wait on the audit webhook. Events arriving while the buffer is
+// full are dropped.
+type auditQueue struct {
+	once   sync.Once
+	events chan auditEvent
+}
+
+var audits = &auditQueue{}
+
+// Send queues event, starting the sender on first use.
+func (q *auditQueue) Send(event auditEvent) {
+	q.once.Do(func() {
+		q.events = make(chan auditEvent, config().settings.AuditBuffer)
+		go q.run()
+	})
+	select {
+	case q.events <- event:
+	default:
+		stats.AuditDropped()
+		log.Printf("Audit buffer full, dropping event for %v", event.Destination)
+	}
+}
+
+func (q *auditQueue) run() {
+	for event := range q.events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Unable to encode audit event: %v", err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+		if err := event.webhook.send(ctx, body); err != nil {
+			log.Printf("Unable to send audit event for %v: %v", event.Destination, err)
+		}
+		cancel()
+	}
+}
+
+// audit records the outcome of delivering msg to c, after attempts posts
+// taking latency in all, to the group's audit webhook if it has one.
+func (c Channel) audit(msg slackMessage, err error, attempts int, latency time.Duration) {
+	group := msg.Group()
+	if group == nil || group.Options.AuditWebhook == nil {
+		return
+	}
+
+	event := auditEvent{
+		Source:      msg.Channel.String(),
+		Destination: c.String(),
+		Timestamp:   msg.Timestamp,
+		Status:      auditDelivered,
+		LatencyMs:   int64(latency / time.Millisecond),
+		Attempts:    attempts,
+		At:          now(),
+		webhook:     *group.Options.AuditWebhook,
+	}
+	if err != nil {
+		event.Status, event.Error = auditFailed, err.Error()
+	}
+	audits.Send(event)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantStatus   string
+		wantAttempts int
+		wantError    bool
+	}{
+		{"delivered", 0, auditDelivered, 1, false},
+		{"failed after retries", 500, auditFailed, 3, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := make(chan auditEvent, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var event auditEvent
+				json.NewDecoder(r.Body).Decode(&event)
+				events <- event
+			}))
+			defer server.Close()
+			slack := newFakeSlack(t)
+			slack.Fail("webhook", test.status)
+			useConfig(t, testConfig(`{"audit_webhook": {"url": "`+server.URL+`"}}`,
+				`"settings": {"post_retries": 2, "retry_delay": "1ms"}`))
+			useAuditQueue(t)
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello", Timestamp: "1.000"}
+			(Channel{teamB, chanB}).deliverNow(testContext(t), msg)
+
+			var event auditEvent
+			select {
+			case event = <-events:
+			case <-time.After(time.Second):
+				t.Fatalf("No audit event sent")
+			}
+			if event.Source != teamA+"/"+chanA || event.Destination != teamB+"/"+chanB || event.Timestamp != "1.000" {
+				t.Errorf("Audited delivery of %v from %v to %v", event.Timestamp, event.Source, event.Destination)
+			}
+			if event.Status != test.wantStatus || event.Attempts != test.wantAttempts || (event.Error != "") != test.wantError {
+				t.Errorf("Audited %v after %d attempts with error %q, want %v after %d, error %v",
+					event.Status, event.Attempts, event.Error, test.wantStatus, test.wantAttempts, test.wantError)
+			}
+			if event.LatencyMs < 0 || event.At.IsZero() {
+				t.Errorf("Audited latency %vms at %v", event.LatencyMs, event.At)
+			}
+		})
+	}
+}
+
+func TestAuditWithoutWebhook(t *testing.T) {
+	newFakeSlack(t)
+	useConfig(t, testConfig(""))
+	queued := audits
+	audits = &auditQueue{}
+	defer func() { audits = queued }()
+
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello"}
+	(Channel{teamB, chanB}).deliverNow(testContext(t), msg)
+	if audits.events != nil {
+		t.Errorf("Queued an audit event for a group without an audit webhook")
+	}
+}
+
+func TestAuditQueueOverflow(t *testing.T) {
+	tests := []struct {
+		buffer      int
+		events      int
+		wantDropped int64
+	}{
+		{1, 1, 0},
+		{1, 3, 2},
+		{5, 3, 0},
+	}
+	for _, test := range tests {
+		useConfig(t, testConfig(""))
+		// A queue without a sender, so events stay buffered.
+		q := &auditQueue{events: make(chan auditEvent, test.buffer)}
+		q.once.Do(func() {})
+		for i := 0; i < test.events; i++ {
+			q.Send(auditEvent{Destination: teamB + "/" + chanB})
+		}
+		if got := stats.Snapshot(false).AuditDropped; got != test.wantDropped {
+			t.Errorf("Sending %d events to a buffer of %d dropped %d, want %d", test.events, test.buffer, got, test.wantDropped)
+		}
+	}
+}
+
+// useAuditQueue replaces the audit queue with one whose sender is stopped
+// when the test ends, so it can't outlive the test's config.
+func useAuditQueue(t testing.TB) {
+	t.Helper()
+	previous := audits
+	q := &auditQueue{events: make(chan auditEvent, 10)}
+	q.once.Do(func() {})
+	done := make(chan struct{})
+	go func() {
+		q.run()
+		close(done)
+	}()
+	audits = q
+	t.Cleanup(func() {
+		close(q.events)
+		<-done
+		audits = previous
+	})
+}
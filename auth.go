@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Credential is a token or signing secret, accepted until Expires when
+// set. Giving the outgoing credential an expiry alongside its replacement
+// lets both work during a rotation window.
+type Credential struct {
+	Value   string     `json:"value"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+func (c Credential) Valid(at time.Time) bool {
+	return c.Value != "" && (c.Expires == nil || at.Before(*c.Expires))
+}
+
+// Credentials is a list of accepted credentials. Besides a JSON array of
+// credentials it can be written as a string of VALUE[@EXPIRES] entries
+// separated by "|", with EXPIRES in RFC 3339 format.
+type Credentials []Credential
+
+func ParseCredentials(s string) (Credentials, error) {
+	var credentials Credentials
+	for _, entry := range strings.Split(s, "|") {
+		parts := strings.SplitN(entry, "@", 2)
+		credential := Credential{Value: parts[0]}
+		if len(parts) == 2 {
+			expires, err := time.Parse(time.RFC3339, parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid credential expiry %q: %v", parts[1], err)
+			}
+			credential.Expires = &expires
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, nil
+}
+
+func (c *Credentials) UnmarshalJSON(b []byte) error {
+	var list []Credential
+	if err := json.Unmarshal(b, &list); err == nil {
+		*c = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*c = nil
+		return nil
+	}
+	parsed, err := ParseCredentials(s)
+	*c = parsed
+	return err
+}
+
+// Accepts reports whether value matches a credential that is valid now.
+func (c Credentials) Accepts(value string) bool {
+	for _, credential := range c {
+		if credential.Valid(now()) && hmac.Equal([]byte(credential.Value), []byte(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns the credentials that are valid now.
+func (c Credentials) active() []string {
+	var values []string
+	for _, credential := range c {
+		if credential.Valid(now()) {
+			values = append(values, credential.Value)
+		}
+	}
+	return values
+}
+
+const maxSignatureAge = 5 * time.Minute
+
+// verifySignature checks Slack's request signature over body against each
+// active signing secret.
+func verifySignature(header http.Header, body []byte, secrets Credentials) bool {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return false
+	}
+	if age := now().Sub(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return false
+	}
+
+	for _, secret := range secrets.active() {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":"))
+		mac.Write(body)
+		expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyEvent checks an Events API request against the credentials of the
+// team it is for. Requests without a team, such as url_verification, are
+// accepted under any team's credentials.
+func VerifyEvent(header http.Header, body []byte, envelope eventEnvelope) bool {
+	var teams []*Team
+	if envelope.TeamId == "" {
+		for _, team := range config().teams {
+			teams = append(teams, team)
+		}
+	} else if team, present := config().teams[envelope.TeamId]; present {
+		teams = append(teams, team)
+	}
+
+	for _, team := range teams {
+		secrets, token := team.SigningSecrets, team.EventsToken
+		if len(secrets) == 0 && len(token) == 0 {
+			secrets, token = config().settings.SigningSecrets, config().settings.EventsToken
+		}
+		if verifySignature(header, body, secrets) || token.Accepts(envelope.Token) {
+			return true
+		}
+	}
+	return false
+}
+
+// verified applies the auth failure policy: with auth_fail_open set,
+// requests that fail verification are logged and processed anyway.
+func verified(ok bool, what string) bool {
+	if ok {
+		return true
+	}
+	if config().settings.AuthFailOpen {
+		log.Printf("Accepting unverified %v: auth_fail_open is set", what)
+		return true
+	}
+	return false
+}
+
+// requireInboundHeader rejects requests that don't carry the configured
+// inbound header and value, as injected by a fronting gateway. It is
+// independent of Slack's own token and signature checks.
+func requireInboundHeader(c *gin.Context) {
+	name := config().settings.InboundHeader
+	if name == "" {
+		return
+	}
+	value := c.Request.Header.Get(name)
+	if value == "" || !hmac.Equal([]byte(value), []byte(config().settings.InboundHeaderValue)) {
+		log.Printf("Rejecting request to %v without a valid %v header", c.Request.URL.Path, name)
+		c.AbortWithStatus(403)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signedEvent serves an Events API request for body, signed with secret
+// at the current time.
+func signedEvent(body string, secret string) *httptest.ResponseRecorder {
+	return serveRequest(eventsHandler, "/events", signedRequest(body, secret))
+}
+
+// signedRequest builds an Events API request for body, signed with secret
+// at the current time.
+func signedRequest(body string, secret string) *http.Request {
+	req := httptest.NewRequest("POST", "/events", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := fmt.Sprint(now().Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestParseCredentials(t *testing.T) {
+	expires := time.Date(2017, 3, 1, 13, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"secret", []string{"secret"}, false},
+		{"old@2017-03-01T13:00:00Z|new", []string{"old", "new"}, false},
+		{"old@tomorrow|new", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseCredentials(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseCredentials(%q) error = %v, want error %v", test.in, err, test.wantErr)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("ParseCredentials(%q) = %v, want %v", test.in, got, test.want)
+			continue
+		}
+		for i, value := range test.want {
+			if got[i].Value != value {
+				t.Errorf("ParseCredentials(%q)[%d] = %v, want %v", test.in, i, got[i].Value, value)
+			}
+		}
+		if len(got) == 2 && (got[0].Expires == nil || !got[0].Expires.Equal(expires) || got[1].Expires != nil) {
+			t.Errorf("ParseCredentials(%q) expiries = %v, %v", test.in, got[0].Expires, got[1].Expires)
+		}
+	}
+}
+
+func TestVerifyEvent(t *testing.T) {
+	rotating := "old@2017-03-01T13:00:00Z|new"
+	tests := []struct {
+		name     string
+		settings string
+		secretsA string
+		tokenA   string
+		wait     time.Duration
+		team     string
+		secret   string
+		token    string
+		want     int
+	}{
+		{"team secret", "{}", "secret-a", "", 0, teamA, "secret-a", "", 200},
+		{"wrong secret", "{}", "secret-a", "", 0, teamA, "secret-b", "", 403},
+		{"old secret during rotation", "{}", rotating, "", 0, teamA, "old", "", 200},
+		{"new secret during rotation", "{}", rotating, "", 0, teamA, "new", "", 200},
+		{"old secret after rotation", "{}", rotating, "", time.Hour, teamA, "old", "", 403},
+		{"new secret after rotation", "{}", rotating, "", time.Hour, teamA, "new", "", 200},
+		{"another team's secret", "{}", "secret-a", "", 0, teamB, "secret-a", "", 403},
+		{"unknown team", "{}", "secret-a", "", 0, "T0000000Z", "secret-a", "", 403},
+		{"legacy token", "{}", "", "token-a", 0, teamA, "", "token-a", 200},
+		{"settings fallback", `{"signing_secrets": "global"}`, "", "", 0, teamB, "global", "", 200},
+		{"team overrides settings", `{"signing_secrets": "global"}`, "secret-a", "", 0, teamA, "global", "", 403},
+		{"fail open", `{"auth_fail_open": true}`, "secret-a", "", 0, teamA, "secret-b", "", 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			var err error
+			if test.secretsA != "" {
+				config().teams[teamA].SigningSecrets, err = ParseCredentials(test.secretsA)
+			}
+			if test.tokenA != "" {
+				config().teams[teamA].EventsToken, err = ParseCredentials(test.tokenA)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			advance(test.wait)
+
+			body := `{"type":"event_callback","team_id":"` + test.team + `","token":"` + test.token + `","event_id":"Ev1","event":{"type":"app_mention"}}`
+			if w := signedEvent(body, test.secret); w.Code != test.want {
+				t.Errorf("eventsHandler returned %v, want %v", w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyURLVerification(t *testing.T) {
+	fakeClock(t)
+	useConfig(t, testConfig(""))
+	config().teams[teamB].SigningSecrets = Credentials{{Value: "secret-b"}}
+
+	body := `{"type":"url_verification","token":"x","challenge":"abc"}`
+	w := signedEvent(body, "secret-b")
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "abc") {
+		t.Errorf("url_verification returned %v %q, want the challenge", w.Code, w.Body.String())
+	}
+	if w := signedEvent(body, "secret-z"); w.Code != 403 {
+		t.Errorf("url_verification with an unknown secret returned %v, want 403", w.Code)
+	}
+}
+
+func TestTeamCredentialsConfig(t *testing.T) {
+	content := strings.Replace(testConfig(""), `"incoming_token": "hook-a"`,
+		`"incoming_token": "hook-a", "signing_secrets": "old@2017-03-01T13:00:00Z|new", "events_token": "token-a"`, 1)
+	c := useConfig(t, content)
+	team := c.teams[teamA]
+	if len(team.SigningSecrets) != 2 || team.SigningSecrets[1].Value != "new" || !team.EventsToken.Accepts("token-a") {
+		t.Errorf("Team credentials = %v, %v", team.SigningSecrets, team.EventsToken)
+	}
+	if other := c.teams[teamB]; len(other.SigningSecrets) != 0 || len(other.EventsToken) != 0 {
+		t.Errorf("Credentials leaked to %v: %v, %v", teamB, other.SigningSecrets, other.EventsToken)
+	}
+
+	parsed, err := parseFileConfig(mustMarshal(t, c.FileConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.team(teamA).SigningSecrets) != 2 {
+		t.Errorf("Team credentials lost from the file configuration: %+v", parsed.team(teamA))
+	}
+}
+
+func TestRequireInboundHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		header   string
+		want     int
+	}{
+		{"not configured", `{}`, "", 200},
+		{"present", `{"inbound_header": "X-Gateway-Secret", "inbound_header_value": "s3cret"}`, "s3cret", 200},
+		{"absent", `{"inbound_header": "X-Gateway-Secret", "inbound_header_value": "s3cret"}`, "", 403},
+		{"incorrect", `{"inbound_header": "X-Gateway-Secret", "inbound_header_value": "s3cret"}`, "guess", 403},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/bridge", requireInboundHeader, func(c *gin.Context) { c.Status(200) })
+
+			req := httptest.NewRequest("POST", "/bridge", nil)
+			if test.header != "" {
+				req.Header.Set("X-Gateway-Secret", test.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != test.want {
+				t.Errorf("Got %v, want %v", w.Code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// backfillMemory is how long the store remembers that a channel was
+// backfilled, so restarts don't backfill it again.
+const backfillMemory = 365 * 24 * time.Hour
+
+// backfills runs each source channel's backfill once, on its first
+// message. Later messages from the channel wait for it, so they are
+// forwarded after the backfilled ones. Channels are recorded in the store
+// once backfilled, and aren't backfilled again after a restart.
+var backfills = struct {
+	sync.Mutex
+	channels map[Channel]*sync.Once
+}{channels: make(map[Channel]*sync.Once)}
+
+// BackfillOnce forwards the messages posted in the source channel before
+// ts, up to its group's Backfill, unless the channel was backfilled
+// already.
+func (c Channel) BackfillOnce(ts string) {
+	backfills.Lock()
+	once, present := backfills.channels[c]
+	if !present {
+		once = &sync.Once{}
+		backfills.channels[c] = once
+	}
+	backfills.Unlock()
+
+	once.Do(func() {
+		key := "backfilled:" + c.String()
+		if _, done := store.Get(key); done {
+			return
+		}
+		if c.Backfill(ts) {
+			store.Set(key, ts, backfillMemory)
+		}
+	})
+}
+
+// Backfill forwards, oldest first, the group's Backfill most recent
+// messages posted in the channel before ts, read with
+// conversations.history. Messages older than max_message_age are dropped
+// as usual. It reports whether the history could be read.
+func (c Channel) Backfill(ts string) bool {
+	group := c.Group()
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	var response struct {
+		Messages []messageEvent `json:"messages"`
+	}
+	values := url.Values{"channel": {c.ChannelId}, "latest": {ts}, "limit": {strconv.Itoa(group.Options.Backfill)}}
+	if err := c.GetTeam().apiCall(ctx, "conversations.history", values, &response); err != nil {
+		log.Printf("Unable to backfill %v: %v", c, err)
+		return false
+	}
+
+	log.Printf("Backfilling %v messages from %v", len(response.Messages), c)
+	for i := len(response.Messages) - 1; i >= 0; i-- {
+		event := response.Messages[i]
+		if (event.Subtype != "" && event.Subtype != "bot_message") || event.Hidden {
+			continue
+		}
+		msg := event.message(c)
+		if event.BotId != "" && (config().settings.IgnoreBotIds.Contains(event.BotId) || !msg.fromBot(event, group)) {
+			continue
+		}
+		msg.Username = event.Username
+		msg.Backfill = true
+		stats.Received()
+		Bridge(msg)
+	}
+	return true
+}
+
+// MarkBackfilled adds a footer saying the message was backfilled. It runs
+// after the pipeline, so transforms such as templates and truncation
+// don't change or drop it.
+func (msg *slackMessage) MarkBackfilled() {
+	msg.Attachments = append(msg.Attachments, slack.Attachment{Fallback: "(backfilled)", Footer: "Backfilled from before the channel was bridged"})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBackfill(t *testing.T) {
+	// The clock is at 1488369600, so 1488369000 was ten minutes earlier.
+	history := `{"ok":true,"messages":[
+		{"type":"message","user":"U0000000A","text":"three","ts":"1488369300.000"},
+		{"type":"message","subtype":"bot_message","bot_id":"B1","username":"ci","text":"build passed","ts":"1488369200.000"},
+		{"type":"message","user":"U0000000A","text":"two","ts":"1488369100.000"},
+		{"type":"message","user":"U0000000A","text":"one","ts":"1488300000.000"}
+	]}`
+	tests := []struct {
+		name        string
+		options     string
+		extra       string
+		response    string
+		backfilled  bool
+		wantTexts   []string
+		wantHistory int
+	}{
+		{"last messages in order", `{"backfill": 4}`, "", history, false, []string{"one", "two", "three", "live"}, 1},
+		{"bots forwarded", `{"backfill": 4, "forward_bots": true}`, "", history, false, []string{"one", "two", "build passed", "three", "live"}, 1},
+		{"max age respected", `{"backfill": 4}`, `"settings": {"max_message_age": "1h"}`, history, false, []string{"two", "three", "live"}, 1},
+		{"already backfilled", `{"backfill": 4}`, "", history, true, []string{"live"}, 0},
+		{"history unavailable", `{"backfill": 4}`, "", `{"ok":false,"error":"not_in_channel"}`, false, []string{"live"}, 2},
+		{"disabled", `{}`, "", history, false, []string{"live"}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.history", func(fakeCall) string { return test.response })
+			var extra []string
+			if test.extra != "" {
+				extra = append(extra, test.extra)
+			}
+			useConfig(t, testConfig(test.options, extra...))
+			fakeClock(t)
+			if test.backfilled {
+				store.Set("backfilled:"+teamA+"/"+chanA, "1488369000.000", backfillMemory)
+			}
+
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "live", Timestamp: "1488369500.000"})
+
+			posts := slack.Posts()
+			var texts []string
+			for _, post := range posts {
+				texts = append(texts, post.Get("text"))
+			}
+			if strings.Join(texts, ",") != strings.Join(test.wantTexts, ",") {
+				t.Fatalf("Posted %q, want %q", texts, test.wantTexts)
+			}
+			for i, post := range posts {
+				marked := strings.Contains(post.Get("attachments"), "Backfilled")
+				if live := i == len(posts)-1; marked == live {
+					t.Errorf("Post %q marked as backfilled %v", texts[i], marked)
+				}
+				if strings.Contains(post.Get("text"), "backfilled") {
+					t.Errorf("Post %q has the marker in its text", texts[i])
+				}
+			}
+
+			// After a restart, the store says whether the channel was
+			// backfilled already.
+			backfills.channels = make(map[Channel]*sync.Once)
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "later", Timestamp: "1488369550.000"})
+			if calls := len(slack.Calls("conversations.history")); calls != test.wantHistory {
+				t.Errorf("Read the history %d times, want %d", calls, test.wantHistory)
+			}
+		})
+	}
+}
+
+func TestMarkBackfilled(t *testing.T) {
+	useConfig(t, testConfig(`{"template": "{{.User}}: {{.Text}}", "max_length": 10}`))
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "a message long enough to be truncated", Backfill: true}
+	msg.Transform(testContext(t))
+	msg.MarkBackfilled()
+	if strings.Contains(msg.Text, "backfilled") {
+		t.Errorf("Marker is in the text %q", msg.Text)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Footer == "" {
+		t.Errorf("Got attachments %+v, want the backfill footer", msg.Attachments)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBatchSize = 10
+
+// batch is the messages waiting to be posted to one destination together.
+type batch struct {
+	messages []slackMessage
+	timer    *time.Timer
+}
+
+// batcher holds the pending batch of each destination that batches
+// messages. A batch is posted when its window expires or it is full.
+type batcher struct {
+	sync.Mutex
+	pending map[Channel]*batch
+	// timers counts the batch timers that are set or still posting.
+	timers sync.WaitGroup
+}
+
+var batches = &batcher{pending: make(map[Channel]*batch)}
+
+func (msg *slackMessage) batchable() bool {
+	return len(msg.Files) == 0 && !msg.IsReply()
+}
+
+func (msg *slackMessage) author() string {
+	if msg.UserId != "" {
+		return msg.UserId
+	}
+	return msg.Username
+}
+
+// Add adds msg to dest's pending batch, starting one if needed. A batch
+// lasts for window from its first message. With byAuthor set, a message
+// from a different author posts the pending batch and starts a new one.
+func (b *batcher) Add(dest Channel, msg slackMessage, window time.Duration, byAuthor bool) {
+	size := dest.Options().BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	b.Lock()
+	var previous []slackMessage
+	current, present := b.pending[dest]
+	if present && byAuthor && current.messages[0].author() != msg.author() {
+		b.stop(current)
+		previous, present = current.messages, false
+	}
+	if !present {
+		current = &batch{}
+		b.pending[dest] = current
+		b.timers.Add(1)
+		current.timer = time.AfterFunc(window, func() {
+			defer b.timers.Done()
+			b.post(context.Background(), dest, current)
+		})
+	}
+	current.messages = append(current.messages, msg)
+	full := len(current.messages) >= size
+	b.Unlock()
+
+	if previous != nil {
+		postBatch(context.Background(), dest, previous)
+	}
+	if full {
+		b.stop(current)
+		b.post(context.Background(), dest, current)
+	}
+}
+
+// stop stops the batch's timer, if it hasn't fired yet.
+func (b *batcher) stop(current *batch) {
+	if current.timer.Stop() {
+		b.timers.Done()
+	}
+}
+
+// take removes the batch if it is still dest's pending batch, returning
+// its messages. It returns nothing once the batch was already taken.
+func (b *batcher) take(dest Channel, current *batch) []slackMessage {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.pending[dest] != current {
+		return nil
+	}
+	delete(b.pending, dest)
+	return current.messages
+}
+
+func (b *batcher) post(ctx context.Context, dest Channel, current *batch) {
+	if messages := b.take(dest, current); len(messages) > 0 {
+		postBatch(ctx, dest, messages)
+	}
+}
+
+// postBatch posts messages to dest as one post, then counts each message
+// and confirms it to its author as Bridge does for unbatched ones.
+func postBatch(ctx context.Context, dest Channel, messages []slackMessage) {
+	ctx, cancel := context.WithTimeout(ctx, config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	log.Printf("Posting batch of %v messages to %v", len(messages), dest)
+	err := dest.deliverNow(ctx, combine(messages))
+	for _, msg := range messages {
+		if err != nil {
+			stats.Error()
+			continue
+		}
+		stats.Forwarded()
+		if msg.Group().Options.ConfirmForwards {
+			msg.ConfirmForwards(ctx, []Channel{dest})
+		}
+	}
+}
+
+// Flush posts every pending batch and waits for those whose window
+// expired to be posted.
+func (b *batcher) Flush(ctx context.Context) error {
+	b.Lock()
+	pending := make(map[Channel]*batch, len(b.pending))
+	for dest, current := range b.pending {
+		b.stop(current)
+		pending[dest] = current
+	}
+	b.Unlock()
+
+	for dest, current := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b.post(ctx, dest, current)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.timers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop discards every pending batch and waits for those whose window
+// expired to be posted.
+func (b *batcher) Stop() {
+	b.Lock()
+	for dest, current := range b.pending {
+		b.stop(current)
+		delete(b.pending, dest)
+	}
+	b.Unlock()
+	b.timers.Wait()
+}
+
+// combine merges messages into one post, prefixing each message's text
+// with its author unless they all have the same author, who the post is
+// then made as.
+func combine(messages []slackMessage) slackMessage {
+	combined := messages[0]
+	if len(messages) == 1 {
+		return combined
+	}
+
+	sameAuthor := true
+	for _, msg := range messages[1:] {
+		if msg.Username != combined.Username {
+			sameAuthor = false
+		}
+	}
+
+	lines := make([]string, 0, len(messages))
+	combined.Attachments = nil
+	for _, msg := range messages {
+		if sameAuthor {
+			lines = append(lines, msg.Text)
+		} else {
+			lines = append(lines, "*"+msg.Username+"*: "+msg.Text)
+		}
+		combined.Attachments = append(combined.Attachments, msg.Attachments...)
+	}
+	combined.Text = strings.Join(lines, "\n")
+
+	if !sameAuthor {
+		combined.Username = ""
+		combined.Icon = ""
+	}
+	// The batch can't be mirrored as any one of its messages.
+	combined.Timestamp = ""
+	return combined
+}
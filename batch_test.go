@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+func TestCombine(t *testing.T) {
+	tests := []struct {
+		name         string
+		messages     []slackMessage
+		wantText     string
+		wantUsername string
+		wantAttached int
+	}{
+		{"single", []slackMessage{{Username: "alice", Text: "hi", Timestamp: "1.000"}}, "hi", "alice", 0},
+		{"same author", []slackMessage{
+			{Username: "alice", Text: "one"},
+			{Username: "alice", Text: "two"},
+		}, "one\ntwo", "alice", 0},
+		{"several authors", []slackMessage{
+			{Username: "alice", Text: "one", Attachments: []slack.Attachment{{Fallback: "a"}}},
+			{Username: "bob", Text: "two", Attachments: []slack.Attachment{{Fallback: "b"}}},
+		}, "*alice*: one\n*bob*: two", "", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := combine(test.messages)
+			if got.Text != test.wantText || got.Username != test.wantUsername || len(got.Attachments) != test.wantAttached {
+				t.Errorf("combine() = %q from %q with %d attachments, want %q from %q with %d",
+					got.Text, got.Username, len(got.Attachments), test.wantText, test.wantUsername, test.wantAttached)
+			}
+			if len(test.messages) > 1 && got.Timestamp != "" {
+				t.Errorf("Combined post kept timestamp %v", got.Timestamp)
+			}
+		})
+	}
+}
+
+func TestBatching(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   string
+		messages  int
+		spacing   time.Duration
+		wantPosts int
+	}{
+		{"burst", `{"batch_window": "50ms"}`, 3, 0, 1},
+		{"spaced", `{"batch_window": "10ms"}`, 3, 50 * time.Millisecond, 3},
+		{"full", `{"batch_window": "50ms", "batch_size": 2}`, 3, 0, 2},
+		{"unbatched", `{}`, 3, 0, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.options+`}`))
+			dest := Channel{teamB, chanB}
+
+			for i := 0; i < test.messages; i++ {
+				if i > 0 {
+					time.Sleep(test.spacing)
+				}
+				msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: fmt.Sprint("message ", i)}
+				dest.Deliver(testContext(t), msg)
+			}
+			if err := batches.Flush(testContext(t)); err != nil {
+				t.Fatal(err)
+			}
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Made %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
+
+func TestCoalesceByAuthor(t *testing.T) {
+	tests := []struct {
+		name      string
+		authors   []string
+		wantTexts []string
+	}{
+		{"same author", []string{"alice", "alice"}, []string{"message 0\nmessage 1"}},
+		{"different author breaks the merge", []string{"alice", "bob", "bob"}, []string{"message 0", "message 1\nmessage 2"}},
+		{"alternating", []string{"alice", "bob", "alice"}, []string{"message 0", "message 1", "message 2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(`{"coalesce_window": "1m"}`))
+			dest := Channel{teamB, chanB}
+
+			for i, author := range test.authors {
+				msg := slackMessage{Channel: Channel{teamA, chanA}, UserId: "U-" + author, Username: author, Text: fmt.Sprint("message ", i)}
+				dest.Deliver(testContext(t), msg)
+			}
+			if err := batches.Flush(testContext(t)); err != nil {
+				t.Fatal(err)
+			}
+
+			posts := slack.Posts()
+			if len(posts) != len(test.wantTexts) {
+				t.Fatalf("Made %d posts, want %d", len(posts), len(test.wantTexts))
+			}
+			for i, post := range posts {
+				if got := post.Get("text"); got != test.wantTexts[i] {
+					t.Errorf("Post %d = %q, want %q", i, got, test.wantTexts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBatcherWaitsForExpiredWindows(t *testing.T) {
+	tests := []struct {
+		name      string
+		flush     bool
+		wantPosts int32
+	}{
+		{"flush", true, 2},
+		{"stop", false, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			release := make(chan struct{})
+			var posted int32
+			slack.Handle("webhook", func(fakeCall) string {
+				<-release
+				atomic.AddInt32(&posted, 1)
+				return "ok"
+			})
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"batch_window": "100ms"}}`))
+			dest := Channel{teamB, chanB}
+
+			// The first batch is posting when the second is still pending.
+			dest.Deliver(testContext(t), slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "first"})
+			waitFor(t, "the first batch", func() bool { return len(slack.Posts()) > 0 })
+			dest.Deliver(testContext(t), slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "second"})
+			time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+			if test.flush {
+				if err := batches.Flush(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				batches.Stop()
+			}
+			if got := atomic.LoadInt32(&posted); got != test.wantPosts {
+				t.Errorf("Posted %d batches before returning, want %d", got, test.wantPosts)
+			}
+		})
+	}
+}
+
+func TestBatchedForwardsReported(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantForwarded int64
+		wantErrors    int64
+		wantConfirms  int
+	}{
+		{"posted", 0, 1, 0, 1},
+		{"failed", 500, 0, 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Fail("webhook", test.status)
+			useConfig(t, testConfig(`{"confirm_forwards": true}`, `"destinations": {"`+teamB+"/"+chanB+`": {"batch_window": "1h"}}`))
+
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, UserId: "U0000000A", Username: "alice", Text: "hi", Timestamp: "1.000"})
+			if snapshot := stats.Snapshot(false); snapshot.Forwarded != 0 || snapshot.Errors != 0 {
+				t.Errorf("Counted %d forwarded, %d errors before the batch was posted", snapshot.Forwarded, snapshot.Errors)
+			}
+			if confirms := len(slack.Calls("chat.postEphemeral")); confirms != 0 {
+				t.Errorf("Confirmed %d forwards before the batch was posted", confirms)
+			}
+
+			if err := batches.Flush(testContext(t)); err != nil {
+				t.Fatal(err)
+			}
+			if snapshot := stats.Snapshot(false); snapshot.Forwarded != test.wantForwarded || snapshot.Errors != test.wantErrors {
+				t.Errorf("Counted %d forwarded, %d errors, want %d, %d", snapshot.Forwarded, snapshot.Errors, test.wantForwarded, test.wantErrors)
+			}
+			if confirms := len(slack.Calls("chat.postEphemeral")); confirms != test.wantConfirms {
+				t.Errorf("Confirmed %d forwards, want %d", confirms, test.wantConfirms)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// broadcastRegexp matches @channel, @here and @everyone, as markup or as
+// text that link_names turns into a broadcast.
+var broadcastRegexp = regexp.MustCompile(`<!(channel|here|everyone)(?:\|[^>]*)?>|@(channel|here|everyone)\b`)
+
+// memberCounts caches each destination's member count.
+var memberCounts = newCache(10000, time.Hour)
+
+// MemberCount returns how many members channel has, using
+// conversations.info.
+func (t *Team) MemberCount(ctx context.Context, channel string) (int, error) {
+	var response struct {
+		Channel struct {
+			NumMembers int `json:"num_members"`
+		} `json:"channel"`
+	}
+	values := url.Values{"channel": {channel}, "include_num_members": {"true"}}
+	if err := t.apiCall(ctx, "conversations.info", values, &response); err != nil {
+		return 0, err
+	}
+	return response.Channel.NumMembers, nil
+}
+
+// DowngradeBroadcasts renders the broadcasts in text as plain text, which
+// notifies no one, when the channel has more members than its
+// broadcast_member_limit. Channels whose size can't be checked are
+// treated as too large, as are uncached ones in previews.
+func (c Channel) DowngradeBroadcasts(ctx context.Context, msg slackMessage) string {
+	text := msg.Text
+	limit := c.Options().BroadcastMemberLimit
+	if limit <= 0 || c.IsUser() || !broadcastRegexp.MatchString(text) {
+		return text
+	}
+
+	key := c.String()
+	count, present := memberCounts.Get(key)
+	if !present && msg.Preview {
+		count = limit + 1
+	} else if !present {
+		target, err := c.Target(ctx)
+		var n int
+		if err == nil {
+			n, err = c.GetTeam().MemberCount(ctx, target)
+		}
+		if err != nil {
+			log.Printf("Unable to count the members of %v, downgrading broadcasts: %v", c, err)
+			n = limit + 1
+		} else {
+			memberCounts.Set(key, n)
+		}
+		count = n
+	}
+	if count.(int) <= limit {
+		return text
+	}
+
+	return broadcastRegexp.ReplaceAllStringFunc(text, func(s string) string {
+		match := broadcastRegexp.FindStringSubmatch(s)
+		name := match[1] + match[2]
+		// A word joiner keeps link_names from linking the name.
+		return "@\u2060" + name
+	})
+}
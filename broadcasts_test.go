@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDowngradeBroadcasts(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     string
+		members   string
+		status    int
+		text      string
+		preview   bool
+		want      string
+		wantCalls int
+	}{
+		{"small destination", "50", "10", 0, "<!channel> deploy", false, "<!channel> deploy", 1},
+		{"large destination", "50", "500", 0, "<!channel> deploy", false, "@⁠channel deploy", 1},
+		{"labelled here", "50", "500", 0, "<!here|here> look", false, "@⁠here look", 1},
+		{"text broadcast", "50", "500", 0, "@everyone look", false, "@⁠everyone look", 1},
+		{"at the limit", "50", "50", 0, "<!here>", false, "<!here>", 1},
+		{"count failed", "50", "", 500, "<!here>", false, "@⁠here", 2},
+		{"no broadcast", "50", "500", 0, "hello <@U0000000A>", false, "hello <@U0000000A>", 0},
+		{"uncached in a preview", "50", "10", 0, "<!here>", true, "@⁠here", 0},
+		{"no limit", "0", "500", 0, "<!channel>", false, "<!channel>", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.info", func(fakeCall) string {
+				return `{"ok":true,"channel":{"num_members":` + test.members + `}}`
+			})
+			slack.Fail("conversations.info", test.status)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"broadcast_member_limit": `+test.limit+`}}`))
+			dest := Channel{teamB, chanB}
+
+			// The second message is answered from the cache, unless the
+			// count failed.
+			for i := 0; i < 2; i++ {
+				if got := dest.DowngradeBroadcasts(testContext(t), slackMessage{Text: test.text, Preview: test.preview}); got != test.want {
+					t.Errorf("DowngradeBroadcasts(%q) = %q, want %q", test.text, got, test.want)
+				}
+			}
+			calls := slack.Calls("conversations.info")
+			if len(calls) != test.wantCalls {
+				t.Errorf("Made %d conversations.info calls, want %d", len(calls), test.wantCalls)
+			}
+			for _, call := range calls {
+				if call.Get("channel") != chanB || call.Get("include_num_members") != "true" {
+					t.Errorf("Counted members with %v", call.Form)
+				}
+			}
+		})
+	}
+}
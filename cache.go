@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// cache is a concurrency-safe map bounded to max entries, evicted
+// oldest-first, whose entries optionally expire after ttl.
+type cache struct {
+	sync.Mutex
+	max     int
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	order   []string
+}
+
+func newCache(max int, ttl time.Duration) *cache {
+	return &cache{max: max, ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+func (c *cache) Get(key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, present := c.entries[key]
+	if !present || (c.ttl > 0 && now().After(entry.expires)) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *cache) Set(key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, present := c.entries[key]; !present {
+		for len(c.order) >= c.max {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = cacheEntry{value, now().Add(c.ttl)}
+}
+
+func (c *cache) Delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, present := c.entries[key]; !present {
+		return
+	}
+	delete(c.entries, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenRegexp matches Slack tokens, which are masked in captured posts.
+var tokenRegexp = regexp.MustCompile(`xox[a-z]-[0-9A-Za-z-]+`)
+
+// captureOptions chooses the posts whose outbound body and response are
+// logged: each post with probability Rate, and every post to one of
+// Destinations, given as TID/CID.
+type captureOptions struct {
+	Rate         float64    `json:"rate"`
+	Destinations StringList `json:"destinations"`
+}
+
+// captures holds the capture options set through the admin API, which
+// replace the capture_rate and capture_destinations settings until
+// restart.
+var captures = struct {
+	sync.Mutex
+	override *captureOptions
+}{}
+
+func currentCapture() captureOptions {
+	captures.Lock()
+	defer captures.Unlock()
+
+	if captures.override != nil {
+		return *captures.override
+	}
+	settings := config().settings
+	return captureOptions{settings.CaptureRate, settings.CaptureDestinations}
+}
+
+// Captured reports whether a post to c should be captured.
+func (c Channel) Captured() bool {
+	options := currentCapture()
+	return options.Destinations.Contains(c.String()) || (options.Rate > 0 && rand.Float64() < options.Rate)
+}
+
+// logCapture logs the body posted to c and Slack's response, with tokens
+// masked.
+func (c Channel) logCapture(method string, body []byte, response string) {
+	team := c.GetTeam()
+	redact := func(s string) string {
+		if team != nil && team.IncomingToken != "" {
+			s = strings.Replace(s, team.IncomingToken, "[redacted]", -1)
+		}
+		return tokenRegexp.ReplaceAllString(s, "xox-[redacted]")
+	}
+	log.Printf("Captured %v to %v: %s", method, c, redact(string(body)))
+	log.Printf("Captured response from %v: %s", c, redact(response))
+}
+
+func captureHandler(c *gin.Context) {
+	c.JSON(200, currentCapture())
+}
+
+// setCaptureHandler replaces the capture options. A rate of zero and no
+// destinations turns capturing off.
+func setCaptureHandler(c *gin.Context) {
+	var options captureOptions
+	if err := json.NewDecoder(c.Request.Body).Decode(&options); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if options.Rate < 0 || options.Rate > 1 {
+		c.JSON(400, gin.H{"error": "Capture rate must be between 0 and 1"})
+		return
+	}
+
+	captures.Lock()
+	captures.override = &options
+	captures.Unlock()
+	log.Printf("Capturing posts at rate %v and to %v", options.Rate, options.Destinations)
+	c.JSON(200, options)
+}
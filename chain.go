@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+)
+
+const chainEventType = "slackline_forward"
+
+// messageMetadata is Slack message metadata. Forwarded messages carry the
+// channels they were forwarded through, so a bridge further along can
+// extend the chain.
+type messageMetadata struct {
+	EventType    string `json:"event_type"`
+	EventPayload struct {
+		Chain    []string `json:"chain"`
+		Instance string   `json:"instance,omitempty"`
+	} `json:"event_payload"`
+}
+
+// chain returns the forwarding chain carried by metadata, if any.
+func (m *messageMetadata) chain() []string {
+	if m == nil || m.EventType != chainEventType {
+		return nil
+	}
+	return m.EventPayload.Chain
+}
+
+// ExtendChain adds the message's channel to its forwarding chain and sets
+// the metadata carrying it, with the bridge's instance ID, reporting false
+// if the chain exceeds the max_hops setting.
+func (msg *slackMessage) ExtendChain() bool {
+	chain := append(append([]string(nil), msg.Chain...), msg.Channel.String())
+	if max := config().settings.MaxHops; max > 0 && len(chain) > max {
+		return false
+	}
+	msg.Chain = chain
+	msg.Metadata = &messageMetadata{EventType: chainEventType}
+	msg.Metadata.EventPayload.Chain = chain
+	msg.Metadata.EventPayload.Instance = config().settings.InstanceId
+	return true
+}
+
+// AppendChain adds a footer showing the path of messages that came
+// through more than one hop.
+func (msg *slackMessage) AppendChain() {
+	if len(msg.Chain) > 1 {
+		msg.Text += "\n_via " + strings.Join(msg.Chain, " › ") + "_"
+	}
+}
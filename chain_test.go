@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestForwardingChain(t *testing.T) {
+	upstream := "T0000000Z/C0000000Z"
+	tests := []struct {
+		name      string
+		settings  string
+		options   string
+		chain     []string
+		wantPosts int
+		wantText  string
+		wantChain string
+	}{
+		{"first hop", `{}`, `{"show_chain": true}`, nil, 1, "hi", `["` + teamA + "/" + chanA + `"]`},
+		{"second hop", `{}`, `{"show_chain": true}`, []string{upstream}, 1,
+			"hi\n_via " + upstream + " › " + teamA + "/" + chanA + "_", `["` + upstream + `","` + teamA + "/" + chanA + `"]`},
+		{"footer off", `{}`, `{}`, []string{upstream}, 1, "hi", `["` + upstream + `","` + teamA + "/" + chanA + `"]`},
+		{"hop limit", `{"max_hops": 2}`, `{}`, []string{upstream, "T0000000Y/C0000000Y"}, 0, "", ""},
+		{"no limit", `{"max_hops": 0}`, `{}`, []string{upstream, "T0000000Y/C0000000Y"}, 1, "hi", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options, `"settings": `+test.settings))
+
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: "1.000", Chain: test.chain})
+
+			posts := slack.Posts()
+			if len(posts) != test.wantPosts {
+				t.Fatalf("Got %d posts, want %d", len(posts), test.wantPosts)
+			}
+			if test.wantPosts == 0 {
+				if dropped := stats.Snapshot(false).Dropped[dropHopLimit]; dropped != 1 {
+					t.Errorf("Counted %d %v drops, want 1", dropped, dropHopLimit)
+				}
+				return
+			}
+			if got := posts[0].Get("text"); got != test.wantText {
+				t.Errorf("Posted %q, want %q", got, test.wantText)
+			}
+			if test.wantChain != "" && !strings.Contains(posts[0].Get("metadata"), `"chain":`+test.wantChain) {
+				t.Errorf("Posted metadata %v, want chain %v", posts[0].Get("metadata"), test.wantChain)
+			}
+		})
+	}
+}
+
+func TestMetadataChain(t *testing.T) {
+	tests := []struct {
+		metadata string
+		want     int
+	}{
+		{`null`, 0},
+		{`{"event_type":"other","event_payload":{"chain":["a"]}}`, 0},
+		{`{"event_type":"slackline_forward","event_payload":{"chain":["a","b"]}}`, 2},
+	}
+	for _, test := range tests {
+		var m *messageMetadata
+		if err := json.Unmarshal([]byte(test.metadata), &m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.chain(); len(got) != test.want {
+			t.Errorf("chain() of %v = %v, want %d channels", test.metadata, got, test.want)
+		}
+	}
+}
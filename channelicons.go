@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// channelIcons caches the emoji found for each source channel, or "" when
+// it has none.
+var channelIcons = newCache(10000, time.Hour)
+
+var emojiRegexp = regexp.MustCompile(`:[a-z0-9_+'-]+:`)
+
+// ChannelEmoji returns the first emoji in the channel's topic or, failing
+// that, its purpose, using conversations.info.
+func (t *Team) ChannelEmoji(ctx context.Context, channel string) (string, error) {
+	key := t.Id + "/" + channel
+	if emoji, present := channelIcons.Get(key); present {
+		return emoji.(string), nil
+	}
+
+	var response struct {
+		Channel struct {
+			Topic struct {
+				Value string `json:"value"`
+			} `json:"topic"`
+			Purpose struct {
+				Value string `json:"value"`
+			} `json:"purpose"`
+		} `json:"channel"`
+	}
+	if err := t.apiCall(ctx, "conversations.info", url.Values{"channel": {channel}}, &response); err != nil {
+		return "", err
+	}
+
+	emoji := emojiRegexp.FindString(response.Channel.Topic.Value)
+	if emoji == "" {
+		emoji = emojiRegexp.FindString(response.Channel.Purpose.Value)
+	}
+	channelIcons.Set(key, emoji)
+	return emoji, nil
+}
+
+// ApplyChannelIcon replaces the author's icon with the emoji of the source
+// channel, keeping the author's icon when the channel has none.
+func (msg *slackMessage) ApplyChannelIcon(ctx context.Context) {
+	if msg.Preview || msg.GetTeam() == nil {
+		return
+	}
+	emoji, err := msg.GetTeam().ChannelEmoji(ctx, msg.ChannelId)
+	if err != nil {
+		log.Printf("Unable to fetch channel icon for %v: %v", msg.Channel, err)
+		return
+	}
+	if emoji != "" {
+		msg.Icon = ""
+		msg.IconEmoji = emoji
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestChannelIcon(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   string
+		response  string
+		wantEmoji string
+		wantIcon  string
+		wantCalls int
+	}{
+		{"topic emoji", `{"channel_icon": true}`, `{"ok":true,"channel":{"topic":{"value":"Deploys :rocket: here"},"purpose":{"value":":ship:"}}}`, ":rocket:", "", 1},
+		{"purpose emoji", `{"channel_icon": true}`, `{"ok":true,"channel":{"topic":{"value":"Deploys"},"purpose":{"value":"Ship it :ship:"}}}`, ":ship:", "", 1},
+		{"no emoji", `{"channel_icon": true}`, `{"ok":true,"channel":{"topic":{"value":"Deploys"}}}`, "", "https://img/alice", 1},
+		{"lookup failed", `{"channel_icon": true}`, `{"ok":false,"error":"channel_not_found"}`, "", "https://img/alice", 2},
+		{"disabled", `{}`, `{"ok":true,"channel":{"topic":{"value":":rocket:"}}}`, "", "https://img/alice", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.info", func(fakeCall) string { return test.response })
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.options+`}`))
+			dest := Channel{teamB, chanB}
+
+			// The second post must use the cached emoji.
+			for i := 0; i < 2; i++ {
+				msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Icon: "https://img/alice", Text: "hi"}
+				if err := dest.PostMessage(testContext(t), msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			posts := slack.Posts()
+			if len(posts) != 2 {
+				t.Fatalf("Made %d posts, want 2", len(posts))
+			}
+			if post := posts[1]; post.Get("icon_emoji") != test.wantEmoji || post.Get("icon_url") != test.wantIcon {
+				t.Errorf("Posted with icon %q and emoji %q, want %q and %q", post.Get("icon_url"), post.Get("icon_emoji"), test.wantIcon, test.wantEmoji)
+			}
+			calls := slack.Calls("conversations.info")
+			if len(calls) != test.wantCalls {
+				t.Errorf("Made %d conversations.info calls, want %d", len(calls), test.wantCalls)
+			}
+			for _, call := range calls {
+				if call.Get("channel") != chanA {
+					t.Errorf("Looked up %v, want the source channel", call.Get("channel"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	botMentionsCommand = "command"
+	botMentionsForward = "forward"
+	botMentionsDrop    = "drop"
+)
+
+// MentionsBridge reports whether the message mentions the bridge's own
+// user in the source team.
+func (msg *slackMessage) MentionsBridge() bool {
+	id := msg.GetTeam().UserId
+	if id == "" {
+		return false
+	}
+	return strings.Contains(msg.Text, "<@"+id+">") || strings.Contains(msg.Text, "<@"+id+"|")
+}
+
+// commands are run by mentioning the bridge, followed by the command name.
+// Anything else gets the list of commands.
+var commands = map[string]func(*slackMessage) string{
+	"status": statusCommand,
+}
+
+// RunCommand runs the command in a message mentioning the bridge,
+// replying to its author with an ephemeral message.
+func (msg *slackMessage) RunCommand() {
+	text := mentionRegexp.ReplaceAllString(msg.Text, "")
+	fields := strings.Fields(text)
+
+	command := func(*slackMessage) string { return helpText() }
+	if len(fields) > 0 {
+		if f, present := commands[strings.ToLower(fields[0])]; present {
+			command = f
+		}
+	}
+	reply := command(msg)
+
+	if msg.UserId == "" {
+		log.Printf("Unable to reply to command in %v: no user ID", msg.Channel)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+	if err := msg.GetTeam().PostEphemeral(ctx, msg.ChannelId, msg.UserId, reply); err != nil {
+		log.Printf("Unable to reply to command in %v: %v", msg.Channel, err)
+	}
+}
+
+func helpText() string {
+	names := []string{"help"}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "Commands: " + strings.Join(names, ", ")
+}
+
+// statusCommand lists the channels the message's channel is bridged to,
+// with the health of each.
+func statusCommand(msg *slackMessage) string {
+	destinations := health.Snapshot()
+	lines := []string{"This channel is bridged to:"}
+	msg.Channel.Forward(func(c Channel) {
+		state := "ok"
+		if h, present := destinations[c.String()]; present && !h.Healthy {
+			state = h.Breaker + ", last error: " + h.LastError
+		}
+		lines = append(lines, "• "+c.String()+" ("+state+")")
+	})
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBotMentions(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		text        string
+		wantPosts   int
+		wantReply   string
+		wantDropped int64
+	}{
+		{"plain message", botMentionsCommand, "hello", 1, "", 0},
+		{"status command", botMentionsCommand, "<@U0000000Z> status", 0, "This channel is bridged to:\n• " + teamB + "/" + chanB + " (ok)", 1},
+		{"unknown command", botMentionsCommand, "<@U0000000Z|bridge> frobnicate", 0, "Commands: help, status", 1},
+		{"forwarded", botMentionsForward, "<@U0000000Z> status", 1, "", 0},
+		{"dropped", botMentionsDrop, "<@U0000000Z> status", 0, "", 1},
+		{"other user", botMentionsCommand, "<@U0000000B> status", 1, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": {"bot_mentions": "`+test.mode+`"}`))
+			config().teams[teamA].UserId = "U0000000Z"
+
+			// The reply is made before Bridge returns.
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, UserId: "U0000000A", Username: "alice", Text: test.text, Timestamp: "1.000"})
+
+			replies := slack.Calls("chat.postEphemeral")
+			switch {
+			case test.wantReply == "" && len(replies) > 0:
+				t.Errorf("Replied %q, want no reply", replies[0].Get("text"))
+			case test.wantReply != "" && (len(replies) != 1 || replies[0].Get("text") != test.wantReply ||
+				replies[0].Get("user") != "U0000000A" || replies[0].Get("channel") != chanA):
+				t.Errorf("Replied with %v, want %q to the author", replies, test.wantReply)
+			}
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Made %d posts, want %d", posts, test.wantPosts)
+			}
+			if dropped := stats.Snapshot(false).Dropped[dropCommand]; dropped != test.wantDropped {
+				t.Errorf("Counted %d %v drops, want %d", dropped, dropCommand, test.wantDropped)
+			}
+		})
+	}
+}
+
+func TestBotMentionsConfig(t *testing.T) {
+	fc, err := parseFileConfig([]byte(testConfig("", `"settings": {"bot_mentions": "ignore"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildConfiguration(fc, &ConfigErrors{}); err == nil || !strings.Contains(err.Error(), "bot_mentions") {
+		t.Errorf("BuildConfiguration = %v, want the invalid bot_mentions rejected", err)
+	}
+}
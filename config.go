@@ -0,0 +1,683 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigErrors decides what happens to invalid configuration entries. In
+// strict mode, and for a nil *ConfigErrors, the first invalid entry fails
+// loading; in lenient mode invalid entries are recorded and skipped.
+type ConfigErrors struct {
+	Lenient bool
+	Skipped []error
+}
+
+// Skip returns err in strict mode, and records it and returns nil in
+// lenient mode. A nil err is ignored.
+func (e *ConfigErrors) Skip(err error) error {
+	if err == nil {
+		return nil
+	}
+	if e == nil || !e.Lenient {
+		return err
+	}
+	e.Skipped = append(e.Skipped, err)
+	return nil
+}
+
+type Configuration struct {
+	teams          map[string]*Team
+	channelMap     map[Channel]*Group
+	channelsById   map[string][]Channel
+	outboundTokens map[Channel]Credentials
+	destinations   map[Channel]DestinationOptions
+	settings       Settings
+	routes         []route
+}
+
+// FileConfig is the structured configuration format, read as JSON from the
+// file named by SLACKLINE_CONFIG. Channels are written as TID/CID.
+//
+// GroupDefaults holds group options shared by every group. A group's own
+// options override them field by field: maps such as reaction_actions are
+// merged key by key, while lists are replaced whole.
+//
+// Routes add channels that aren't in any group to a group by their name,
+// the first matching route winning. They only ever make a channel a
+// source.
+type FileConfig struct {
+	Teams          []TeamConfig                  `json:"teams"`
+	GroupDefaults  json.RawMessage               `json:"group_defaults,omitempty"`
+	Groups         []GroupConfig                 `json:"groups"`
+	Routes         []RouteConfig                 `json:"routes,omitempty"`
+	OutboundTokens map[string]Credentials        `json:"outbound_tokens"`
+	Destinations   map[string]DestinationOptions `json:"destinations,omitempty"`
+	Settings       Settings                      `json:"settings"`
+}
+
+type TeamConfig struct {
+	Id            string      `json:"id"`
+	APIToken      string      `json:"api_token"`
+	IncomingToken string      `json:"incoming_token"`
+	Options       TeamOptions `json:"options"`
+	// SigningSecrets and EventsToken verify the team's Events API
+	// requests. When either is set, they replace the settings of the same
+	// name for the team.
+	SigningSecrets Credentials `json:"signing_secrets,omitempty"`
+	EventsToken    Credentials `json:"events_token,omitempty"`
+}
+
+type GroupConfig struct {
+	Channels []string     `json:"channels"`
+	Options  GroupOptions `json:"options"`
+}
+
+func ParseChannel(s string) (Channel, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Channel{}, fmt.Errorf("Invalid channel %q, expected TID/CID", s)
+	}
+	team, err := normalizeId(parts[0], teamIdPrefixes, "team")
+	if err != nil {
+		return Channel{}, fmt.Errorf("Invalid channel %q: %v", s, err)
+	}
+	channel, err := normalizeId(parts[1], channelIdPrefixes, "channel")
+	if err != nil {
+		return Channel{}, fmt.Errorf("Invalid channel %q: %v", s, err)
+	}
+	return Channel{team, channel}, nil
+}
+
+// Legacy configuration format:
+// SLACKLINE_TEAMS=TEAM_ID:API_TOKEN:INCOMING_TOKEN,...
+// Incoming tokens are of the format Bxxxxxxx/xxxxxxxxxxxxxxx
+//
+// SLACKLINE_CHANNEL_MAP=TID/CID:TID/CID:TID/CID,...
+// A user ID (TID/UID) in place of a channel forwards to that user's direct
+// messages.
+// SLACKLINE_OUTBOUND_TOKENS=TID/CID:OUTGOING_TOKEN,...
+// To rotate a token, list both as OLD_TOKEN@EXPIRES|NEW_TOKEN, with
+// EXPIRES in RFC 3339 format.
+//
+// SLACKLINE_GROUP_DEFAULTS=KEY=VALUE;KEY=VALUE
+// Options applied to every group, overridden by the group's own options.
+//
+// SLACKLINE_GROUP_OPTIONS=TID/CID:KEY=VALUE;KEY=VALUE,...
+// Options apply to the whole group containing the given channel.
+//
+// SLACKLINE_TEAM_OPTIONS=TID:KEY=VALUE;KEY=VALUE,...
+// SLACKLINE_DESTINATION_OPTIONS=TID/CID:KEY=VALUE;KEY=VALUE,...
+//
+// SLACKLINE_SETTINGS=KEY=VALUE;KEY=VALUE
+func LegacyConfig(errs *ConfigErrors) (*FileConfig, error) {
+	fc := &FileConfig{
+		OutboundTokens: make(map[string]Credentials),
+		Settings:       DefaultSettings(),
+	}
+
+	for _, team_str := range splitList(os.Getenv("SLACKLINE_TEAMS")) {
+		parts := strings.Split(team_str, ":")
+		if len(parts) != 3 {
+			if err := errs.Skip(fmt.Errorf("Invalid team %q, expected TEAM_ID:API_TOKEN:INCOMING_TOKEN", team_str)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		fc.Teams = append(fc.Teams, TeamConfig{Id: parts[0], APIToken: parts[1], IncomingToken: parts[2]})
+	}
+
+	defaults := os.Getenv("SLACKLINE_GROUP_DEFAULTS")
+	for _, channels_str := range splitList(os.Getenv("SLACKLINE_CHANNEL_MAP")) {
+		group := GroupConfig{Channels: strings.Split(channels_str, ":")}
+		if err := parseOptions(defaults, &group.Options); err != nil {
+			if err := errs.Skip(fmt.Errorf("Invalid group defaults: %v", err)); err != nil {
+				return nil, err
+			}
+		}
+		fc.Groups = append(fc.Groups, group)
+	}
+
+	for _, token := range splitList(os.Getenv("SLACKLINE_OUTBOUND_TOKENS")) {
+		parts := strings.SplitN(token, ":", 2)
+		if len(parts) != 2 {
+			if err := errs.Skip(fmt.Errorf("Invalid outbound token %q, expected TID/CID:OUTGOING_TOKEN", token)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		credentials, err := ParseCredentials(parts[1])
+		if err != nil {
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		fc.OutboundTokens[parts[0]] = credentials
+	}
+
+	if options := os.Getenv("SLACKLINE_GROUP_OPTIONS"); options != "" {
+		for _, option_str := range strings.Split(options, ",") {
+			parts := strings.SplitN(option_str, ":", 2)
+			group := fc.group(parts[0])
+			var err error
+			if group == nil || len(parts) != 2 {
+				err = fmt.Errorf("Group options given for unmapped channel %v", parts[0])
+			} else {
+				err = parseOptions(parts[1], &group.Options)
+			}
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if options := os.Getenv("SLACKLINE_TEAM_OPTIONS"); options != "" {
+		for _, option_str := range strings.Split(options, ",") {
+			parts := strings.SplitN(option_str, ":", 2)
+			team := fc.team(parts[0])
+			var err error
+			if team == nil || len(parts) != 2 {
+				err = fmt.Errorf("Team options given for unknown team %v", parts[0])
+			} else {
+				err = parseOptions(parts[1], &team.Options)
+			}
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if options := os.Getenv("SLACKLINE_DESTINATION_OPTIONS"); options != "" {
+		fc.Destinations = make(map[string]DestinationOptions)
+		for _, option_str := range strings.Split(options, ",") {
+			parts := strings.SplitN(option_str, ":", 2)
+			destination := DefaultDestinationOptions()
+			var err error
+			if len(parts) != 2 {
+				err = fmt.Errorf("Invalid destination options %q, expected TID/CID:KEY=VALUE", option_str)
+			} else {
+				err = parseOptions(parts[1], &destination)
+			}
+			if err != nil {
+				if err := errs.Skip(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			fc.Destinations[parts[0]] = destination
+		}
+	}
+
+	settings := fc.Settings
+	if err := parseOptions(os.Getenv("SLACKLINE_SETTINGS"), &settings); err != nil {
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+	} else {
+		fc.Settings = settings
+	}
+	return fc, nil
+}
+
+// splitList splits a comma separated environment variable, skipping empty
+// entries so an unset variable is an empty list.
+func splitList(s string) []string {
+	var list []string
+	for _, entry := range strings.Split(s, ",") {
+		if strings.TrimSpace(entry) != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// group returns the group containing channel, or nil.
+func (fc *FileConfig) group(channel string) *GroupConfig {
+	for i := range fc.Groups {
+		for _, c := range fc.Groups[i].Channels {
+			if sameId(c, channel) {
+				return &fc.Groups[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (fc *FileConfig) team(id string) *TeamConfig {
+	for i := range fc.Teams {
+		if sameId(fc.Teams[i].Id, id) {
+			return &fc.Teams[i]
+		}
+	}
+	return nil
+}
+
+func ReadFileConfig(path string) (*FileConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fc, err := parseFileConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %v: %v", path, err)
+	}
+	return fc, nil
+}
+
+// parseFileConfig decodes the structured configuration, applying the
+// group defaults to each group's options.
+func parseFileConfig(content []byte) (*FileConfig, error) {
+	fc := &FileConfig{Settings: DefaultSettings()}
+	if err := json.Unmarshal(content, fc); err != nil {
+		return nil, err
+	}
+	if len(fc.GroupDefaults) == 0 {
+		return fc, nil
+	}
+
+	// Decoding a group's options over the defaults keeps every field the
+	// group doesn't set.
+	var raw struct {
+		Groups []struct {
+			Options json.RawMessage `json:"options"`
+		} `json:"groups"`
+	}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	for i, group := range raw.Groups {
+		var options GroupOptions
+		if err := json.Unmarshal(fc.GroupDefaults, &options); err != nil {
+			return nil, fmt.Errorf("Invalid group_defaults: %v", err)
+		}
+		if len(group.Options) > 0 {
+			if err := json.Unmarshal(group.Options, &options); err != nil {
+				return nil, err
+			}
+		}
+		fc.Groups[i].Options = options
+	}
+	return fc, nil
+}
+
+// BuildConfiguration validates fc and builds the runtime configuration
+// from it. Team tokens are not checked against Slack.
+func BuildConfiguration(fc *FileConfig, errs *ConfigErrors) (*Configuration, error) {
+	settings := fc.Settings
+	if settings.Workers < 1 || settings.QueueSize < 0 {
+		err := fmt.Errorf("Invalid queue settings: %v workers, queue size %v", settings.Workers, settings.QueueSize)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		defaults := DefaultSettings()
+		settings.Workers, settings.QueueSize = defaults.Workers, defaults.QueueSize
+	}
+	switch settings.DedupeScope {
+	case dedupeGlobal, dedupeDestination:
+	default:
+		err := fmt.Errorf("Invalid dedupe_scope %q", settings.DedupeScope)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.DedupeScope = DefaultSettings().DedupeScope
+	}
+	switch settings.DuplicateChannels {
+	case duplicatesReject, duplicatesDedupe:
+	default:
+		err := fmt.Errorf("Invalid duplicate_channels %q", settings.DuplicateChannels)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.DuplicateChannels = DefaultSettings().DuplicateChannels
+	}
+	switch settings.TokenCheck {
+	case tokenCheckFail, tokenCheckWarn, tokenCheckOff:
+	default:
+		err := fmt.Errorf("Invalid token_check %q", settings.TokenCheck)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.TokenCheck = DefaultSettings().TokenCheck
+	}
+	if settings.CaptureRate < 0 || settings.CaptureRate > 1 {
+		err := fmt.Errorf("Invalid capture_rate %v, must be between 0 and 1", settings.CaptureRate)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.CaptureRate = 0
+	}
+	if settings.AuditBuffer < 1 {
+		err := fmt.Errorf("Invalid audit_buffer %v, must be at least 1", settings.AuditBuffer)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.AuditBuffer = DefaultSettings().AuditBuffer
+	}
+	if settings.WarmupConcurrency < 1 {
+		err := fmt.Errorf("Invalid warmup_concurrency %v, must be at least 1", settings.WarmupConcurrency)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.WarmupConcurrency = DefaultSettings().WarmupConcurrency
+	}
+	switch settings.BotMentions {
+	case botMentionsCommand, botMentionsForward, botMentionsDrop:
+	default:
+		err := fmt.Errorf("Invalid bot_mentions %q", settings.BotMentions)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.BotMentions = DefaultSettings().BotMentions
+	}
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		if err := errs.Skip(fmt.Errorf("Invalid timezone %q: %v", settings.Timezone, err)); err != nil {
+			return nil, err
+		}
+		settings.Timezone, location = "UTC", time.UTC
+	}
+	if err := validateColor(settings.DefaultColor); err != nil {
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.DefaultColor = ""
+	}
+	if settings.FanoutTimeout.Duration <= 0 {
+		err := fmt.Errorf("Invalid fan-out timeout %v", settings.FanoutTimeout.Duration)
+		if err := errs.Skip(err); err != nil {
+			return nil, err
+		}
+		settings.FanoutTimeout = DefaultSettings().FanoutTimeout
+	}
+
+	teams := make(map[string]*Team, len(fc.Teams))
+	for _, tc := range fc.Teams {
+		id, err := normalizeId(tc.Id, teamIdPrefixes, "team")
+		if err != nil {
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, list := range []StringList{tc.Options.AllowChannels, tc.Options.DenyChannels} {
+			for i := range list {
+				if list[i], err = normalizeId(list[i], channelIdPrefixes, "channel"); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = validateColor(tc.Options.Color)
+		}
+		teamLocation := location
+		if err == nil && tc.Options.Timezone != "" {
+			teamLocation, err = time.LoadLocation(tc.Options.Timezone)
+		}
+		if err != nil {
+			// The whole team is skipped rather than the bad option, as a
+			// mistyped channel list entry could let a sensitive channel
+			// through.
+			if err := errs.Skip(fmt.Errorf("Team %v: %v", id, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		team := NewTeam(id, tc.APIToken, tc.IncomingToken)
+		team.Options = tc.Options
+		team.SigningSecrets, team.EventsToken = tc.SigningSecrets, tc.EventsToken
+		team.location = teamLocation
+		if tc.Options.Concurrency > 0 {
+			team.SetConcurrency(tc.Options.Concurrency)
+		} else {
+			team.SetConcurrency(settings.TeamConcurrency)
+		}
+		teams[id] = team
+	}
+
+	// parseChannel parses a channel reference, checking its team exists.
+	parseChannel := func(channel_str string, what string) (Channel, error) {
+		channel, err := ParseChannel(channel_str)
+		if err != nil {
+			return channel, err
+		}
+		if _, present := teams[channel.TeamId]; !present {
+			return channel, fmt.Errorf("%v %v belongs to unknown team %v", what, channel, channel.TeamId)
+		}
+		return channel, nil
+	}
+
+	channelMap := make(map[Channel]*Group, len(fc.Groups)*3)
+	for _, gc := range fc.Groups {
+		group, err := NewGroup(make([]Channel, 0, len(gc.Channels)), gc.Options)
+		if err != nil {
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for _, channel_str := range gc.Channels {
+			channel, err := parseChannel(channel_str, "Channel")
+			if err == nil {
+				existing, present := channelMap[channel]
+				switch {
+				case present && existing == group && settings.DuplicateChannels == duplicatesDedupe:
+					log.Printf("Warning: ignoring repeated channel %v in its group", channel)
+					continue
+				case present && existing == group:
+					err = fmt.Errorf("Channel %v is listed more than once in its group", channel)
+				case present:
+					err = fmt.Errorf("%s already present in channel map configuration.", channel_str)
+				case !teams[channel.TeamId].Options.Permits(channel.ChannelId):
+					err = fmt.Errorf("Channel %v is not permitted by the channel lists of team %v", channel, channel.TeamId)
+				}
+			}
+			if err != nil {
+				if err := errs.Skip(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			group.Channels = append(group.Channels, channel)
+			channelMap[channel] = group
+		}
+	}
+
+	// Slack Connect channels are found by ID across teams.
+	channelsById := make(map[string][]Channel, len(channelMap))
+	for channel := range channelMap {
+		channelsById[channel.ChannelId] = append(channelsById[channel.ChannelId], channel)
+	}
+
+	outboundTokens := make(map[Channel]Credentials, len(fc.OutboundTokens))
+	for channel_str, token := range fc.OutboundTokens {
+		channel, err := parseChannel(channel_str, "Outbound token channel")
+		if err != nil {
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		outboundTokens[channel] = token
+	}
+
+	destinations := make(map[Channel]DestinationOptions, len(fc.Destinations))
+	for channel_str, options := range fc.Destinations {
+		channel, err := parseChannel(channel_str, "Destination")
+		if err == nil {
+			switch options.FileMode {
+			case "":
+				options.FileMode = fileModeUpload
+			case fileModeUpload, fileModePublicLink, fileModeLink:
+			default:
+				err = fmt.Errorf("Invalid file_mode %q for %v", options.FileMode, channel_str)
+			}
+		}
+		if err == nil {
+			switch options.ThreadMode {
+			case "":
+				options.ThreadMode = threadMirror
+			case threadMirror, threadFlatten, threadCollect:
+			default:
+				err = fmt.Errorf("Invalid thread_mode %q for %v", options.ThreadMode, channel_str)
+			}
+		}
+		if err == nil {
+			if _, pipelineErr := compilePipeline(options.Pipeline); pipelineErr != nil {
+				err = fmt.Errorf("%v for %v", pipelineErr, channel_str)
+			}
+		}
+		if err != nil {
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		destinations[channel] = options
+	}
+
+	routes := make([]route, 0, len(fc.Routes))
+	for _, rc := range fc.Routes {
+		r, err := buildRoute(rc, channelMap)
+		if err == nil {
+			if _, present := teams[r.teamId]; !present {
+				err = fmt.Errorf("Route for unknown team %v", r.teamId)
+			}
+		}
+		if err != nil {
+			if err := errs.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		routes = append(routes, r)
+	}
+
+	return &Configuration{teams, channelMap, channelsById, outboundTokens, destinations, settings, routes}, nil
+}
+
+// FileConfig converts the configuration back to its structured form, with
+// teams and groups in a stable order.
+func (c *Configuration) FileConfig() *FileConfig {
+	fc := &FileConfig{
+		OutboundTokens: make(map[string]Credentials, len(c.outboundTokens)),
+		Settings:       c.settings,
+	}
+
+	for _, team := range c.teams {
+		fc.Teams = append(fc.Teams, TeamConfig{team.Id, team.APIToken, team.IncomingToken, team.Options, team.SigningSecrets, team.EventsToken})
+	}
+	sort.Slice(fc.Teams, func(i, j int) bool { return fc.Teams[i].Id < fc.Teams[j].Id })
+
+	seen := make(map[*Group]bool)
+	for _, group := range c.channelMap {
+		if seen[group] {
+			continue
+		}
+		seen[group] = true
+		gc := GroupConfig{Options: group.Options}
+		for _, channel := range group.Channels {
+			gc.Channels = append(gc.Channels, channel.String())
+		}
+		fc.Groups = append(fc.Groups, gc)
+	}
+	sort.Slice(fc.Groups, func(i, j int) bool { return fc.Groups[i].Channels[0] < fc.Groups[j].Channels[0] })
+
+	for _, r := range c.routes {
+		fc.Routes = append(fc.Routes, r.RouteConfig)
+	}
+
+	for channel, token := range c.outboundTokens {
+		fc.OutboundTokens[channel.String()] = token
+	}
+
+	if len(c.destinations) > 0 {
+		fc.Destinations = make(map[string]DestinationOptions, len(c.destinations))
+		for channel, options := range c.destinations {
+			fc.Destinations[channel.String()] = options
+		}
+	}
+	return fc
+}
+
+// Equivalent reports whether two configurations describe the same teams,
+// groups, tokens and settings.
+func (c *Configuration) Equivalent(other *Configuration) bool {
+	a, _ := json.Marshal(c.FileConfig())
+	b, _ := json.Marshal(other.FileConfig())
+	return string(a) == string(b)
+}
+
+// GetConfiguration returns the configuration source selected by the
+// environment and its initial configuration: SLACKLINE_CONFIG when set,
+// and the legacy environment variables otherwise.
+// SLACKLINE_STARTUP_MODE=lenient skips invalid entries instead of failing
+// to start.
+func GetConfiguration() (*Configuration, ConfigSource) {
+	var lenient bool
+	switch mode := os.Getenv("SLACKLINE_STARTUP_MODE"); mode {
+	case "", "strict":
+	case "lenient":
+		lenient = true
+	default:
+		log.Fatalf("Invalid SLACKLINE_STARTUP_MODE %q, expected strict or lenient", mode)
+	}
+
+	var source ConfigSource = envSource{lenient}
+	if path := os.Getenv("SLACKLINE_CONFIG"); path != "" {
+		source = &fileSource{path: path, lenient: lenient}
+	}
+
+	c, err := source.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c, source
+}
+
+// MigrateConfig writes the legacy environment configuration to w in the
+// structured format, after checking it parses back to the same
+// configuration.
+func MigrateConfig(w io.Writer) error {
+	fc, err := LegacyConfig(nil)
+	if err != nil {
+		return err
+	}
+	original, err := BuildConfiguration(fc, nil)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(original.FileConfig(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parseFileConfig(content)
+	if err != nil {
+		return err
+	}
+	migrated, err := BuildConfiguration(parsed, nil)
+	if err != nil {
+		return err
+	}
+	if !original.Equivalent(migrated) {
+		return fmt.Errorf("Migrated configuration does not match the original")
+	}
+
+	_, err = w.Write(append(content, '\n'))
+	return err
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var legacyVariables = []string{
+	"SLACKLINE_TEAMS", "SLACKLINE_CHANNEL_MAP", "SLACKLINE_OUTBOUND_TOKENS",
+	"SLACKLINE_GROUP_DEFAULTS", "SLACKLINE_GROUP_OPTIONS", "SLACKLINE_TEAM_OPTIONS",
+	"SLACKLINE_DESTINATION_OPTIONS", "SLACKLINE_SETTINGS",
+}
+
+func TestMigrateConfig(t *testing.T) {
+	teams := teamA + ":xoxb-a:hook-a," + teamB + ":xoxb-b:hook-b"
+	channels := teamA + "/" + chanA + ":" + teamB + "/" + chanB
+	tokens := teamA + "/" + chanA + ":out-a," + teamB + "/" + chanB + ":old@2030-01-01T00:00:00Z|new"
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"topology", map[string]string{
+			"SLACKLINE_TEAMS":           teams,
+			"SLACKLINE_CHANNEL_MAP":     channels,
+			"SLACKLINE_OUTBOUND_TOKENS": tokens,
+		}, false},
+		{"options", map[string]string{
+			"SLACKLINE_TEAMS":               teams,
+			"SLACKLINE_CHANNEL_MAP":         channels,
+			"SLACKLINE_OUTBOUND_TOKENS":     tokens,
+			"SLACKLINE_GROUP_DEFAULTS":      "threads=true",
+			"SLACKLINE_GROUP_OPTIONS":       teamA + "/" + chanA + ":flatten_attachments=true",
+			"SLACKLINE_DESTINATION_OPTIONS": teamB + "/" + chanB + ":thread_mode=flatten",
+			"SLACKLINE_SETTINGS":            "workers=8",
+		}, false},
+		{"invalid team", map[string]string{
+			"SLACKLINE_TEAMS": teamA + ":xoxb-a",
+		}, true},
+		{"unmapped group options", map[string]string{
+			"SLACKLINE_TEAMS":         teams,
+			"SLACKLINE_GROUP_OPTIONS": teamA + "/" + chanC + ":threads=true",
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range legacyVariables {
+				t.Setenv(name, test.env[name])
+			}
+			var out bytes.Buffer
+			err := MigrateConfig(&out)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("MigrateConfig succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MigrateConfig: %v", err)
+			}
+
+			legacy, err := LegacyConfig(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			original, err := BuildConfiguration(legacy, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := parseFileConfig(out.Bytes())
+			if err != nil {
+				t.Fatalf("Migrated configuration doesn't parse: %v\n%s", err, out.Bytes())
+			}
+			migrated, err := BuildConfiguration(parsed, nil)
+			if err != nil {
+				t.Fatalf("Migrated configuration doesn't build: %v", err)
+			}
+			if !original.Equivalent(migrated) {
+				t.Errorf("Migrated configuration differs:\n%s", out.Bytes())
+			}
+			group := migrated.channelMap[Channel{teamA, chanA}]
+			if group == nil || len(group.Channels) != 2 || migrated.channelMap[Channel{teamB, chanB}] != group {
+				t.Errorf("Migrated group = %+v, want %v and %v bridged", group, chanA, chanB)
+			}
+		})
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Channel
+		wantErr bool
+	}{
+		{teamA + "/" + chanA, Channel{teamA, chanA}, false},
+		{teamA + "/U0000000A", Channel{teamA, "U0000000A"}, false},
+		{teamA, Channel{}, true},
+		{teamA + "/" + chanA + "/x", Channel{}, true},
+		{"X0000000A/" + chanA, Channel{}, true},
+		{teamA + "/C1", Channel{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseChannel(test.in)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("ParseChannel(%q) = %v, %v; want %v, error %v", test.in, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestStartupMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		lenient bool
+		wantErr bool
+		wantIn  []Channel
+		wantOut []Channel
+	}{
+		{"strict invalid team", map[string]string{
+			"SLACKLINE_TEAMS":       teamA + ":xoxb-a:hook-a," + teamB + ":xoxb-b",
+			"SLACKLINE_CHANNEL_MAP": teamA + "/" + chanA + ":" + teamA + "/" + chanC,
+		}, false, true, nil, nil},
+		{"lenient invalid team", map[string]string{
+			"SLACKLINE_TEAMS":       teamA + ":xoxb-a:hook-a," + teamB + ":xoxb-b",
+			"SLACKLINE_CHANNEL_MAP": teamA + "/" + chanA + ":" + teamA + "/" + chanC,
+		}, true, false, []Channel{{teamA, chanA}, {teamA, chanC}}, nil},
+		{"strict unknown team", map[string]string{
+			"SLACKLINE_TEAMS":       teamA + ":xoxb-a:hook-a",
+			"SLACKLINE_CHANNEL_MAP": teamA + "/" + chanA + ":" + teamA + "/" + chanC + "," + teamA + "/" + chanB + ":" + teamB + "/" + chanB,
+		}, false, true, nil, nil},
+		{"lenient unknown team", map[string]string{
+			"SLACKLINE_TEAMS":       teamA + ":xoxb-a:hook-a",
+			"SLACKLINE_CHANNEL_MAP": teamA + "/" + chanA + ":" + teamA + "/" + chanC + "," + teamA + "/" + chanB + ":" + teamB + "/" + chanB,
+		}, true, false, []Channel{{teamA, chanA}, {teamA, chanC}}, []Channel{{teamB, chanB}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range legacyVariables {
+				t.Setenv(name, test.env[name])
+			}
+			errs := &ConfigErrors{Lenient: test.lenient}
+			fc, err := LegacyConfig(errs)
+			var c *Configuration
+			if err == nil {
+				c, err = BuildConfiguration(fc, errs)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Invalid entry accepted in strict mode")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lenient mode failed: %v", err)
+			}
+			if len(errs.Skipped) != 1 {
+				t.Errorf("Skipped %v, want the invalid entry", errs.Skipped)
+			}
+			for _, channel := range test.wantIn {
+				if c.channelMap[channel] == nil {
+					t.Errorf("Channel %v was dropped", channel)
+				}
+			}
+			for _, channel := range test.wantOut {
+				if c.channelMap[channel] != nil {
+					t.Errorf("Channel %v was kept", channel)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{" ", 0},
+		{"a", 1},
+		{"a,b", 2},
+		{"a,,b,", 2},
+	}
+	for _, test := range tests {
+		if got := splitList(test.in); len(got) != test.want {
+			t.Errorf("splitList(%q) = %q, want %d entries", test.in, got, test.want)
+		}
+	}
+}
+
+func TestEmptyEnvironment(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"unset", ""},
+		{"only commas", ","},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range legacyVariables {
+				t.Setenv(name, "")
+			}
+			for _, name := range []string{"SLACKLINE_TEAMS", "SLACKLINE_CHANNEL_MAP", "SLACKLINE_OUTBOUND_TOKENS"} {
+				t.Setenv(name, test.value)
+			}
+			c, err := envSource{}.Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if len(c.teams) != 0 || len(c.channelMap) != 0 || len(c.outboundTokens) != 0 {
+				t.Errorf("Loaded %+v, want an empty configuration", c)
+			}
+		})
+	}
+}
+
+func TestGroupDefaults(t *testing.T) {
+	defaults := `{"threads": true, "max_length": 100, "reaction_actions": {"pushpin": "pin"}, "pipeline": ["dates", "truncate"]}`
+	tests := []struct {
+		name          string
+		options       string
+		wantThreads   bool
+		wantMaxLength int
+		wantActions   map[string]string
+		wantPipeline  int
+		wantErr       bool
+	}{
+		{"inherited", `{}`, true, 100, map[string]string{"pushpin": "pin"}, 2, false},
+		{"no options", ``, true, 100, map[string]string{"pushpin": "pin"}, 2, false},
+		{"one field overridden", `{"max_length": 50}`, true, 50, map[string]string{"pushpin": "pin"}, 2, false},
+		{"overridden with the zero value", `{"threads": false}`, false, 100, map[string]string{"pushpin": "pin"}, 2, false},
+		{"maps merged", `{"reaction_actions": {"no_entry_sign": "delete"}}`, true, 100,
+			map[string]string{"pushpin": "pin", "no_entry_sign": "delete"}, 2, false},
+		{"lists replaced", `{"pipeline": ["template"]}`, true, 100, map[string]string{"pushpin": "pin"}, 1, false},
+		{"invalid options", `{"max_length": "long"}`, false, 0, nil, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			group := `{"channels": ["` + teamA + "/" + chanA + `", "` + teamB + "/" + chanB + `"]}`
+			if test.options != "" {
+				group = `{"channels": ["` + teamA + "/" + chanA + `", "` + teamB + "/" + chanB + `"], "options": ` + test.options + `}`
+			}
+			fc, err := parseFileConfig([]byte(`{"group_defaults": ` + defaults + `, "groups": [` + group + `, {"channels": []}]}`))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseFileConfig succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options := fc.Groups[0].Options
+			if options.Threads != test.wantThreads || options.MaxLength != test.wantMaxLength || len(options.Pipeline) != test.wantPipeline {
+				t.Errorf("Got threads %v, max length %v and pipeline %v, want %v, %v and %d transforms",
+					options.Threads, options.MaxLength, options.Pipeline, test.wantThreads, test.wantMaxLength, test.wantPipeline)
+			}
+			if !reflect.DeepEqual(options.ReactionActions, test.wantActions) {
+				t.Errorf("Got reaction actions %v, want %v", options.ReactionActions, test.wantActions)
+			}
+			// Defaults are decoded afresh for each group.
+			if other := fc.Groups[1].Options; !other.Threads || len(other.ReactionActions) != 1 {
+				t.Errorf("Second group got %+v, want only the defaults", other)
+			}
+		})
+	}
+}
+
+func TestDuplicateChannels(t *testing.T) {
+	a, b, c := teamA+"/"+chanA, teamB+"/"+chanB, teamA+"/"+chanC
+	tests := []struct {
+		name      string
+		policy    string
+		groups    string
+		wantErr   bool
+		wantPeers int
+	}{
+		{"distinct", "reject", `[{"channels": ["` + a + `", "` + b + `"]}]`, false, 1},
+		{"rejected", "reject", `[{"channels": ["` + a + `", "` + b + `", "` + a + `"]}]`, true, 0},
+		{"deduped", "dedupe", `[{"channels": ["` + a + `", "` + b + `", "` + a + `"]}]`, false, 1},
+		{"deduped keeps the other channels", "dedupe", `[{"channels": ["` + a + `", "` + a + `", "` + b + `", "` + c + `"]}]`, false, 2},
+		{"across groups", "dedupe", `[{"channels": ["` + a + `", "` + b + `"]}, {"channels": ["` + c + `", "` + a + `"]}]`, true, 0},
+		{"invalid policy", "merge", `[{"channels": ["` + a + `", "` + b + `"]}]`, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fc, err := parseFileConfig([]byte(`{
+				"teams": [
+					{"id": "` + teamA + `", "api_token": "xoxb-a", "incoming_token": "hook-a"},
+					{"id": "` + teamB + `", "api_token": "xoxb-b", "incoming_token": "hook-b"}
+				],
+				"groups": ` + test.groups + `,
+				"settings": {"duplicate_channels": "` + test.policy + `"}
+			}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			built, err := BuildConfiguration(fc, nil)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("BuildConfiguration() = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			group := built.channelMap[Channel{teamA, chanA}]
+			peers := 0
+			for _, channel := range group.Channels {
+				if channel != (Channel{teamA, chanA}) {
+					peers++
+				}
+			}
+			if peers != test.wantPeers || len(group.Channels) != test.wantPeers+1 {
+				t.Errorf("Group has channels %v, want %v once with %d peers", group.Channels, a, test.wantPeers)
+			}
+		})
+	}
+}
+
+func TestTokenCheckPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{tokenCheckFail, false},
+		{tokenCheckWarn, false},
+		{tokenCheckOff, false},
+		{"retry", true},
+	}
+	for _, test := range tests {
+		fc, err := parseFileConfig([]byte(testConfig("", `"settings": {"token_check": "`+test.policy+`"}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := BuildConfiguration(fc, nil); (err != nil) != test.wantErr {
+			t.Errorf("BuildConfiguration() with token_check %q = %v, want error %v", test.policy, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// ConfirmForwards tells the message's author which channels it was
+// mirrored to.
+func (msg *slackMessage) ConfirmForwards(ctx context.Context, forwarded []Channel) {
+	if msg.UserId == "" {
+		return
+	}
+
+	names := make([]string, len(forwarded))
+	for i, c := range forwarded {
+		names[i] = c.String()
+	}
+	text := "Your message was mirrored to " + strings.Join(names, ", ")
+
+	if err := msg.GetTeam().PostEphemeral(ctx, msg.ChannelId, msg.UserId, text); err != nil {
+		log.Printf("Unable to confirm forward to %v: %v", msg.UserId, err)
+	}
+}
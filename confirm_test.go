@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfirmForwards(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		user    string
+		fail    bool
+		want    bool
+	}{
+		{"confirmed", `{"confirm_forwards": true}`, "U0000000A", false, true},
+		{"disabled", "", "U0000000A", false, false},
+		{"no author", `{"confirm_forwards": true}`, "", false, false},
+		{"nothing forwarded", `{"confirm_forwards": true}`, "U0000000A", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			if test.fail {
+				slack.Fail("webhook", 500)
+			}
+			useConfig(t, testConfig(test.options))
+
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", UserId: test.user, Text: "hi", Timestamp: "1.000"})
+
+			calls := slack.Calls("chat.postEphemeral")
+			if !test.want {
+				if len(calls) != 0 {
+					t.Errorf("Sent %d confirmations, want none", len(calls))
+				}
+				return
+			}
+			if len(calls) != 1 {
+				t.Fatalf("Sent %d confirmations, want 1", len(calls))
+			}
+			call := calls[0]
+			if call.Get("channel") != chanA || call.Get("user") != test.user || call.Get("token") != "xoxb-a" {
+				t.Errorf("Confirmation sent to %v", call.Form)
+			}
+			if !strings.Contains(call.Get("text"), teamB+"/"+chanB) {
+				t.Errorf("Confirmation %q doesn't list the destination", call.Get("text"))
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slack date tokens look like <!date^TIMESTAMP^FORMAT^LINK|FALLBACK>, where
+// the link and fallback are optional.
+var dateRegexp = regexp.MustCompile(`<!date\^(\d+)\^([^^|>]*)(?:\^[^|>]*)?(?:\|([^>]*))?>`)
+
+// RewriteDates replaces date tokens with their fallback text, or with the
+// date rendered according to the token's format when there is none, in
+// the source team's timezone.
+func (msg *slackMessage) RewriteDates() {
+	msg.Text = dateRegexp.ReplaceAllStringFunc(msg.Text, func(s string) string {
+		match := dateRegexp.FindStringSubmatch(s)
+		if match[3] != "" {
+			return match[3]
+		}
+		seconds, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return s
+		}
+		return formatSlackDate(time.Unix(seconds, 0).In(msg.GetTeam().Location()), match[2])
+	})
+}
+
+func ordinal(day int) string {
+	suffix := "th"
+	switch {
+	case day/10 == 1:
+	case day%10 == 1:
+		suffix = "st"
+	case day%10 == 2:
+		suffix = "nd"
+	case day%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(day) + suffix
+}
+
+// formatSlackDate expands the tokens understood by Slack's date formatting,
+// such as {date_num} and {time}, in format.
+func formatSlackDate(t time.Time, format string) string {
+	date := fmt.Sprintf("%v %v, %v", t.Month(), ordinal(t.Day()), t.Year())
+	dateShort := t.Format("Jan 2, 2006")
+	dateLong := t.Weekday().String() + ", " + date
+
+	pretty := func(fallback string) string {
+		today := now().In(t.Location())
+		switch {
+		case sameDay(t, today):
+			return "today"
+		case sameDay(t, today.AddDate(0, 0, -1)):
+			return "yesterday"
+		case sameDay(t, today.AddDate(0, 0, 1)):
+			return "tomorrow"
+		}
+		return fallback
+	}
+
+	return strings.NewReplacer(
+		"{date_num}", t.Format("2006-01-02"),
+		"{date_short_pretty}", pretty(dateShort),
+		"{date_long_pretty}", pretty(dateLong),
+		"{date_pretty}", pretty(date),
+		"{date_short}", dateShort,
+		"{date_long}", dateLong,
+		"{date}", date,
+		"{time_secs}", t.Format("3:04:05 PM"),
+		"{time}", t.Format("3:04 PM"),
+	).Replace(format)
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRewriteDates(t *testing.T) {
+	// 1488369600 is 12:00 UTC on March 1st 2017, the fake clock's time.
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"fallback", "Due <!date^1488369600^{date_short}|Mar 1st>", "Due Mar 1st"},
+		{"fallback with link", "<!date^1488369600^{date}^https://example.com|the 1st>", "the 1st"},
+		{"no fallback", "Due <!date^1488369600^{date_short} at {time}>", "Due Mar 1, 2017 at 12:00 PM"},
+		{"long", "<!date^1488369600^{date_long}>", "Wednesday, March 1st, 2017"},
+		{"numeric", "<!date^1488369600^{date_num} {time_secs}>", "2017-03-01 12:00:00 PM"},
+		{"pretty today", "<!date^1488369600^{date_pretty}>", "today"},
+		{"pretty yesterday", "<!date^1488283200^{date_short_pretty}>", "yesterday"},
+		{"pretty other day", "<!date^1487865600^{date_pretty}>", "February 23rd, 2017"},
+		{"several", "<!date^1488369600^{date_num}> to <!date^1488456000^{date_num}>", "2017-03-01 to 2017-03-02"},
+		{"plain text", "No dates <!here>", "No dates <!here>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeClock(t)
+			useConfig(t, testConfig(""))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: test.text}
+			msg.RewriteDates()
+			if msg.Text != test.want {
+				t.Errorf("RewriteDates(%q) = %q, want %q", test.text, msg.Text, test.want)
+			}
+		})
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	tests := map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 22: "22nd", 31: "31st"}
+	for day, want := range tests {
+		if got := ordinal(day); got != want {
+			t.Errorf("ordinal(%d) = %q, want %q", day, got, want)
+		}
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		team     string
+		want     string
+		wantErr  bool
+	}{
+		{"utc by default", `{}`, `{}`, "12:00 PM", false},
+		{"default timezone", `{"timezone": "America/New_York"}`, `{}`, "7:00 AM", false},
+		{"team timezone", `{"timezone": "America/New_York"}`, `{"timezone": "Asia/Tokyo"}`, "9:00 PM", false},
+		{"invalid default", `{"timezone": "Mars/Olympus_Mons"}`, `{}`, "", true},
+		{"invalid team timezone", `{}`, `{"timezone": "Nowhere"}`, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeClock(t)
+			content := withTeamOptions(testConfig("", `"settings": `+test.settings), test.team)
+			fc, err := parseFileConfig([]byte(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := BuildConfiguration(fc, &ConfigErrors{}); (err != nil) != test.wantErr {
+				t.Fatalf("BuildConfiguration = %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			useConfig(t, content)
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: "<!date^1488369600^{time}>"}
+			msg.RewriteDates()
+			if msg.Text != test.want {
+				t.Errorf("Rendered %q, want %q", msg.Text, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeadLetter is a message that failed every attempt to post it to one
+// destination.
+type DeadLetter struct {
+	Id          int64     `json:"id"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Text        string    `json:"text"`
+	Error       string    `json:"error"`
+	FailedAt    time.Time `json:"failed_at"`
+
+	dest Channel
+	msg  slackMessage
+}
+
+// deadLetterQueue keeps the most recent DeadLetterSize dead letters in
+// memory for inspection and replay, optionally also appending them to
+// DeadLetterFile as JSON lines.
+type deadLetterQueue struct {
+	sync.Mutex
+	next    int64
+	letters []*DeadLetter
+}
+
+var deadLetters = &deadLetterQueue{}
+
+func (q *deadLetterQueue) Add(dest Channel, msg slackMessage, err error) {
+	size := config().settings.DeadLetterSize
+	if size <= 0 {
+		return
+	}
+
+	q.Lock()
+	q.next++
+	letter := &DeadLetter{
+		Id:          q.next,
+		Source:      msg.Channel.String(),
+		Destination: dest.String(),
+		Text:        msg.Text,
+		Error:       err.Error(),
+		FailedAt:    now(),
+		dest:        dest,
+		msg:         msg,
+	}
+	q.letters = append(q.letters, letter)
+	if len(q.letters) > size {
+		q.letters = q.letters[len(q.letters)-size:]
+	}
+	q.Unlock()
+
+	if path := config().settings.DeadLetterFile; path != "" {
+		if err := appendDeadLetter(path, letter); err != nil {
+			log.Printf("Unable to write dead letter %v to %v: %v", letter.Id, path, err)
+		}
+	}
+}
+
+func appendDeadLetter(path string, letter *DeadLetter) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(letter)
+}
+
+// List returns the dead letters, oldest first.
+func (q *deadLetterQueue) List() []DeadLetter {
+	q.Lock()
+	defer q.Unlock()
+
+	list := make([]DeadLetter, len(q.letters))
+	for i, letter := range q.letters {
+		list[i] = *letter
+	}
+	return list
+}
+
+// Take removes and returns dead letter id.
+func (q *deadLetterQueue) Take(id int64) (*DeadLetter, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for i, letter := range q.letters {
+		if letter.Id == id {
+			q.letters = append(q.letters[:i], q.letters[i+1:]...)
+			return letter, true
+		}
+	}
+	return nil, false
+}
+
+func deadLettersHandler(c *gin.Context) {
+	c.JSON(200, deadLetters.List())
+}
+
+// replayHandler posts a dead letter to its destination again. The message
+// was already transformed, so it isn't bridged again; if the post fails it
+// goes back on the queue under a new ID.
+func replayHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid dead letter ID"})
+		return
+	}
+	letter, ok := deadLetters.Take(id)
+	if !ok {
+		c.JSON(404, gin.H{"error": "No such dead letter"})
+		return
+	}
+
+	msg := letter.msg
+	msg.Replay = true
+	if err := letter.dest.Deliver(c.Request.Context(), msg); err != nil && err != errBatched {
+		c.JSON(502, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"replayed": letter.Id})
+}
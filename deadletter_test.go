@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeadLetters(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		retries     int
+		messages    int
+		wantPosts   int
+		wantLetters []int64
+	}{
+		{"delivered", 0, 1, 1, 1, nil},
+		{"failed", 500, 0, 1, 1, []int64{1}},
+		{"failed every retry", 500, 2, 1, 3, []int64{1}},
+		{"bounded", 500, 0, 3, 3, []int64{2, 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", fmt.Sprintf(`"settings": {"post_retries": %d, "retry_delay": "1ms", "dead_letter_size": 2}`, test.retries)))
+			slack.Fail("webhook", test.status)
+			dest := Channel{teamB, chanB}
+
+			for i := 0; i < test.messages; i++ {
+				msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: fmt.Sprint("message ", i)}
+				dest.deliverNow(testContext(t), msg)
+			}
+
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Made %d posts, want %d", posts, test.wantPosts)
+			}
+			letters := deadLetters.List()
+			if len(letters) != len(test.wantLetters) {
+				t.Fatalf("Got dead letters %+v, want IDs %v", letters, test.wantLetters)
+			}
+			for i, letter := range letters {
+				if letter.Id != test.wantLetters[i] || letter.Destination != dest.String() || letter.Error == "" {
+					t.Errorf("Dead letter %d = %+v, want ID %v for %v with its error", i, letter, test.wantLetters[i], dest)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		status      int
+		wantCode    int
+		wantLetters int
+	}{
+		{"replayed", "1", 0, 200, 0},
+		{"failed again", "1", 500, 502, 1},
+		{"unknown", "2", 0, 404, 1},
+		{"invalid", "x", 0, 400, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": {"dead_letter_size": 10}`))
+			slack.Fail("webhook", 500)
+			dest := Channel{teamB, chanB}
+			dest.deliverNow(testContext(t), slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "lost"})
+
+			slack.Fail("webhook", test.status)
+			req := httptest.NewRequest("POST", "/dead-letters/"+test.id+"/replay", nil)
+			w := serveRequest(replayHandler, "/dead-letters/:id/replay", req)
+			if w.Code != test.wantCode {
+				t.Errorf("replayHandler returned %v, want %v", w.Code, test.wantCode)
+			}
+			if letters := deadLetters.List(); len(letters) != test.wantLetters {
+				t.Errorf("Got %d dead letters, want %d", len(letters), test.wantLetters)
+			}
+			if test.wantCode == 200 {
+				if posts := slack.Posts(); len(posts) != 2 || posts[1].Get("text") != "lost" {
+					t.Errorf("Replay posted %+v, want the message again", posts)
+				}
+			}
+		})
+	}
+}
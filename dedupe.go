@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// seenMessages serializes checking the store for each message's dedupe
+// keys, which record that it was delivered until the dedupe window has
+// passed, so retries and re-deliveries of the same message are only
+// forwarded once. With a store_path the keys survive restarts.
+var seenMessages sync.Mutex
+
+// DedupeKeys identifies the message by its client_msg_id when it has one,
+// and by a hash of its channel, author and timestamp.
+func (msg *slackMessage) DedupeKeys() []string {
+	var keys []string
+	if msg.ClientMsgId != "" {
+		keys = append(keys, "client:"+msg.ClientMsgId)
+	}
+	if msg.Timestamp != "" {
+		sum := sha256.Sum256([]byte(msg.TeamId + "/" + msg.ChannelId + "/" + msg.UserId + "/" + msg.Timestamp))
+		keys = append(keys, "ts:"+hex.EncodeToString(sum[:]))
+	}
+	return keys
+}
+
+const (
+	dedupeGlobal      = "global"
+	dedupeDestination = "destination"
+)
+
+// FirstDelivery reports whether the message hasn't been seen within the
+// dedupe window, marking it as seen.
+func (msg *slackMessage) FirstDelivery() bool {
+	return firstDelivery(msg.DedupeKeys())
+}
+
+// FirstDeliveryTo is like FirstDelivery, but only considers deliveries of
+// the message to dest.
+func (msg *slackMessage) FirstDeliveryTo(dest Channel) bool {
+	keys := msg.DedupeKeys()
+	for i := range keys {
+		keys[i] += ">" + dest.String()
+	}
+	return firstDelivery(keys)
+}
+
+func firstDelivery(keys []string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+
+	seenMessages.Lock()
+	defer seenMessages.Unlock()
+
+	window := config().settings.DedupeWindow.Duration
+	first := true
+	var unseen []string
+	for _, key := range keys {
+		if _, present := store.Get("seen:" + key); present {
+			first = false
+		} else {
+			unseen = append(unseen, key)
+		}
+	}
+	for _, key := range unseen {
+		store.Set("seen:"+key, "", window)
+	}
+	return first
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedupe(t *testing.T) {
+	source := Channel{teamA, chanA}
+	tests := []struct {
+		name      string
+		settings  string
+		first     slackMessage
+		second    slackMessage
+		wait      time.Duration
+		wantPosts int
+	}{
+		{"same client_msg_id", `{}`,
+			slackMessage{ClientMsgId: "m1", Timestamp: "1.000"},
+			slackMessage{ClientMsgId: "m1", Timestamp: "2.000"}, 0, 1},
+		{"same timestamp", `{}`,
+			slackMessage{Timestamp: "1.000"},
+			slackMessage{Timestamp: "1.000"}, 0, 1},
+		{"timestamp after client_msg_id", `{}`,
+			slackMessage{ClientMsgId: "m1", Timestamp: "1.000"},
+			slackMessage{Timestamp: "1.000"}, 0, 1},
+		{"different messages", `{}`,
+			slackMessage{ClientMsgId: "m1", Timestamp: "1.000"},
+			slackMessage{ClientMsgId: "m2", Timestamp: "2.000"}, 0, 2},
+		{"different authors", `{}`,
+			slackMessage{UserId: "U0000000A", Timestamp: "1.000"},
+			slackMessage{UserId: "U0000000B", Timestamp: "1.000"}, 0, 2},
+		{"no keys", `{}`, slackMessage{}, slackMessage{}, 0, 2},
+		{"expired", `{"dedupe_window": "1m"}`,
+			slackMessage{ClientMsgId: "m1", Timestamp: "1.000"},
+			slackMessage{ClientMsgId: "m1", Timestamp: "1.000"}, 2 * time.Minute, 2},
+		{"destination scope", `{"dedupe_scope": "destination"}`,
+			slackMessage{ClientMsgId: "m1", Timestamp: "1.000"},
+			slackMessage{ClientMsgId: "m1", Timestamp: "1.000"}, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			for _, msg := range []slackMessage{test.first, test.second} {
+				msg.Channel, msg.Username, msg.Text = source, "alice", "hi"
+				Bridge(msg)
+				advance(test.wait)
+			}
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
+
+func TestFirstDeliveryTo(t *testing.T) {
+	useConfig(t, testConfig(""))
+	msg := slackMessage{Channel: Channel{teamA, chanA}, ClientMsgId: "m1"}
+	tests := []struct {
+		dest Channel
+		want bool
+	}{
+		{Channel{teamB, chanB}, true},
+		{Channel{teamB, chanB}, false},
+		{Channel{teamA, chanC}, true},
+	}
+	for _, test := range tests {
+		if got := msg.FirstDeliveryTo(test.dest); got != test.want {
+			t.Errorf("FirstDeliveryTo(%v) = %v, want %v", test.dest, got, test.want)
+		}
+	}
+	if !msg.FirstDelivery() {
+		t.Errorf("Deliveries to destinations counted as a global delivery")
+	}
+}
+
+func TestDedupeScope(t *testing.T) {
+	tests := []struct {
+		scope     string
+		wantPosts int
+	}{
+		// A repeat of the message once a channel joins the group only
+		// reaches the new channel with per-destination dedupe.
+		{dedupeGlobal, 1},
+		{dedupeDestination, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.scope, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			content := testConfig("", `"settings": {"dedupe_scope": "`+test.scope+`"}`)
+			useConfig(t, content)
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", ClientMsgId: "m1", Timestamp: "1.000"}
+			Bridge(msg)
+
+			fc, err := parseFileConfig([]byte(withChannel(content, teamB+"/"+chanC)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			grown, err := BuildConfiguration(fc, &ConfigErrors{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			SetConfiguration(grown)
+			Bridge(msg)
+
+			posts := slack.Posts()
+			if len(posts) != test.wantPosts {
+				t.Fatalf("Got %d posts, want %d", len(posts), test.wantPosts)
+			}
+			if len(posts) == 2 && posts[1].Get("channel") != chanC {
+				t.Errorf("Repeat posted to %v, want only the new channel %v", posts[1].Get("channel"), chanC)
+			}
+		})
+	}
+}
+
+func TestDedupeAcrossRestart(t *testing.T) {
+	tests := []struct {
+		name      string
+		storePath bool
+		downtime  time.Duration
+		wantPosts int
+	}{
+		{"persisted", true, time.Minute, 1},
+		{"expired while stopped", true, time.Hour, 2},
+		{"in memory", false, time.Minute, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": {"dedupe_window": "10m"}`))
+			settings := DefaultSettings()
+			if test.storePath {
+				settings.StorePath = filepath.Join(t.TempDir(), "store.json")
+			}
+			if err := SetupStore(settings); err != nil {
+				t.Fatal(err)
+			}
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", ClientMsgId: "m1", Timestamp: "1.000"}
+
+			Bridge(msg)
+			if err := store.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			// Restart, reopening the store.
+			advance(test.downtime)
+			store = newMemoryStore()
+			if err := SetupStore(settings); err != nil {
+				t.Fatal(err)
+			}
+			Bridge(msg)
+			// Write the store now rather than from a timer after the test.
+			if err := store.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+var imChannels = newCache(10000, 0)
+
+// IsUser reports whether the channel is a user, whose messages are posted
+// to their direct message channel.
+func (c Channel) IsUser() bool {
+	return strings.HasPrefix(c.ChannelId, "U") || strings.HasPrefix(c.ChannelId, "W")
+}
+
+// OpenIM returns the ID of the direct message channel with user, opening
+// it with conversations.open the first time.
+func (t *Team) OpenIM(ctx context.Context, user string) (string, error) {
+	key := t.Id + "/" + user
+	if id, present := imChannels.Get(key); present {
+		return id.(string), nil
+	}
+
+	var response struct {
+		Channel struct {
+			Id string `json:"id"`
+		} `json:"channel"`
+	}
+	if err := t.apiCall(ctx, "conversations.open", url.Values{"users": {user}}, &response); err != nil {
+		return "", err
+	}
+
+	imChannels.Set(key, response.Channel.Id)
+	return response.Channel.Id, nil
+}
+
+// Target returns the ID of the Slack channel posts to c go to.
+func (c Channel) Target(ctx context.Context) (string, error) {
+	if c.IsUser() {
+		return c.GetTeam().OpenIM(ctx, c.ChannelId)
+	}
+	return c.ChannelId, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDMDestination(t *testing.T) {
+	tests := []struct {
+		name      string
+		open      string
+		wantPosts int
+	}{
+		{"opened", `{"ok":true,"channel":{"id":"D0000000B"}}`, 2},
+		{"refused", `{"ok":false,"error":"user_not_found"}`, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.open", func(fakeCall) string { return test.open })
+			useConfig(t, withChannel(testConfig(""), teamB+"/U0000000B"))
+
+			for _, ts := range []string{"1.000", "2.000"} {
+				Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "page", Timestamp: ts})
+			}
+
+			var dms []fakeCall
+			for _, call := range slack.Calls("chat.postMessage") {
+				if call.Get("channel") == "D0000000B" {
+					dms = append(dms, call)
+				}
+			}
+			if len(dms) != test.wantPosts {
+				t.Errorf("Got %d posts to the DM, want %d", len(dms), test.wantPosts)
+			}
+			opens := slack.Calls("conversations.open")
+			if len(opens) == 0 || opens[0].Get("users") != "U0000000B" {
+				t.Fatalf("Opened %v, want the user's DM", opens)
+			}
+			if test.wantPosts > 0 && len(opens) != 1 {
+				t.Errorf("Opened the DM %d times, want once", len(opens))
+			}
+		})
+	}
+}
+
+func TestIsUser(t *testing.T) {
+	tests := map[string]bool{"U0000000B": true, "W0000000B": true, chanB: false, "G0000000B": false, "D0000000B": false}
+	for id, want := range tests {
+		if got := (Channel{teamB, id}).IsUser(); got != want {
+			t.Errorf("IsUser(%v) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import "regexp"
+
+var shortcodeRegexp = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+
+// emojiShortcodes maps Slack's standard emoji shortcodes to their unicode
+// characters. It covers the commonly used emoji; shortcodes it doesn't
+// list, including custom emoji, are left as they are.
+var emojiShortcodes = map[string]string{
+	"+1":                         "👍",
+	"-1":                         "👎",
+	"100":                        "💯",
+	"alarm_clock":                "⏰",
+	"angry":                      "😠",
+	"arrow_down":                 "⬇️",
+	"arrow_left":                 "⬅️",
+	"arrow_right":                "➡️",
+	"arrow_up":                   "⬆️",
+	"bangbang":                   "‼️",
+	"beers":                      "🍻",
+	"bell":                       "🔔",
+	"blush":                      "😊",
+	"bomb":                       "💣",
+	"book":                       "📖",
+	"bug":                        "🐛",
+	"bulb":                       "💡",
+	"cake":                       "🍰",
+	"calendar":                   "📆",
+	"cat":                        "🐱",
+	"chart_with_downwards_trend": "📉",
+	"chart_with_upwards_trend":   "📈",
+	"clap":                       "👏",
+	"coffee":                     "☕",
+	"confused":                   "😕",
+	"construction":               "🚧",
+	"cool":                       "🆒",
+	"cry":                        "😢",
+	"disappointed":               "😞",
+	"dog":                        "🐶",
+	"eyes":                       "👀",
+	"fire":                       "🔥",
+	"flushed":                    "😳",
+	"gift":                       "🎁",
+	"grin":                       "😁",
+	"grinning":                   "😀",
+	"hammer":                     "🔨",
+	"heart":                      "❤️",
+	"heart_eyes":                 "😍",
+	"heavy_check_mark":           "✔️",
+	"heavy_minus_sign":           "➖",
+	"heavy_plus_sign":            "➕",
+	"hourglass":                  "⌛",
+	"hugging_face":               "🤗",
+	"information_source":         "ℹ️",
+	"joy":                        "😂",
+	"key":                        "🔑",
+	"kissing_heart":              "😘",
+	"laughing":                   "😆",
+	"link":                       "🔗",
+	"lock":                       "🔒",
+	"mag":                        "🔍",
+	"memo":                       "📝",
+	"moneybag":                   "💰",
+	"muscle":                     "💪",
+	"neutral_face":               "😐",
+	"no_entry":                   "⛔",
+	"ok":                         "🆗",
+	"ok_hand":                    "👌",
+	"one":                        "1️⃣",
+	"package":                    "📦",
+	"partying_face":              "🥳",
+	"pencil":                     "📝",
+	"pencil2":                    "✏️",
+	"pensive":                    "😔",
+	"point_down":                 "👇",
+	"point_left":                 "👈",
+	"point_right":                "👉",
+	"point_up":                   "☝️",
+	"pray":                       "🙏",
+	"pushpin":                    "📌",
+	"question":                   "❓",
+	"rage":                       "😡",
+	"raised_hands":               "🙌",
+	"raising_hand":               "🙋",
+	"recycle":                    "♻️",
+	"red_circle":                 "🔴",
+	"relaxed":                    "☺️",
+	"relieved":                   "😌",
+	"rocket":                     "🚀",
+	"rotating_light":             "🚨",
+	"scream":                     "😱",
+	"see_no_evil":                "🙈",
+	"shrug":                      "🤷",
+	"skull":                      "💀",
+	"sleeping":                   "😴",
+	"slightly_smiling_face":      "🙂",
+	"smile":                      "😄",
+	"smiley":                     "😃",
+	"smirk":                      "😏",
+	"sob":                        "😭",
+	"sparkles":                   "✨",
+	"star":                       "⭐",
+	"stuck_out_tongue":           "😛",
+	"sunglasses":                 "😎",
+	"sweat_smile":                "😅",
+	"tada":                       "🎉",
+	"thinking_face":              "🤔",
+	"thumbsdown":                 "👎",
+	"thumbsup":                   "👍",
+	"tired_face":                 "😫",
+	"trophy":                     "🏆",
+	"two":                        "2️⃣",
+	"unamused":                   "😒",
+	"upside_down_face":           "🙃",
+	"warning":                    "⚠️",
+	"wave":                       "👋",
+	"white_check_mark":           "✅",
+	"wink":                       "😉",
+	"wrench":                     "🔧",
+	"x":                          "❌",
+	"yum":                        "😋",
+	"zap":                        "⚡",
+	"zzz":                        "💤",
+}
+
+// expandEmoji replaces standard emoji shortcodes in text with unicode, for
+// receivers that don't render them.
+func expandEmoji(text string) string {
+	return shortcodeRegexp.ReplaceAllStringFunc(text, func(s string) string {
+		if emoji, present := emojiShortcodes[s[1:len(s)-1]]; present {
+			return emoji
+		}
+		return s
+	})
+}
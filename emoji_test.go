@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpandEmoji(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"standard", "ship it :rocket:", "ship it 🚀"},
+		{"several", ":+1: :-1: :tada:", "👍 👎 🎉"},
+		{"adjacent", ":fire::fire:", "🔥🔥"},
+		{"custom emoji", "nice :partyparrot:", "nice :partyparrot:"},
+		{"unknown next to known", ":partyparrot::tada:", ":partyparrot:🎉"},
+		{"not a shortcode", "at 10:30:15 or :Smile:", "at 10:30:15 or :Smile:"},
+		{"no emoji", "hello", "hello"},
+	}
+	for _, test := range tests {
+		if got := expandEmoji(test.text); got != test.want {
+			t.Errorf("%v: expandEmoji(%q) = %q, want %q", test.name, test.text, got, test.want)
+		}
+	}
+}
+
+func TestWebhookExpandEmoji(t *testing.T) {
+	tests := []struct {
+		name    string
+		options WebhookOptions
+		want    string
+	}{
+		{"expanded", WebhookOptions{ExpandEmoji: true}, "ship it 🚀 :partyparrot:"},
+		{"left as shortcodes", WebhookOptions{}, "ship it :rocket: :partyparrot:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(""))
+			var payload webhookPayload
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&payload)
+			}))
+			defer server.Close()
+
+			hook := test.options
+			hook.URL = server.URL
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "ship it :rocket: :partyparrot:"}
+			if err := hook.Post(testContext(t), msg); err != nil {
+				t.Fatal(err)
+			}
+			if payload.Text != test.want {
+				t.Errorf("Sent %q, want %q", payload.Text, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The errors returned by the post path, so that callers can tell why a
+// post failed. Each wraps the error that caused it.
+type (
+	// rateLimitedError is a post Slack refused for exceeding its rate
+	// limits. RetryAfter is how long Slack asked to wait, if it said.
+	rateLimitedError struct {
+		Err        error
+		RetryAfter time.Duration
+	}
+	// authError is a post Slack refused because of its token.
+	authError struct{ Err error }
+	// channelNotFoundError is a post to a channel that doesn't exist, is
+	// archived or can't be posted to by the bridge.
+	channelNotFoundError struct{ Err error }
+	// transientError is a post that failed for a reason that may pass,
+	// such as a network error or a Slack outage.
+	transientError struct{ Err error }
+)
+
+func (e *rateLimitedError) Error() string     { return e.Err.Error() }
+func (e *authError) Error() string            { return e.Err.Error() }
+func (e *channelNotFoundError) Error() string { return e.Err.Error() }
+func (e *transientError) Error() string       { return e.Err.Error() }
+
+func (e *rateLimitedError) Unwrap() error     { return e.Err }
+func (e *authError) Unwrap() error            { return e.Err }
+func (e *channelNotFoundError) Unwrap() error { return e.Err }
+func (e *transientError) Unwrap() error       { return e.Err }
+
+// classifyCode returns err as the typed error for a Slack error code, or
+// err itself if the code isn't one the post path distinguishes.
+func classifyCode(err error, code string) error {
+	switch code {
+	case "not_authed", "invalid_auth", "account_inactive", "token_revoked", "token_expired", "invalid_token":
+		return &authError{err}
+	case "channel_not_found", "is_archived", "channel_is_archived", "not_in_channel", "action_prohibited", "no_service", "no_service_id", "no_team", "team_disabled":
+		return &channelNotFoundError{err}
+	case "ratelimited", "rate_limited":
+		return &rateLimitedError{Err: err}
+	case "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+		return &transientError{err}
+	}
+	return err
+}
+
+// classifyResponse returns the typed error for a post that Slack answered
+// with a status other than 200 and the given body.
+func classifyResponse(err error, res *http.Response, body string) error {
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		limited := &rateLimitedError{Err: err}
+		if seconds, parseErr := strconv.Atoi(res.Header.Get("Retry-After")); parseErr == nil {
+			limited.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return limited
+	case res.StatusCode >= 500:
+		return &transientError{err}
+	}
+	return classifyCode(err, body)
+}
+
+// classifyPostError returns the typed error for a failed post. Errors that
+// are already typed, and those that aren't recognized, are returned as is.
+func classifyPostError(err error) error {
+	switch e := err.(type) {
+	case *apiError:
+		return classifyCode(err, e.Code)
+	case *url.Error:
+		return &transientError{err}
+	}
+	return err
+}
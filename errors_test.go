@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhookErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		retryAfter     string
+		body           string
+		want           error
+		wantRetryAfter time.Duration
+	}{
+		{"ok", 200, "", "ok", nil, 0},
+		{"rate limited", 429, "30", "rate_limited", &rateLimitedError{}, 30 * time.Second},
+		{"rate limited without retry-after", 429, "", "", &rateLimitedError{}, 0},
+		{"invalid token", 403, "", "invalid_token", &authError{}, 0},
+		{"channel not found", 404, "", "channel_not_found", &channelNotFoundError{}, 0},
+		{"archived", 410, "", "channel_is_archived", &channelNotFoundError{}, 0},
+		{"outage", 503, "", "", &transientError{}, 0},
+		{"unrecognized", 400, "", "invalid_payload", fmt.Errorf(""), 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(""))
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, test.body)
+			}))
+			defer server.Close()
+			previous := postMessageURL
+			postMessageURL = server.URL
+			defer func() { postMessageURL = previous }()
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello"}
+			err := (Channel{teamB, chanB}).WebhookPostMessage(context.Background(), msg)
+			if (err == nil) != (test.want == nil) || (err != nil && reflect.TypeOf(err) != reflect.TypeOf(test.want)) {
+				t.Fatalf("WebhookPostMessage = %T %v, want %T", err, err, test.want)
+			}
+			if limited, ok := err.(*rateLimitedError); ok && limited.RetryAfter != test.wantRetryAfter {
+				t.Errorf("RetryAfter = %v, want %v", limited.RetryAfter, test.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"ratelimited", &rateLimitedError{}},
+		{"token_revoked", &authError{}},
+		{"not_in_channel", &channelNotFoundError{}},
+		{"internal_error", &transientError{}},
+		{"msg_too_long", &apiError{}},
+	}
+	for _, test := range tests {
+		t.Run(test.code, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("chat.postMessage", func(fakeCall) string { return `{"ok":false,"error":"` + test.code + `"}` })
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"token": "xoxb-dest"}}`))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello"}
+			err := (Channel{teamB, chanB}).PostMessage(context.Background(), msg)
+			if reflect.TypeOf(err) != reflect.TypeOf(test.want) {
+				t.Errorf("PostMessage = %T %v, want %T", err, err, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cause := fmt.Errorf("failed")
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&rateLimitedError{Err: cause}, true},
+		{&transientError{cause}, true},
+		{cause, true},
+		{&authError{cause}, false},
+		{&channelNotFoundError{cause}, false},
+		{errBreakerOpen, false},
+		{errPaused, false},
+		{errUnknownTeam, false},
+	}
+	for _, test := range tests {
+		if got := retryable(test.err); got != test.want {
+			t.Errorf("retryable(%T) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestErrorsUnwrap(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"rate limited", &rateLimitedError{Err: context.Canceled}},
+		{"auth", &authError{context.Canceled}},
+		{"channel not found", &channelNotFoundError{context.Canceled}},
+		{"transient", classifyPostError(&url.Error{Op: "Post", URL: "https://hooks.slack.com", Err: context.Canceled})},
+	}
+	for _, test := range tests {
+		if !errors.Is(test.err, context.Canceled) {
+			t.Errorf("%v: errors.Is(%v, context.Canceled) = false", test.name, test.err)
+		}
+	}
+}
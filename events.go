@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nlopes/slack"
+)
+
+type eventEnvelope struct {
+	Token     string          `json:"token"`
+	TeamId    string          `json:"team_id"`
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	EventId   string          `json:"event_id"`
+	Event     json.RawMessage `json:"event"`
+}
+
+type messageEvent struct {
+	Type        string             `json:"type"`
+	Subtype     string             `json:"subtype"`
+	Channel     string             `json:"channel"`
+	User        string             `json:"user"`
+	Username    string             `json:"username"`
+	BotId       string             `json:"bot_id"`
+	Text        string             `json:"text"`
+	ClientMsgId string             `json:"client_msg_id"`
+	Timestamp   string             `json:"ts"`
+	ThreadTs    string             `json:"thread_ts"`
+	Attachments []slack.Attachment `json:"attachments"`
+	Files       []sharedFile       `json:"files"`
+	// Message is the edited message of a message_changed event, and
+	// DeletedTs the timestamp of the message removed by message_deleted.
+	Message   *messageEvent    `json:"message"`
+	DeletedTs string           `json:"deleted_ts"`
+	Metadata  *messageMetadata `json:"metadata"`
+	// Hidden is set on messages Slack doesn't show in the channel.
+	Hidden bool `json:"hidden"`
+	// Edited is present on messages that have been edited.
+	Edited *struct {
+		User      string `json:"user"`
+		Timestamp string `json:"ts"`
+	} `json:"edited"`
+}
+
+// fromBot readies msg, posted by a bot or integration, reporting false if
+// the group doesn't forward bot messages.
+func (msg *slackMessage) fromBot(event messageEvent, group *Group) bool {
+	if !group.Options.ForwardBots {
+		return false
+	}
+	msg.Username = event.Username
+	if group.Options.BotAttachmentText && msg.Text == "" {
+		msg.TextFromAttachments()
+	}
+	return true
+}
+
+// accept reports whether the message of event is bridged to group,
+// naming the bot of bot messages the group forwards.
+func (msg *slackMessage) accept(event messageEvent, group *Group) bool {
+	switch event.Subtype {
+	case "", "file_share":
+		// Some integrations post without the bot_message subtype.
+		if event.BotId != "" && !msg.fromBot(event, group) {
+			return false
+		}
+	case "thread_broadcast":
+		// A reply also sent to the channel. Slack can deliver the threaded
+		// copy as well, with the same ts, which the dedupe check drops.
+		msg.Broadcast = true
+	case "bot_message":
+		if !msg.fromBot(event, group) {
+			return false
+		}
+	default:
+		return false
+	}
+	if event.Hidden {
+		log.Printf("Skipping hidden message %v in %v", event.Timestamp, msg.Channel)
+		return false
+	}
+	return true
+}
+
+// message builds the slackMessage for event, posted in channel.
+func (event messageEvent) message(channel Channel) slackMessage {
+	return slackMessage{
+		Channel:     channel,
+		Text:        event.Text,
+		Attachments: event.Attachments,
+		Files:       event.Files,
+		UserId:      event.User,
+		BotId:       event.BotId,
+		ClientMsgId: event.ClientMsgId,
+
+		Timestamp:       event.Timestamp,
+		ThreadTimestamp: event.ThreadTs,
+		Chain:           event.Metadata.chain(),
+		Instance:        event.Metadata.instance(),
+		Edited:          event.Edited != nil,
+	}
+}
+
+// processedEvents records the IDs of handled events, so Slack's retries of
+// an event that was handled but not acknowledged in time are ignored.
+var processedEvents = newCache(10000, time.Hour)
+
+// eventsHandler receives Slack Events API callbacks. Only plain and bot
+// messages in mapped channels are bridged, along with reactions and pins
+// for groups that mirror them.
+func eventsHandler(c *gin.Context) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.Printf("Unable to read event payload: %v", err)
+		c.Status(400)
+		return
+	}
+
+	var envelope eventEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		log.Printf("Malformed event payload: %v", err)
+		c.Status(400)
+		return
+	}
+
+	if !verified(VerifyEvent(c.Request.Header, body, envelope), "event") {
+		log.Printf("Unverified event %v", envelope.EventId)
+		c.Status(403)
+		return
+	}
+
+	if envelope.Type == "url_verification" {
+		c.JSON(200, gin.H{"challenge": envelope.Challenge})
+		return
+	}
+
+	if handledRetry(envelope.EventId, c.Request.Header.Get("X-Slack-Retry-Num"), c.Request.Header.Get("X-Slack-Retry-Reason")) {
+		c.Header("X-Slack-No-Retry", "1")
+		c.Status(200)
+		return
+	}
+
+	c.Status(200)
+
+	if envelope.Type != "event_callback" {
+		return
+	}
+	handleCallback(envelope)
+}
+
+// handledRetry reports whether attempt, Slack's retry number for the
+// event which is empty or zero on its first delivery, retries an event
+// that was already handled.
+func handledRetry(eventId string, attempt string, reason string) bool {
+	if attempt == "" || attempt == "0" {
+		return false
+	}
+	if _, present := processedEvents.Get(eventId); !present {
+		return false
+	}
+	log.Printf("Ignoring retry %v of event %v (%v)", attempt, eventId, reason)
+	return true
+}
+
+// handleCallback handles an event_callback, recording its ID so retries
+// of it are ignored.
+func handleCallback(envelope eventEnvelope) {
+	handleEvent(envelope)
+	if envelope.EventId != "" {
+		processedEvents.Set(envelope.EventId, true)
+	}
+}
+
+func handleEvent(envelope eventEnvelope) {
+	var event messageEvent
+	if err := json.Unmarshal(envelope.Event, &event); err != nil {
+		log.Printf("Malformed event %v: %v", envelope.EventId, err)
+		return
+	}
+	if event.Type == "reaction_added" {
+		go handleReaction(envelope)
+		return
+	}
+	if event.Type == "pin_added" || event.Type == "pin_removed" {
+		go handlePin(envelope)
+		return
+	}
+	if event.Type != "message" {
+		return
+	}
+
+	msg := event.message(resolveChannel(envelope.TeamId, event.Channel, nil))
+
+	if config().settings.IgnoreBotIds.Contains(event.BotId) {
+		return
+	}
+	group := msg.Group()
+	if group == nil {
+		// The group of a channel routed by name is only known once a
+		// worker has looked up the name. Edits and deletions are skipped,
+		// as a channel with mirrors was resolved already.
+		if msg.Channel.routable() && event.Subtype != "message_changed" && event.Subtype != "message_deleted" {
+			msg.Event = &event
+			queue.Enqueue(msg)
+		}
+		return
+	}
+
+	switch event.Subtype {
+	case "message_changed":
+		if event.Message != nil && (event.Message.BotId == "" || group.Options.ForwardBots) {
+			edited := event.Message.message(msg.Channel)
+			queue.Run("edit of "+edited.Timestamp+" in "+edited.Channel.String(), edited.SyncEdit)
+		}
+		return
+	case "message_deleted":
+		channel, ts := msg.Channel, event.DeletedTs
+		queue.Run("deletion of "+ts+" in "+channel.String(), func() { channel.SyncDelete(ts) })
+		return
+	}
+	if !msg.accept(event, group) {
+		return
+	}
+
+	queue.Enqueue(msg)
+}
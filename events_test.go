@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestEventRetries(t *testing.T) {
+	type delivery struct {
+		eventId string
+		retry   string
+	}
+	tests := []struct {
+		name        string
+		deliveries  []delivery
+		wantPosts   int
+		wantNoRetry bool
+	}{
+		{"first delivery", []delivery{{"Ev1", ""}}, 1, false},
+		{"retry of a handled event", []delivery{{"Ev1", ""}, {"Ev1", "1"}}, 1, true},
+		{"retry of an unseen event", []delivery{{"Ev1", "1"}}, 1, false},
+		{"redelivery without retry headers", []delivery{{"Ev1", ""}, {"Ev1", ""}}, 2, false},
+		{"different events", []delivery{{"Ev1", ""}, {"Ev2", "1"}}, 2, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeClock(t)
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": {"signing_secrets": "secret"}`))
+			useQueue(t)
+
+			noRetry := false
+			for i, d := range test.deliveries {
+				body := `{"type":"event_callback","team_id":"` + teamA + `","event_id":"` + d.eventId + `","event":` +
+					fmt.Sprintf(`{"type":"message","channel":"%v","user":"U0000000A","text":"hello %d","ts":"%d.000"}`, chanA, i, i+1) + `}`
+				req := signedRequest(body, "secret")
+				if d.retry != "" {
+					req.Header.Set("X-Slack-Retry-Num", d.retry)
+					req.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+				}
+				w := serveRequest(eventsHandler, "/events", req)
+				if w.Code != 200 {
+					t.Fatalf("eventsHandler returned %v", w.Code)
+				}
+				noRetry = w.Header().Get("X-Slack-No-Retry") == "1"
+				queue.Flush(testContext(t))
+			}
+
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+			if noRetry != test.wantNoRetry {
+				t.Errorf("X-Slack-No-Retry on the last delivery = %v, want %v", noRetry, test.wantNoRetry)
+			}
+		})
+	}
+}
+
+func TestThreadBroadcastPair(t *testing.T) {
+	reply := `{"type":"message","channel":"` + chanA + `","user":"U0000000A","text":"reply","ts":"2.000","thread_ts":"1.000"}`
+	broadcast := `{"type":"message","subtype":"thread_broadcast","channel":"` + chanA + `","user":"U0000000A","text":"reply","ts":"2.000","thread_ts":"1.000"}`
+	tests := []struct {
+		name      string
+		events    []string
+		wantPosts int
+	}{
+		{"broadcast first", []string{broadcast, reply}, 1},
+		{"reply first", []string{reply, broadcast}, 1},
+		{"broadcast alone", []string{broadcast}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(""))
+			useQueue(t)
+
+			for i, event := range test.events {
+				handleEvent(eventEnvelope{Type: "event_callback", TeamId: teamA, EventId: fmt.Sprint("Ev", i), Event: json.RawMessage(event)})
+			}
+			queue.Flush(testContext(t))
+
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
+
+func TestHiddenAndBotMessages(t *testing.T) {
+	attachments := `"attachments":[{"title":"Build #42","text":"3 tests failed"}]`
+	tests := []struct {
+		name            string
+		options         string
+		event           string
+		wantPosts       int
+		wantText        string
+		wantAttachments bool
+	}{
+		{"hidden", `{}`, `"user":"U0000000A","text":"hi","hidden":true`, 0, "", false},
+		{"hidden bot message", `{"forward_bots": true}`, `"subtype":"bot_message","bot_id":"B1","username":"ci","hidden":true,` + attachments, 0, "", false},
+		{"attachment-only bot message", `{"forward_bots": true}`, `"subtype":"bot_message","bot_id":"B1","username":"ci",` + attachments, 1, "", true},
+		{"bot message without a subtype", `{"forward_bots": true}`, `"bot_id":"B1","username":"ci",` + attachments, 1, "", true},
+		{"bots not forwarded", `{}`, `"bot_id":"B1","username":"ci",` + attachments, 0, "", false},
+		{"text from attachments", `{"forward_bots": true, "bot_attachment_text": true}`, `"subtype":"bot_message","bot_id":"B1","username":"ci",` + attachments, 1, "Build #42\n3 tests failed", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			useQueue(t)
+
+			event := `{"type":"message","channel":"` + chanA + `","ts":"1.000",` + test.event + `}`
+			handleEvent(eventEnvelope{Type: "event_callback", TeamId: teamA, EventId: "Ev1", Event: json.RawMessage(event)})
+			queue.Flush(testContext(t))
+
+			posts := slack.Posts()
+			if len(posts) != test.wantPosts {
+				t.Fatalf("Got %d posts, want %d", len(posts), test.wantPosts)
+			}
+			if test.wantPosts == 0 {
+				return
+			}
+			if got := posts[0].Get("text"); got != test.wantText {
+				t.Errorf("Posted text %q, want %q", got, test.wantText)
+			}
+			if got := posts[0].Get("attachments"); (got != "" && got != "null") != test.wantAttachments {
+				t.Errorf("Posted attachments %v, want attachments %v", got, test.wantAttachments)
+			}
+			if got := posts[0].Get("username"); got != "ci" {
+				t.Errorf("Posted as %q, want the bot's name", got)
+			}
+		})
+	}
+}
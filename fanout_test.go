@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// largeGroup returns a configuration whose group has teamA's chanA and n
+// destinations in teamB. Archive checks are off, as conversations.info is
+// rate limited well below the pace of the first post to each destination.
+func largeGroup(options string, n int) string {
+	content := testConfig(options, `"settings": {"archive_check_interval": "0s"}`)
+	for i := 0; i < n; i++ {
+		content = withChannel(content, fmt.Sprintf("%v/C%08d", teamB, i))
+	}
+	return content
+}
+
+func TestStreamingFanout(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      string
+		destinations int
+		wantMax      int
+	}{
+		{"one at a time by default", `{}`, 20, 1},
+		{"bounded concurrency", `{"fanout_concurrency": 4}`, 50, 4},
+		{"more slots than destinations", `{"fanout_concurrency": 100}`, 5, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			var mu sync.Mutex
+			inFlight, peak := 0, 0
+			slack.Handle("webhook", func(fakeCall) string {
+				mu.Lock()
+				inFlight++
+				if inFlight > peak {
+					peak = inFlight
+				}
+				mu.Unlock()
+				time.Sleep(2 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				return "ok"
+			})
+			useConfig(t, largeGroup(test.options, test.destinations))
+
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello", Timestamp: "1.000"})
+
+			// chanB is in the group as well as the generated destinations.
+			want := test.destinations + 1
+			if posts := len(slack.Posts()); posts != want {
+				t.Errorf("Made %d posts, want one to each of the %d destinations", posts, want)
+			}
+			if peak > test.wantMax {
+				t.Errorf("Posted to %d destinations at once, want at most %d", peak, test.wantMax)
+			}
+			if test.wantMax > 1 && peak < 2 {
+				t.Errorf("Posted to one destination at a time, want up to %d", test.wantMax)
+			}
+			destinations := map[string]bool{}
+			for _, post := range slack.Posts() {
+				if destinations[post.Get("channel")] {
+					t.Errorf("Posted to %v twice", post.Get("channel"))
+				}
+				destinations[post.Get("channel")] = true
+			}
+		})
+	}
+}
+
+func BenchmarkStreamingFanout(b *testing.B) {
+	for _, size := range []int{10, 100, 500} {
+		b.Run(fmt.Sprint(size, " destinations"), func(b *testing.B) {
+			newFakeSlack(b)
+			useConfig(b, largeGroup(`{"fanout_concurrency": 8}`, size))
+			text := strings.Repeat("a fairly long message ", 50)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: text, Timestamp: fmt.Sprintf("%d.000", i+1)})
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+type sharedFile struct {
+	Id              string `json:"id"`
+	Name            string `json:"name"`
+	Title           string `json:"title"`
+	Mimetype        string `json:"mimetype"`
+	URLPrivate      string `json:"url_private"`
+	Permalink       string `json:"permalink"`
+	PermalinkPublic string `json:"permalink_public"`
+	PublicURLShared bool   `json:"public_url_shared"`
+}
+
+func (f sharedFile) link(url string) string {
+	title := f.Title
+	if title == "" {
+		title = f.Name
+	}
+	return "<" + url + "|" + title + ">"
+}
+
+var errPublicFilesDisallowed = errors.New("public file links are disallowed for this team")
+
+// publicLinks caches the public permalink of each file made public, so a
+// file forwarded to several destinations is only shared once.
+var publicLinks = struct {
+	sync.Mutex
+	links map[string]string
+}{links: make(map[string]string)}
+
+// PublicFileURL makes one of the team's files public, returning its public
+// permalink.
+func (t *Team) PublicFileURL(ctx context.Context, f sharedFile) (string, error) {
+	if t.Options.DisallowPublicFiles {
+		return "", errPublicFilesDisallowed
+	}
+	if f.PublicURLShared && f.PermalinkPublic != "" {
+		return f.PermalinkPublic, nil
+	}
+
+	publicLinks.Lock()
+	link, present := publicLinks.links[f.Id]
+	publicLinks.Unlock()
+	if present {
+		return link, nil
+	}
+
+	var response struct {
+		File sharedFile `json:"file"`
+	}
+	if err := t.apiCall(ctx, "files.sharedPublicURL", url.Values{"file": {f.Id}}, &response); err != nil {
+		return "", err
+	}
+
+	publicLinks.Lock()
+	publicLinks.links[f.Id] = response.File.PermalinkPublic
+	publicLinks.Unlock()
+	return response.File.PermalinkPublic, nil
+}
+
+// fileSummary renders a compact list of links to files. Files that were
+// already made public link to their public page; the rest link to their
+// permalink, which only members of the source team can open.
+func fileSummary(files []sharedFile) string {
+	links := make([]string, len(files))
+	for i, f := range files {
+		if f.PublicURLShared && f.PermalinkPublic != "" {
+			links[i] = f.link(f.PermalinkPublic)
+		} else {
+			links[i] = f.link(f.Permalink)
+		}
+	}
+	count := "1 file"
+	if len(files) != 1 {
+		count = fmt.Sprintf("%v files", len(files))
+	}
+	return "📎 " + count + ": " + strings.Join(links, ", ")
+}
+
+// LinkFiles appends links to the message's files according to the
+// destination's file mode, returning the files that must be re-uploaded
+// instead.
+func (msg *slackMessage) LinkFiles(ctx context.Context, dest Channel) []sharedFile {
+	if msg.Group().Options.FileList && len(msg.Files) > 0 {
+		msg.Text = strings.TrimPrefix(msg.Text+"\n"+fileSummary(msg.Files), "\n")
+		return nil
+	}
+
+	var uploads []sharedFile
+	var links []string
+
+	mode := dest.Options().FileMode
+	for _, f := range msg.Files {
+		switch mode {
+		case fileModeLink:
+			links = append(links, f.link(f.Permalink))
+		case fileModePublicLink:
+			if msg.Preview {
+				links = append(links, f.link(f.PermalinkPublic))
+				continue
+			}
+			link, err := msg.GetTeam().PublicFileURL(ctx, f)
+			if err != nil {
+				log.Printf("Unable to make %v public, re-uploading to %v: %v", f.Id, dest, err)
+				uploads = append(uploads, f)
+			} else {
+				links = append(links, f.link(link))
+			}
+		default:
+			uploads = append(uploads, f)
+		}
+	}
+
+	if len(links) > 0 {
+		if msg.Text != "" {
+			links = append([]string{msg.Text}, links...)
+		}
+		msg.Text = strings.Join(links, "\n")
+	}
+	return uploads
+}
+
+// UploadFile downloads a file shared in source and uploads a copy to the
+// channel.
+func (c Channel) UploadFile(ctx context.Context, source *Team, f sharedFile) error {
+	req, err := http.NewRequest("GET", f.URLPrivate, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+source.APIToken)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("Unable to download %v: %v", f.Id, res.Status)
+	}
+
+	target, err := c.Target(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Uploading %v to %v", f.Id, c)
+
+	values := url.Values{
+		"channels": {target},
+		"filename": {f.Name},
+		"title":    {f.Title},
+	}
+	err = c.Poster().apiUpload(ctx, "files.upload", values, f.Name, res.Body, nil)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestLinkFiles(t *testing.T) {
+	file := sharedFile{
+		Id:         "F0000000A",
+		Name:       "report.pdf",
+		Title:      "Report",
+		URLPrivate: "https://files.slack.com/report.pdf",
+		Permalink:  "https://a.slack.com/files/report.pdf",
+	}
+	shared := file
+	shared.PublicURLShared, shared.PermalinkPublic = true, "https://slack-files.com/shared"
+
+	tests := []struct {
+		name        string
+		mode        string
+		file        sharedFile
+		disallow    bool
+		apiResponse string
+		wantText    string
+		wantUploads int
+		wantCalls   int
+	}{
+		{"upload", fileModeUpload, file, false, "", "see", 1, 0},
+		{"link", fileModeLink, file, false, "", "see\n<https://a.slack.com/files/report.pdf|Report>", 0, 0},
+		{"public link", fileModePublicLink, file, false,
+			`{"ok":true,"file":{"permalink_public":"https://slack-files.com/public"}}`,
+			"see\n<https://slack-files.com/public|Report>", 0, 1},
+		{"already public", fileModePublicLink, shared, false, "", "see\n<https://slack-files.com/shared|Report>", 0, 0},
+		{"public link refused", fileModePublicLink, file, false, `{"ok":false,"error":"not_allowed"}`, "see", 1, 2},
+		{"public files disallowed", fileModePublicLink, file, true, "", "see", 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			if test.apiResponse != "" {
+				slack.Handle("files.sharedPublicURL", func(fakeCall) string { return test.apiResponse })
+			}
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"file_mode": "`+test.mode+`"}}`))
+			config().teams[teamA].Options.DisallowPublicFiles = test.disallow
+			dest := Channel{teamB, chanB}
+
+			// A second message checks that public links are only created
+			// once.
+			for i := 0; i < 2; i++ {
+				msg := slackMessage{Channel: Channel{teamA, chanA}, Text: "see", Files: []sharedFile{test.file}}
+				uploads := msg.LinkFiles(context.Background(), dest)
+				if msg.Text != test.wantText {
+					t.Errorf("Text = %q, want %q", msg.Text, test.wantText)
+				}
+				if len(uploads) != test.wantUploads {
+					t.Errorf("Got %d uploads, want %d", len(uploads), test.wantUploads)
+				}
+			}
+			if calls := len(slack.Calls("files.sharedPublicURL")); calls != test.wantCalls {
+				t.Errorf("Made %d files.sharedPublicURL calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFileSummary(t *testing.T) {
+	tests := []struct {
+		files []sharedFile
+		want  string
+	}{
+		{[]sharedFile{{Name: "a.png", Permalink: "https://p/a"}}, "📎 1 file: <https://p/a|a.png>"},
+		{[]sharedFile{
+			{Title: "A", Permalink: "https://p/a"},
+			{Title: "B", Permalink: "https://p/b", PublicURLShared: true, PermalinkPublic: "https://pub/b"},
+		}, "📎 2 files: <https://p/a|A>, <https://pub/b|B>"},
+	}
+	for _, test := range tests {
+		if got := fileSummary(test.files); got != test.want {
+			t.Errorf("fileSummary() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestPostMessageReuploadsFallback(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.Handle("files.sharedPublicURL", func(fakeCall) string { return `{"ok":false,"error":"not_allowed"}` })
+	useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"file_mode": "public_link"}}`))
+
+	file := sharedFile{Id: "F0000000A", Name: "report.pdf", URLPrivate: slack.URL + "/files/report.pdf"}
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "see", Files: []sharedFile{file}}
+	if err := (Channel{teamB, chanB}).PostMessage(context.Background(), msg); err != nil {
+		t.Fatalf("PostMessage: %v", err)
+	}
+
+	uploads := slack.Calls("files.upload")
+	if len(uploads) != 1 {
+		t.Fatalf("Got %d uploads, want 1", len(uploads))
+	}
+	if got := uploads[0].Get("channels"); got != chanB {
+		t.Errorf("Uploaded to %q, want %v", got, chanB)
+	}
+}
+
+func TestUploadFailureKeepsPost(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		failed      string
+	}{
+		{"uploaded", `{}`, ""},
+		// The fake answers downloads as webhook posts, so the text goes
+		// through the Web API instead.
+		{"download failed", `{"token": "xoxb-b"}`, "webhook"},
+		{"upload failed", `{}`, "files.upload"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.destination+`}`,
+				`"settings": {"post_retries": 2, "retry_delay": "1ms"}`))
+			slack.Fail(test.failed, 500)
+
+			file := sharedFile{Id: "F0000000A", Name: "report.pdf", URLPrivate: slack.URL + "/files/report.pdf"}
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "see", Files: []sharedFile{file}}
+			if err := (Channel{teamB, chanB}).deliverNow(context.Background(), msg); err != nil {
+				t.Errorf("deliverNow = %v, want the post to succeed", err)
+			}
+
+			var texts int
+			for _, post := range slack.Posts() {
+				if post.Get("text") == "see" {
+					texts++
+				}
+			}
+			if texts != 1 {
+				t.Errorf("Posted the text %d times, want once", texts)
+			}
+			if letters := deadLetters.List(); len(letters) != 0 {
+				t.Errorf("Dead-lettered %d delivered messages", len(letters))
+			}
+		})
+	}
+}
+
+func TestFileListPayload(t *testing.T) {
+	files := `[
+		{"id": "F1", "name": "a.png", "permalink": "https://a.slack.com/files/a.png"},
+		{"id": "F2", "name": "b.pdf", "title": "Plan", "permalink": "https://a.slack.com/files/b.pdf"},
+		{"id": "F3", "name": "c.txt", "permalink": "https://a.slack.com/files/c.txt", "public_url_shared": true, "permalink_public": "https://slack-files.com/c"}
+	]`
+	tests := []struct {
+		name     string
+		options  string
+		wantText string
+	}{
+		{"listed", `{"file_list": true}`, "see\n📎 3 files: <https://a.slack.com/files/a.png|a.png>, " +
+			"<https://a.slack.com/files/b.pdf|Plan>, <https://slack-files.com/c|c.txt>"},
+		{"not listed", `{}`, "see"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			useQueue(t)
+
+			event := `{"type":"message","subtype":"file_share","channel":"` + chanA + `","user":"U0000000A","text":"see","ts":"1.000","files":` + files + `}`
+			handleEvent(eventEnvelope{Type: "event_callback", TeamId: teamA, EventId: "Ev1", Event: json.RawMessage(event)})
+			queue.Flush(testContext(t))
+
+			posts := slack.Posts()
+			if len(posts) != 1 {
+				t.Fatalf("Got %d posts, want 1", len(posts))
+			}
+			if got := posts[0].Get("text"); got != test.wantText {
+				t.Errorf("Posted %q, want %q", got, test.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+const defaultFlapSimilarity = 0.9
+
+type lastForward struct {
+	words map[string]bool
+	at    time.Time
+}
+
+// lastForwards holds the words of the last message forwarded from each
+// source channel of a group with a flap interval, including the words of
+// its attachments.
+var lastForwards = newCache(10000, 0)
+
+// Flapping reports whether the message is within its group's FlapInterval
+// of the last message forwarded from its channel and at least
+// FlapSimilarity alike. Messages that aren't flapping become the last
+// forwarded message of their channel.
+func (msg *slackMessage) Flapping() bool {
+	options := msg.Group().Options
+	if options.FlapInterval.Duration <= 0 {
+		return false
+	}
+	threshold := options.FlapSimilarity
+	if threshold <= 0 {
+		threshold = defaultFlapSimilarity
+	}
+
+	key := msg.Channel.String()
+	words := msg.wordSet()
+	if value, present := lastForwards.Get(key); present {
+		last := value.(lastForward)
+		if now().Sub(last.at) < options.FlapInterval.Duration && similarity(words, last.words) >= threshold {
+			return true
+		}
+	}
+	lastForwards.Set(key, lastForward{words, now()})
+	return false
+}
+
+// wordSet returns the words of the message's text and of its attachments,
+// which carry the content of most integration alerts.
+func (msg *slackMessage) wordSet() map[string]bool {
+	texts := []string{msg.Text}
+	for _, attachment := range msg.Attachments {
+		texts = append(texts, attachment.Pretext, attachment.Title, attachment.Text, attachment.Fallback)
+	}
+	words := make(map[string]bool)
+	for _, text := range texts {
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// similarity is the Jaccard index of two sets of words: the share of all
+// their words that they have in common. Messages without words, such as
+// file shares, are never alike.
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for word := range a {
+		if b[word] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+func TestFlapping(t *testing.T) {
+	alert := func(text string) slackMessage { return slackMessage{Username: "monitor", Text: text} }
+	attached := func(text string) slackMessage {
+		return slackMessage{Username: "monitor", Attachments: []slack.Attachment{{Title: "Alert", Text: text, Fallback: text}}}
+	}
+	type step struct {
+		wait       time.Duration
+		msg        slackMessage
+		wantPosted bool
+	}
+	tests := []struct {
+		name    string
+		options string
+		steps   []step
+	}{
+		{"flapping pair collapses", `{"flap_interval": "1m"}`, []step{
+			{0, alert("CPU high on web-1"), true},
+			{5 * time.Second, alert("CPU high on web-1"), false},
+		}},
+		{"distinct alerts pass", `{"flap_interval": "1m"}`, []step{
+			{0, alert("CPU high on web-1"), true},
+			{5 * time.Second, alert("Disk full on db-2"), true},
+		}},
+		{"after the interval", `{"flap_interval": "1m"}`, []step{
+			{0, alert("CPU high on web-1"), true},
+			{2 * time.Minute, alert("CPU high on web-1"), true},
+		}},
+		{"near duplicate within the threshold", `{"flap_interval": "1m", "flap_similarity": 0.6}`, []step{
+			{0, alert("CPU high on web-1 at 91%"), true},
+			{5 * time.Second, alert("CPU high on web-1 at 93%"), false},
+		}},
+		{"near duplicate below the default threshold", `{"flap_interval": "1m"}`, []step{
+			{0, alert("CPU high on web-1 at 91%"), true},
+			{5 * time.Second, alert("CPU high on web-1 at 93%"), true},
+		}},
+		{"identical attachments collapse", `{"flap_interval": "1m"}`, []step{
+			{0, attached("CPU high on web-1"), true},
+			{5 * time.Second, attached("CPU high on web-1"), false},
+		}},
+		{"distinct attachments pass", `{"flap_interval": "1m"}`, []step{
+			{0, attached("CPU high on web-1"), true},
+			{5 * time.Second, attached("Disk full on db-2"), true},
+		}},
+		{"messages without words pass", `{"flap_interval": "1m"}`, []step{
+			{0, alert(""), true},
+			{5 * time.Second, alert(""), true},
+		}},
+		{"disabled", `{}`, []step{
+			{0, alert("CPU high on web-1"), true},
+			{5 * time.Second, alert("CPU high on web-1"), true},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			advance := fakeClock(t)
+
+			for i, step := range test.steps {
+				advance(step.wait)
+				msg := step.msg
+				msg.Channel = Channel{teamA, chanA}
+				msg.Timestamp = fmt.Sprintf("%d.000", i+1)
+				before := len(slack.Posts())
+				Bridge(msg)
+				if posted := len(slack.Posts()) > before; posted != step.wantPosted {
+					t.Errorf("Message %d posted %v, want %v", i, posted, step.wantPosted)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+const (
+	formatSlack    = "slack"
+	formatMarkdown = "markdown"
+	formatPlain    = "plain"
+)
+
+var (
+	codeFenceRegexp  = regexp.MustCompile("(?s)```(.*?)```")
+	inlineCodeRegexp = regexp.MustCompile("`([^`\n]+)`")
+	languageRegexp   = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,20}$`)
+)
+
+// formatText converts Slack-formatted text for a non-Slack destination.
+// Slack code blocks may start on the same line as other text and have no
+// language hints, so "markdown" puts fences on their own lines and turns
+// a lone word on the first line of a block into the fence's language.
+// "plain" drops code formatting altogether. Both decode Slack's HTML
+// entities; "slack" leaves the text unchanged.
+func formatText(text string, format string) string {
+	if format == "" || format == formatSlack {
+		return text
+	}
+
+	var out []string
+	last := 0
+	for _, match := range codeFenceRegexp.FindAllStringSubmatchIndex(text, -1) {
+		out = append(out, formatInline(text[last:match[0]], format))
+		out = append(out, formatFence(text[match[2]:match[3]], format))
+		last = match[1]
+	}
+	out = append(out, formatInline(text[last:], format))
+	return strings.Trim(strings.Join(out, ""), "\n")
+}
+
+func formatInline(text string, format string) string {
+	text = html.UnescapeString(text)
+	if format == formatPlain {
+		return inlineCodeRegexp.ReplaceAllString(text, "$1")
+	}
+	return text
+}
+
+func formatFence(code string, format string) string {
+	code = html.UnescapeString(strings.Trim(code, "\n"))
+	language := ""
+	if lines := strings.SplitN(code, "\n", 2); len(lines) == 2 && languageRegexp.MatchString(lines[0]) {
+		language, code = lines[0], lines[1]
+	}
+	if format == formatPlain {
+		return "\n" + code + "\n"
+	}
+	return "\n```" + language + "\n" + code + "\n```\n"
+}
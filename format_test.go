@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFormatText(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		format string
+		want   string
+	}{
+		{"slack unchanged", "run `make` &amp; ```go\nx```", formatSlack, "run `make` &amp; ```go\nx```"},
+		{"default unchanged", "run `make`", "", "run `make`"},
+		{"markdown inline", "run `make` &amp; wait", formatMarkdown, "run `make` & wait"},
+		{"plain inline", "run `make` now", formatPlain, "run make now"},
+		{"markdown fence", "before ```x := 1``` after", formatMarkdown, "before \n```\nx := 1\n```\n after"},
+		{"markdown language", "```go\nx := 1\ny := 2```", formatMarkdown, "```go\nx := 1\ny := 2\n```"},
+		{"not a language", "```x := 1\ny := 2```", formatMarkdown, "```\nx := 1\ny := 2\n```"},
+		{"plain fence", "see:\n```go\nfmt.Println(\"&lt;hi&gt;\")\n```", formatPlain, "see:\n\nfmt.Println(\"<hi>\")"},
+		{"several fences", "```a``` and ```b```", formatMarkdown, "```\na\n```\n and \n```\nb\n```"},
+		{"backticks inside a fence", "```use `x` here```", formatPlain, "use `x` here"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := formatText(test.text, test.format); got != test.want {
+				t.Errorf("formatText(%q, %v) = %q, want %q", test.text, test.format, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// now is the clock used for all time-based decisions.
+var now = time.Now
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+var errBreakerOpen = errors.New("circuit breaker open")
+
+var errPaused = errors.New("paused for its error rate")
+
+// healthyProbes is how many posts in a row must succeed after a pause's
+// cooldown for forwarding to resume.
+const healthyProbes = 3
+
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+type DestinationHealth struct {
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Breaker             string    `json:"breaker"`
+	Healthy             bool      `json:"healthy"`
+	// Paused is set while forwarding is paused for the destination's error
+	// rate, with posts resuming as probes from PausedUntil.
+	Paused      bool      `json:"paused"`
+	PausedUntil time.Time `json:"paused_until,omitempty"`
+
+	openedAt time.Time
+	trial    bool
+	outcomes []outcome
+	probes   int
+}
+
+// healthRegistry tracks the outcome of posts to each destination and runs
+// a circuit breaker per destination: after BreakerThreshold consecutive
+// failures the breaker opens and posts are skipped until BreakerCooldown
+// has passed, when a single trial post is let through.
+type healthRegistry struct {
+	sync.Mutex
+	destinations map[Channel]*DestinationHealth
+	// pauses enables pausing destinations for their error rate.
+	pauses bool
+}
+
+var health = &healthRegistry{destinations: make(map[Channel]*DestinationHealth), pauses: true}
+
+// clients tracks each team's API client, keyed by the team with no
+// channel, so lookups made for every message can be skipped while the
+// team's token is failing.
+var clients = &healthRegistry{destinations: make(map[Channel]*DestinationHealth)}
+
+// clientFailure returns err if it shows the client itself is failing,
+// rather than the call: a network error or rejected credentials. Errors
+// such as user_not_found are treated as success.
+func clientFailure(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*url.Error); ok || isAuthError(err) {
+		return err
+	}
+	return nil
+}
+
+// isAuthError reports whether err is Slack rejecting the token.
+func isAuthError(err error) bool {
+	code := err.Error()
+	switch e := err.(type) {
+	case *authError:
+		return true
+	case *apiError:
+		code = e.Code
+	}
+	switch code {
+	case "not_authed", "invalid_auth", "account_inactive", "token_revoked", "token_expired":
+		return true
+	}
+	return false
+}
+
+func (r *healthRegistry) get(c Channel) *DestinationHealth {
+	h, present := r.destinations[c]
+	if !present {
+		h = &DestinationHealth{Breaker: breakerClosed}
+		r.destinations[c] = h
+	}
+	return h
+}
+
+// Paused reports whether forwarding to c is paused for its error rate and
+// its cooldown hasn't passed yet.
+func (r *healthRegistry) Paused(c Channel) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	h := r.get(c)
+	return h.Paused && now().Before(h.PausedUntil)
+}
+
+// Allow reports whether a post to c may be attempted.
+func (r *healthRegistry) Allow(c Channel) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	h := r.get(c)
+	switch h.Breaker {
+	case breakerOpen:
+		if now().Sub(h.openedAt) < config().settings.BreakerCooldown.Duration {
+			return false
+		}
+		h.Breaker = breakerHalfOpen
+		h.trial = true
+		return true
+	case breakerHalfOpen:
+		if h.trial {
+			return false
+		}
+		h.trial = true
+		return true
+	}
+	return true
+}
+
+// Record updates c's health with the result of a post.
+func (r *healthRegistry) Record(c Channel, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	h := r.get(c)
+	h.trial = false
+	if r.pauses {
+		h.recordOutcome(c, err)
+	}
+	if err == nil {
+		h.LastSuccess = now()
+		h.ConsecutiveFailures = 0
+		h.Breaker = breakerClosed
+		return
+	}
+
+	h.LastFailure = now()
+	h.LastError = err.Error()
+	h.ConsecutiveFailures++
+	if h.Breaker == breakerHalfOpen || h.ConsecutiveFailures >= config().settings.BreakerThreshold {
+		h.Breaker = breakerOpen
+		h.openedAt = now()
+	}
+}
+
+// recordOutcome pauses forwarding once the share of failed posts within
+// PauseWindow reaches PauseErrorRate, counting at least PauseMinPosts
+// posts. After PauseCooldown posts are let through again as probes; a
+// failure restarts the cooldown and healthyProbes successes resume
+// forwarding.
+func (h *DestinationHealth) recordOutcome(c Channel, err error) {
+	settings := config().settings
+	if settings.PauseErrorRate <= 0 {
+		return
+	}
+
+	if h.Paused {
+		switch {
+		case err != nil:
+			h.PausedUntil = now().Add(settings.PauseCooldown.Duration)
+			h.probes = 0
+		case h.probes+1 >= healthyProbes:
+			log.Printf("Resuming forwarding to %v", c)
+			h.Paused = false
+			h.PausedUntil = time.Time{}
+			h.probes = 0
+			h.outcomes = nil
+		default:
+			h.probes++
+		}
+		return
+	}
+
+	h.outcomes = append(h.outcomes, outcome{now(), err != nil})
+	cutoff := now().Add(-settings.PauseWindow.Duration)
+	for len(h.outcomes) > 0 && h.outcomes[0].at.Before(cutoff) {
+		h.outcomes = h.outcomes[1:]
+	}
+	if len(h.outcomes) < settings.PauseMinPosts {
+		return
+	}
+	failed := 0
+	for _, o := range h.outcomes {
+		if o.failed {
+			failed++
+		}
+	}
+	if rate := float64(failed) / float64(len(h.outcomes)); rate >= settings.PauseErrorRate {
+		log.Printf("Pausing forwarding to %v: %.0f%% of recent posts failed", c, rate*100)
+		h.Paused = true
+		h.PausedUntil = now().Add(settings.PauseCooldown.Duration)
+	}
+}
+
+// Snapshot returns a copy of every destination's health, keyed by
+// TID/CID.
+func (r *healthRegistry) Snapshot() map[string]DestinationHealth {
+	r.Lock()
+	defer r.Unlock()
+
+	snapshot := make(map[string]DestinationHealth, len(r.destinations))
+	for c, h := range r.destinations {
+		entry := *h
+		entry.Healthy = h.Breaker == breakerClosed && h.ConsecutiveFailures == 0 && !h.Paused
+		snapshot[c.String()] = entry
+	}
+	return snapshot
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock replaces now for the rest of the test, returning a function
+// that advances it.
+func fakeClock(t testing.TB) func(time.Duration) {
+	t.Helper()
+	current := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	previous := now
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = previous })
+	return func(d time.Duration) { current = current.Add(d) }
+}
+
+func TestHealthRegistry(t *testing.T) {
+	failure := errors.New("500 Internal Server Error")
+	type step struct {
+		wait time.Duration
+		err  error
+	}
+	tests := []struct {
+		name        string
+		steps       []step
+		wantAllow   bool
+		wantBreaker string
+		wantHealthy bool
+	}{
+		{"success", []step{{0, nil}}, true, breakerClosed, true},
+		{"one failure", []step{{0, failure}}, true, breakerClosed, false},
+		{"threshold", []step{{0, failure}, {0, failure}}, false, breakerOpen, false},
+		{"recovers", []step{{0, failure}, {0, failure}, {time.Minute, nil}}, true, breakerClosed, true},
+		{"failed trial", []step{{0, failure}, {0, failure}, {time.Minute, failure}}, false, breakerOpen, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			useConfig(t, testConfig("", `"settings": {"breaker_threshold": 2, "breaker_cooldown": "1m"}`))
+			dest := Channel{teamB, chanB}
+			for _, s := range test.steps {
+				advance(s.wait)
+				if !health.Allow(dest) {
+					t.Fatalf("Allow refused a post")
+				}
+				health.Record(dest, s.err)
+			}
+
+			if got := health.Allow(dest); got != test.wantAllow {
+				t.Errorf("Allow() = %v, want %v", got, test.wantAllow)
+			}
+			h := health.Snapshot()[dest.String()]
+			if h.Breaker != test.wantBreaker || h.Healthy != test.wantHealthy {
+				t.Errorf("Got breaker %v, healthy %v; want %v, %v", h.Breaker, h.Healthy, test.wantBreaker, test.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestHealthPause(t *testing.T) {
+	failure := errors.New("500 Internal Server Error")
+	type step struct {
+		wait time.Duration
+		err  error
+	}
+	failing := []step{{0, nil}, {0, failure}, {0, nil}, {0, failure}}
+	tests := []struct {
+		name        string
+		rate        string
+		steps       []step
+		wantPaused  bool
+		wantPausing bool
+	}{
+		{"below the threshold", "0.5", []step{{0, nil}, {0, failure}, {0, nil}, {0, nil}}, false, false},
+		{"at the threshold", "0.5", failing, true, true},
+		{"too few posts", "0.5", []step{{0, failure}, {0, failure}, {0, failure}}, false, false},
+		{"failures outside the window", "0.5",
+			[]step{{0, failure}, {0, failure}, {0, failure}, {2 * time.Minute, nil}, {0, nil}, {0, nil}, {0, failure}}, false, false},
+		{"during the cooldown", "0.5", append(failing, step{5 * time.Minute, nil}), true, true},
+		{"probing after the cooldown", "0.5", append(failing, step{10 * time.Minute, nil}), false, true},
+		{"failed probe restarts the cooldown", "0.5", append(failing, step{10 * time.Minute, nil}, step{0, failure}), true, true},
+		{"resumed after healthy probes", "0.5", append(failing, step{10 * time.Minute, nil}, step{0, nil}, step{0, nil}), false, false},
+		{"disabled", "0", []step{{0, failure}, {0, failure}, {0, failure}, {0, failure}}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			useConfig(t, testConfig("", `"settings": {"breaker_threshold": 100, "pause_error_rate": `+test.rate+`,
+				"pause_window": "1m", "pause_min_posts": 4, "pause_cooldown": "10m"}`))
+			dest := Channel{teamB, chanB}
+
+			for _, step := range test.steps {
+				advance(step.wait)
+				health.Record(dest, step.err)
+			}
+			if paused := health.Paused(dest); paused != test.wantPaused {
+				t.Errorf("Paused() = %v, want %v", paused, test.wantPaused)
+			}
+			if h := health.Snapshot()[dest.String()]; h.Paused != test.wantPausing || (h.Paused && h.Healthy) {
+				t.Errorf("Health is %+v, want paused %v", h, test.wantPausing)
+			}
+		})
+	}
+}
+
+func TestPausedDestination(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.Fail("webhook", 500)
+	fakeClock(t)
+	useConfig(t, testConfig("", `"settings": {"breaker_threshold": 100, "pause_error_rate": 0.5, "pause_min_posts": 2}`))
+	dest := Channel{teamB, chanB}
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi"}
+
+	for i := 0; i < 2; i++ {
+		dest.PostMessage(testContext(t), msg)
+	}
+	if err := dest.PostMessage(testContext(t), msg); err != errPaused {
+		t.Errorf("PostMessage() = %v, want %v", err, errPaused)
+	}
+	if posts := len(slack.Calls("webhook")); posts != 2 {
+		t.Errorf("Made %d posts, want none once paused", posts)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import "time"
+
+// recentAuthor is the last author seen in a source channel and the icon
+// and username resolved for them.
+type recentAuthor struct {
+	user     string
+	icon     string
+	username string
+	seen     time.Time
+}
+
+// recentAuthors holds the recentAuthor of each source channel, so a run of
+// messages from one person needs a single user lookup.
+var recentAuthors = newCache(10000, 0)
+
+// reuseIcon fills in the icon and username from the previous message in
+// the source channel when it had the same author and arrived within
+// IconReuseWindow, reporting whether it did.
+func (msg *slackMessage) reuseIcon(user string) bool {
+	window := config().settings.IconReuseWindow.Duration
+	if window <= 0 {
+		return false
+	}
+	value, present := recentAuthors.Get(msg.Channel.String())
+	if !present {
+		return false
+	}
+	recent := value.(recentAuthor)
+	if recent.user != user || now().Sub(recent.seen) > window {
+		return false
+	}
+	msg.Icon = recent.icon
+	if msg.Username == "" {
+		msg.Username = recent.username
+	}
+	return true
+}
+
+// rememberIcon records msg's author as the most recent in its channel.
+func (msg *slackMessage) rememberIcon(user string) {
+	if config().settings.IconReuseWindow.Duration <= 0 {
+		return
+	}
+	recentAuthors.Set(msg.Channel.String(), recentAuthor{user, msg.Icon, msg.Username, now()})
+}
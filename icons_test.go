@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailingClientSkipsLookups(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		wantCalls int
+	}{
+		{"revoked token", `{"ok":false,"error":"invalid_auth"}`, 2},
+		{"unknown user", `{"ok":false,"error":"user_not_found"}`, 12},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("users.info", func(fakeCall) string { return test.response })
+			useConfig(t, testConfig(`{"fallback_icon": ":robot_face:"}`, `"settings": {"breaker_threshold": 2, "breaker_cooldown": "1h"}`))
+
+			start := time.Now()
+			for i := 0; i < 6; i++ {
+				Bridge(slackMessage{
+					Channel:   Channel{teamA, chanA},
+					UserId:    fmt.Sprintf("U000000%02d", i),
+					Text:      "hi <@U0000000Z>",
+					Timestamp: fmt.Sprintf("%d.000", i+1),
+				})
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Forwarding took %v", elapsed)
+			}
+
+			// Each message looks up its author and its mention, until two
+			// auth failures open the team's breaker.
+			if calls := len(slack.Calls("users.info")); calls != test.wantCalls {
+				t.Errorf("Made %d users.info calls, want %d", calls, test.wantCalls)
+			}
+			posts := slack.Posts()
+			if len(posts) != 6 {
+				t.Fatalf("Got %d posts, want every message forwarded", len(posts))
+			}
+			last := posts[len(posts)-1]
+			if last.Get("icon_emoji") != ":robot_face:" || last.Get("text") != "hi @U0000000Z" {
+				t.Errorf("Posted %v, want the fallback icon and the raw mention", last.Body)
+			}
+		})
+	}
+}
+
+func TestReuseIcon(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  string
+		authors   []string
+		gap       time.Duration
+		wantCalls int
+	}{
+		{"rapid repeat", `{}`, []string{"U0000000A", "U0000000A"}, time.Second, 1},
+		{"different author", `{}`, []string{"U0000000A", "U0000000B"}, time.Second, 2},
+		{"interrupted run", `{}`, []string{"U0000000A", "U0000000B", "U0000000A"}, time.Second, 3},
+		{"after the window", `{}`, []string{"U0000000A", "U0000000A"}, 2 * time.Minute, 2},
+		{"disabled", `{"icon_reuse_window": "0s"}`, []string{"U0000000A", "U0000000A"}, time.Second, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			advance := fakeClock(t)
+
+			for i, author := range test.authors {
+				advance(test.gap)
+				// Drop the user cache so only the icon reuse can skip a lookup.
+				userInfos = newCache(userInfos.max, userInfos.ttl)
+				msg := slackMessage{Channel: Channel{teamA, chanA}, UserId: author, Text: fmt.Sprint("message ", i)}
+				if err := msg.FetchUserIcon(); err != nil {
+					t.Fatal(err)
+				}
+				if want := "https://img/" + author; msg.Icon != want || msg.Username != "name-"+strings.ToLower(author) {
+					t.Errorf("Message %d has icon %v from %v, want %v", i, msg.Icon, msg.Username, want)
+				}
+			}
+			if calls := len(slack.Calls("users.info")); calls != test.wantCalls {
+				t.Errorf("Made %d users.info calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFallbackIcon(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   string
+		response  string
+		wantIcon  string
+		wantEmoji string
+	}{
+		{"emoji", `{"fallback_icon": ":bust_in_silhouette:"}`, `{"ok":false,"error":"user_not_found"}`, "", ":bust_in_silhouette:"},
+		{"image", `{"fallback_icon": "https://img/fallback.png"}`, `{"ok":false,"error":"user_not_found"}`, "https://img/fallback.png", ""},
+		{"no fallback", `{}`, `{"ok":false,"error":"user_not_found"}`, "", ""},
+		{"found", `{"fallback_icon": ":bust_in_silhouette:"}`,
+			`{"ok":true,"user":{"id":"U0000000A","name":"alice","profile":{"image_original":"https://img/alice"}}}`, "https://img/alice", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("users.info", func(fakeCall) string { return test.response })
+			useConfig(t, testConfig(test.options))
+
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, UserId: "U0000000A", Username: "alice", Text: "hi", Timestamp: "1.000"})
+			posts := slack.Posts()
+			if len(posts) != 1 {
+				t.Fatalf("Made %d posts, want 1", len(posts))
+			}
+			if post := posts[0]; post.Get("icon_url") != test.wantIcon || post.Get("icon_emoji") != test.wantEmoji {
+				t.Errorf("Posted with icon %q and emoji %q, want %q and %q", post.Get("icon_url"), post.Get("icon_emoji"), test.wantIcon, test.wantEmoji)
+			}
+		})
+	}
+}
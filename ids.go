@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// idRegexp matches a Slack ID: a one letter type prefix followed by
+// uppercase letters and digits.
+var idRegexp = regexp.MustCompile(`^[A-Z][A-Z0-9]{8,12}$`)
+
+const (
+	teamIdPrefixes    = "TE"
+	channelIdPrefixes = "CGDUW"
+)
+
+// normalizeId trims and uppercases an ID as pasted into the configuration,
+// so stray spaces or lowercase don't make lookups silently miss. IDs that
+// still don't look like one of the given types are rejected.
+func normalizeId(s string, prefixes string, what string) (string, error) {
+	id := strings.ToUpper(strings.TrimSpace(s))
+	if !idRegexp.MatchString(id) || !strings.ContainsRune(prefixes, rune(id[0])) {
+		return "", fmt.Errorf("Invalid %v ID %q", what, s)
+	}
+	return id, nil
+}
+
+// sameId compares configuration IDs or channel references as
+// normalizeId would.
+func sameId(a string, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeId(t *testing.T) {
+	tests := []struct {
+		in       string
+		prefixes string
+		want     string
+		wantErr  bool
+	}{
+		{"C0000000A", channelIdPrefixes, "C0000000A", false},
+		{" c0000000a\t", channelIdPrefixes, "C0000000A", false},
+		{"G0123456789AB", channelIdPrefixes, "G0123456789AB", false},
+		{"U0000000A", channelIdPrefixes, "U0000000A", false},
+		{"T0000000A", teamIdPrefixes, "T0000000A", false},
+		{"E0000000A", teamIdPrefixes, "E0000000A", false},
+		{"T0000000A", channelIdPrefixes, "", true},
+		{"C000000A", channelIdPrefixes, "", true},
+		{"C0123456789ABC", channelIdPrefixes, "", true},
+		{"C00000-0A", channelIdPrefixes, "", true},
+		{"#general", channelIdPrefixes, "", true},
+		{"", channelIdPrefixes, "", true},
+	}
+	for _, test := range tests {
+		got, err := normalizeId(test.in, test.prefixes, "test")
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("normalizeId(%q, %q) = %q, %v; want %q, error %v", test.in, test.prefixes, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestConfigNormalizesIds(t *testing.T) {
+	content := strings.Replace(testConfig(""), `"`+teamA+"/"+chanA+`", "`, `" `+strings.ToLower(teamA+"/"+chanA)+` ", "`, 1)
+	c := useConfig(t, content)
+	if c.channelMap[Channel{teamA, chanA}] == nil {
+		t.Errorf("Channel given in lowercase wasn't normalized: %v", c.channelMap)
+	}
+
+	mistyped := strings.Replace(testConfig(""), `"`+teamA+"/"+chanA+`", "`, `"`+teamA+`/C00000A", "`, 1)
+	fc, err := parseFileConfig([]byte(mistyped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildConfiguration(fc, &ConfigErrors{}); err == nil || !strings.Contains(err.Error(), "C00000A") {
+		t.Errorf("BuildConfiguration with a mistyped ID = %v, want it rejected", err)
+	}
+}
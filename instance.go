@@ -0,0 +1,28 @@
+package main
+
+// instanceHeader carries the bridge's instance ID on generic webhook
+// posts, so a bridge receiving them through /bridge can tell they came
+// from a bridge.
+const instanceHeader = "X-Slackline-Instance"
+
+// instance returns the ID of the bridge instance that forwarded the
+// message carrying metadata, if any.
+func (m *messageMetadata) instance() string {
+	if m == nil || m.EventType != chainEventType {
+		return ""
+	}
+	return m.EventPayload.Instance
+}
+
+// knownInstance reports whether id is this bridge's instance ID or one of
+// its peers'.
+func knownInstance(id string) bool {
+	settings := config().settings
+	return id != "" && (id == settings.InstanceId || settings.PeerInstanceIds.Contains(id))
+}
+
+// Loopback reports whether the message was forwarded by this bridge or a
+// peer instance, which would otherwise echo it back and forth.
+func (msg *slackMessage) Loopback() bool {
+	return knownInstance(msg.Instance)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLoopback(t *testing.T) {
+	settings := `{"instance_id": "bridge-1", "peer_instance_ids": ["bridge-2"]}`
+	tests := []struct {
+		name      string
+		settings  string
+		instance  string
+		wantPosts int
+	}{
+		{"untagged", settings, "", 1},
+		{"own instance", settings, "bridge-1", 0},
+		{"peer instance", settings, "bridge-2", 0},
+		{"unknown instance", settings, "bridge-3", 1},
+		{"no instance ID", `{}`, "bridge-1", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" event", func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			useQueue(t)
+
+			event := `{"type":"message","channel":"` + chanA + `","user":"U0000000A","text":"hi","ts":"1.000",` +
+				`"metadata":{"event_type":"` + chainEventType + `","event_payload":{"chain":["` + teamB + "/" + chanB + `"],"instance":"` + test.instance + `"}}}`
+			handleEvent(eventEnvelope{Type: "event_callback", TeamId: teamA, EventId: "Ev1", Event: json.RawMessage(event)})
+			queue.Flush(testContext(t))
+
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+			if dropped := stats.Snapshot(false).Dropped[dropLoopback]; dropped != int64(1-test.wantPosts) {
+				t.Errorf("Counted %d loopback drops", dropped)
+			}
+		})
+		t.Run(test.name+" webhook", func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			useQueue(t)
+
+			req := postForm("/bridge", url.Values{
+				"token":      {"out-a"},
+				"team_id":    {teamA},
+				"channel_id": {chanA},
+				"user_name":  {"alice"},
+				"text":       {"hi"},
+				"timestamp":  {"1488369600.000100"},
+			})
+			if test.instance != "" {
+				req.Header.Set(instanceHeader, test.instance)
+			}
+			if w := serveRequest(bridgeHandler, "/bridge", req); w.Code != 200 {
+				t.Fatalf("bridgeHandler returned %v", w.Code)
+			}
+			queue.Flush(testContext(t))
+
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
+
+func TestInstanceTagged(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     string
+	}{
+		{"instance ID", `{"instance_id": "bridge-1"}`, "bridge-1"},
+		{"no instance ID", `{}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			headers := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers <- r.Header.Get(instanceHeader)
+			}))
+			defer server.Close()
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi"}
+			if !msg.ExtendChain() {
+				t.Fatalf("ExtendChain refused the message")
+			}
+			if got := msg.Metadata.instance(); got != test.want {
+				t.Errorf("Metadata carries instance %q, want %q", got, test.want)
+			}
+			if err := (WebhookOptions{URL: server.URL}).Post(testContext(t), msg); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-headers:
+				if got != test.want {
+					t.Errorf("Sent %v %q, want %q", instanceHeader, got, test.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Webhook not called")
+			}
+		})
+	}
+}
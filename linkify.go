@@ -0,0 +1,50 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// markupRegexp matches Slack's <...> markup, which linkify leaves alone.
+var markupRegexp = regexp.MustCompile(`<[^>]*>`)
+
+var bareURLRegexp = regexp.MustCompile(`https?://[^\s<>]+[^\s<>.,;:!?'")\]]`)
+
+// Linkify wraps bare URLs in the text in Slack's <url> link markup for
+// groups with Linkify, skipping URLs that are already in markup.
+func (msg *slackMessage) Linkify() {
+	if !msg.Group().Options.Linkify || !strings.Contains(msg.Text, "://") {
+		return
+	}
+
+	var text strings.Builder
+	last := 0
+	for _, match := range markupRegexp.FindAllStringIndex(msg.Text, -1) {
+		text.WriteString(bareURLRegexp.ReplaceAllString(msg.Text[last:match[0]], "<$0>"))
+		text.WriteString(msg.Text[match[0]:match[1]])
+		last = match[1]
+	}
+	text.WriteString(bareURLRegexp.ReplaceAllString(msg.Text[last:], "<$0>"))
+	msg.Text = text.String()
+}
+
+const (
+	linksBoth = "both"
+	linksText = "text"
+	linksURL  = "url"
+)
+
+// labelledLinkRegexp matches links with display text, <url|text>, but not
+// mentions or channel links.
+var labelledLinkRegexp = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9+.-]*:[^|>]*)\|([^>]*)>`)
+
+// RenderLinks rewrites links with display text for the group's
+// LinkDisplay: "text" keeps only the text and "url" only the link.
+func (msg *slackMessage) RenderLinks() {
+	switch msg.Group().Options.LinkDisplay {
+	case linksText:
+		msg.Text = labelledLinkRegexp.ReplaceAllString(msg.Text, "$2")
+	case linksURL:
+		msg.Text = labelledLinkRegexp.ReplaceAllString(msg.Text, "<$1>")
+	}
+}
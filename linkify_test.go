@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLinkify(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		text    string
+		want    string
+	}{
+		{"bare URL", `{"linkify": true}`, "see https://example.com/a?b=1", "see <https://example.com/a?b=1>"},
+		{"trailing punctuation", `{"linkify": true}`, "see http://example.com/docs.", "see <http://example.com/docs>."},
+		{"in parentheses", `{"linkify": true}`, "docs (https://example.com/x)", "docs (<https://example.com/x>)"},
+		{"already linked", `{"linkify": true}`, "see <https://example.com|the docs>", "see <https://example.com|the docs>"},
+		{"linked and bare", `{"linkify": true}`, "<https://a.example.com> and https://b.example.com",
+			"<https://a.example.com> and <https://b.example.com>"},
+		{"mentions untouched", `{"linkify": true}`, "<@U0000000A> no links", "<@U0000000A> no links"},
+		{"disabled", `{}`, "see https://example.com", "see https://example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(test.options))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: test.text}
+			msg.Linkify()
+			if msg.Text != test.want {
+				t.Errorf("Linkify(%q) = %q, want %q", test.text, msg.Text, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderLinks(t *testing.T) {
+	text := "see <https://example.com/docs|the docs>, <mailto:ops@example.com|ops> and <https://example.com/bare>"
+	tests := []struct {
+		name    string
+		display string
+		text    string
+		want    string
+	}{
+		{"default", "", text, text},
+		{"both", linksBoth, text, text},
+		{"text", linksText, text, "see the docs, ops and <https://example.com/bare>"},
+		{"url", linksURL, text, "see <https://example.com/docs>, <mailto:ops@example.com> and <https://example.com/bare>"},
+		{"mentions untouched", linksText, "<@U0000000A|alice> in <#C0000000A|general>", "<@U0000000A|alice> in <#C0000000A|general>"},
+		{"user groups untouched", linksURL, "<!subteam^S0000000A|@ops>", "<!subteam^S0000000A|@ops>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(`{"link_display": "`+test.display+`"}`))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: test.text}
+			msg.RenderLinks()
+			if msg.Text != test.want {
+				t.Errorf("RenderLinks(%q) = %q, want %q", test.text, msg.Text, test.want)
+			}
+		})
+	}
+}
+
+func TestLinkDisplayOption(t *testing.T) {
+	tests := []struct {
+		display string
+		wantErr bool
+	}{
+		{linksBoth, false},
+		{linksText, false},
+		{linksURL, false},
+		{"markdown", true},
+	}
+	for _, test := range tests {
+		if _, err := NewGroup(nil, GroupOptions{LinkDisplay: test.display}); (err != nil) != test.wantErr {
+			t.Errorf("NewGroup() with link_display %q = %v, want error %v", test.display, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingFile is a log file that is rotated once it reaches maxSize bytes
+// or has been open for maxAge, keeping keep old files as path.1 (the
+// newest) to path.N. Writes are safe for concurrent use.
+type rotatingFile struct {
+	sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	keep    int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, keep int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), now()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	os.Remove(fmt.Sprintf("%v.%v", f.path, f.keep))
+	for i := f.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%v.%v", f.path, i), fmt.Sprintf("%v.%v", f.path, i+1))
+	}
+	if f.keep > 0 {
+		os.Rename(f.path, f.path+".1")
+	} else {
+		os.Remove(f.path)
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	full := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	old := f.maxAge > 0 && now().Sub(f.opened) >= f.maxAge
+	if full || old {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// jsonLines writes each log line to w as a JSON object with the time and
+// message.
+type jsonLines struct {
+	w io.Writer
+}
+
+func (j jsonLines) Write(p []byte) (int, error) {
+	line, err := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		Message string    `json:"message"`
+	}{now(), strings.TrimSuffix(string(p), "\n")})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := j.w.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetupLogFile also writes the log to the file named by the log_file
+// setting, rotating it by size and age, as JSON lines with log_json.
+func SetupLogFile(settings Settings) error {
+	if settings.LogFile == "" {
+		return nil
+	}
+	file, err := openRotatingFile(settings.LogFile, settings.LogMaxSize, settings.LogMaxAge.Duration, settings.LogKeep)
+	if err != nil {
+		return err
+	}
+	var sink io.Writer = file
+	if settings.LogJSON {
+		sink = jsonLines{file}
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, sink))
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSize   int64
+		maxAge    time.Duration
+		keep      int
+		lines     int
+		gap       time.Duration
+		wantFiles []string
+	}{
+		{"under the size limit", 1000, 0, 3, 5, 0, []string{"log"}},
+		{"past the size limit", 15, 0, 3, 5, 0, []string{"log", "log.1", "log.2"}},
+		{"old files dropped", 10, 0, 2, 5, 0, []string{"log", "log.1", "log.2"}},
+		{"no old files kept", 10, 0, 0, 5, 0, []string{"log"}},
+		{"past the age limit", 0, time.Hour, 1, 3, 40 * time.Minute, []string{"log", "log.1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "log")
+			f, err := openRotatingFile(path, test.maxSize, test.maxAge, test.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.file.Close()
+
+			for i := 0; i < test.lines; i++ {
+				advance(test.gap)
+				fmt.Fprintf(f, "line %d\n", i)
+			}
+
+			entries, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, entry := range entries {
+				files = append(files, entry.Name())
+			}
+			if strings.Join(files, ",") != strings.Join(test.wantFiles, ",") {
+				t.Errorf("Wrote files %v, want %v", files, test.wantFiles)
+			}
+			current, _ := ioutil.ReadFile(path)
+			if want := fmt.Sprintf("line %d\n", test.lines-1); !strings.HasSuffix(string(current), want) {
+				t.Errorf("Current file is %q, want it to end with the last line", current)
+			}
+			if test.maxSize > 0 && int64(len(current)) > test.maxSize {
+				t.Errorf("Current file has %d bytes, over the limit of %d", len(current), test.maxSize)
+			}
+		})
+	}
+}
+
+func TestRotatingFileConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	f, err := openRotatingFile(path, 1<<20, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.file.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				fmt.Fprintf(f, "writer %02d line %02d\n", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	content, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("Wrote %d lines, want 1000", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) != len("writer 00 line 00") {
+			t.Errorf("Interleaved line %q", line)
+		}
+	}
+}
+
+func TestSetupLogFile(t *testing.T) {
+	tests := []struct {
+		name string
+		json bool
+	}{
+		{"text", false},
+		{"json", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeClock(t)
+			path := filepath.Join(t.TempDir(), "slackline.log")
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+			settings := DefaultSettings()
+			settings.LogFile, settings.LogJSON = path, test.json
+			if err := SetupLogFile(settings); err != nil {
+				t.Fatal(err)
+			}
+
+			log.Printf("Forwarded %v", "hello")
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.json {
+				if !strings.HasSuffix(string(content), "Forwarded hello\n") {
+					t.Errorf("Logged %q", content)
+				}
+				return
+			}
+			var line struct {
+				Time    time.Time
+				Message string
+			}
+			if err := json.Unmarshal(content, &line); err != nil {
+				t.Fatalf("Logged %q: %v", content, err)
+			}
+			if !strings.HasSuffix(line.Message, "Forwarded hello") || !line.Time.Equal(now()) {
+				t.Errorf("Logged %+v", line)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Slack's Web API rate limit tiers, in calls per minute per team.
+const (
+	tier2 = 20
+	tier3 = 50
+	tier4 = 100
+)
+
+// methodTiers is the budget of each Web API method the bridge calls.
+// chat.postMessage is limited per channel by Slack, around one post a
+// second; a team-wide budget of a tier 4 method keeps busy bridges under
+// Slack's limit without pacing any single channel. Other methods get
+// tier 3.
+var methodTiers = map[string]int{
+	"auth.test":             tier4,
+	"chat.delete":           tier3,
+	"chat.getPermalink":     tier4,
+	"chat.postEphemeral":    tier4,
+	"chat.postMessage":      tier4,
+	"chat.update":           tier3,
+	"conversations.history": tier3,
+	"conversations.info":    tier3,
+	"conversations.join":    tier3,
+	"conversations.members": tier4,
+	"conversations.open":    tier3,
+	"conversations.replies": tier3,
+	"files.sharedPublicURL": tier3,
+	"files.upload":          tier2,
+	"pins.add":              tier2,
+	"reactions.add":         tier3,
+	"usergroups.list":       tier2,
+	"users.info":            tier4,
+}
+
+// methodBucket is a token bucket holding up to a minute's budget of calls
+// to one method with one team's tokens.
+type methodBucket struct {
+	tokens float64
+	filled time.Time
+}
+
+// MethodStats counts the calls made to one Web API method, across teams.
+type MethodStats struct {
+	Calls       int64   `json:"calls"`
+	RateLimited int64   `json:"rate_limited"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+type methodRegistry struct {
+	sync.Mutex
+	buckets map[string]*methodBucket
+	stats   map[string]*MethodStats
+}
+
+var methodLimits = &methodRegistry{buckets: make(map[string]*methodBucket), stats: make(map[string]*MethodStats)}
+
+// budget is the calls per minute allowed to method, zero meaning no limit.
+func budget(method string) int {
+	settings := config().settings
+	if !settings.MethodTiers {
+		return 0
+	}
+	if limit, present := settings.MethodRateLimits[method]; present {
+		return limit
+	}
+	if tier, present := methodTiers[method]; present {
+		return tier
+	}
+	return tier3
+}
+
+func (r *methodRegistry) methodStats(method string) *MethodStats {
+	s, present := r.stats[method]
+	if !present {
+		s = &MethodStats{}
+		r.stats[method] = s
+	}
+	return s
+}
+
+// Wait blocks until the team may call method within the method's budget,
+// reporting false if ctx expired first, when the call is given back.
+func (r *methodRegistry) Wait(ctx context.Context, team string, method string) bool {
+	limit := budget(method)
+
+	r.Lock()
+	stats := r.methodStats(method)
+	stats.Calls++
+	if limit <= 0 {
+		r.Unlock()
+		return true
+	}
+	key := team + "/" + method
+	bucket, present := r.buckets[key]
+	if !present {
+		bucket = &methodBucket{tokens: float64(limit), filled: now()}
+		r.buckets[key] = bucket
+	}
+	perSecond := float64(limit) / 60
+	bucket.tokens += now().Sub(bucket.filled).Seconds() * perSecond
+	if bucket.tokens > float64(limit) {
+		bucket.tokens = float64(limit)
+	}
+	bucket.filled = now()
+	bucket.tokens--
+	var wait time.Duration
+	if bucket.tokens < 0 {
+		wait = time.Duration(-bucket.tokens / perSecond * float64(time.Second))
+		stats.WaitSeconds += wait.Seconds()
+	}
+	r.Unlock()
+
+	if !sleep(ctx, wait) {
+		r.Lock()
+		bucket.tokens++
+		r.Unlock()
+		return false
+	}
+	return true
+}
+
+// Record counts a call to method that Slack rate limited.
+func (r *methodRegistry) Record(method string, err error) {
+	if _, limited := err.(*rateLimitedError); !limited {
+		if apiErr, ok := err.(*apiError); !ok || apiErr.Code != "ratelimited" {
+			return
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.methodStats(method).RateLimited++
+}
+
+// Snapshot returns a copy of each method's counts.
+func (r *methodRegistry) Snapshot() map[string]MethodStats {
+	r.Lock()
+	defer r.Unlock()
+
+	snapshot := make(map[string]MethodStats, len(r.stats))
+	for method, s := range r.stats {
+		snapshot[method] = *s
+	}
+	return snapshot
+}
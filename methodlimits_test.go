@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMethodLimits(t *testing.T) {
+	type call struct {
+		team   string
+		method string
+	}
+	limits := `{"method_rate_limits": {"conversations.info": 2, "users.info": 2}}`
+	tests := []struct {
+		name          string
+		settings      string
+		before        []call
+		gap           time.Duration
+		check         call
+		wantThrottled bool
+	}{
+		{"within budget", limits, []call{{teamA, "conversations.info"}}, 0, call{teamA, "conversations.info"}, false},
+		{"over budget", limits, []call{{teamA, "conversations.info"}, {teamA, "conversations.info"}}, 0, call{teamA, "conversations.info"}, true},
+		{"another method", limits, []call{{teamA, "conversations.info"}, {teamA, "conversations.info"}}, 0, call{teamA, "users.info"}, false},
+		{"another team", limits, []call{{teamA, "conversations.info"}, {teamA, "conversations.info"}}, 0, call{teamB, "conversations.info"}, false},
+		{"refilled", limits, []call{{teamA, "conversations.info"}, {teamA, "conversations.info"}}, 30 * time.Second, call{teamA, "conversations.info"}, false},
+		{"not yet refilled", limits, []call{{teamA, "conversations.info"}, {teamA, "conversations.info"}}, 20 * time.Second, call{teamA, "conversations.info"}, true},
+		{"disabled", `{"method_tiers": false, "method_rate_limits": {"conversations.info": 2}}`,
+			[]call{{teamA, "conversations.info"}, {teamA, "conversations.info"}}, 0, call{teamA, "conversations.info"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"settings": `+test.settings))
+			advance := fakeClock(t)
+
+			for _, c := range test.before {
+				if !methodLimits.Wait(context.Background(), c.team, c.method) {
+					t.Fatalf("Call to %v within the budget waited", c.method)
+				}
+			}
+			advance(test.gap)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if got := methodLimits.Wait(ctx, test.check.team, test.check.method); got == test.wantThrottled {
+				t.Errorf("Wait(%v, %v) = %v, want throttled %v", test.check.team, test.check.method, got, test.wantThrottled)
+			}
+			s := stats.Snapshot(false).Methods[test.check.method]
+			if waited := s.WaitSeconds > 0; waited != test.wantThrottled {
+				t.Errorf("%v waited %vs, want waiting %v", test.check.method, s.WaitSeconds, test.wantThrottled)
+			}
+		})
+	}
+}
+
+func TestMethodLimitsGiveBackExpiredCalls(t *testing.T) {
+	useConfig(t, testConfig("", `"settings": {"method_rate_limits": {"conversations.info": 1}}`))
+	fakeClock(t)
+
+	methodLimits.Wait(context.Background(), teamA, "conversations.info")
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		methodLimits.Wait(ctx, teamA, "conversations.info")
+		cancel()
+	}
+	// Calls that gave up don't push the next one further out.
+	methodLimits.Lock()
+	tokens := methodLimits.buckets[teamA+"/conversations.info"].tokens
+	methodLimits.Unlock()
+	if tokens != 0 {
+		t.Errorf("Bucket holds %v tokens after expired calls, want 0", tokens)
+	}
+}
+
+func TestMethodStats(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		wantRateLimited int64
+	}{
+		{"success", nil, 0},
+		{"rate limited", &rateLimitedError{Err: errors.New("rate_limited")}, 1},
+		{"ratelimited response", &apiError{Method: "users.info", Code: "ratelimited"}, 1},
+		{"other error", &apiError{Method: "users.info", Code: "user_not_found"}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(""))
+			methodLimits.Wait(context.Background(), teamA, "users.info")
+			methodLimits.Record("users.info", test.err)
+
+			s := stats.Snapshot(false).Methods["users.info"]
+			if s.Calls != 1 || s.RateLimited != test.wantRateLimited {
+				t.Errorf("Counted %d calls, %d rate limited; want 1, %d", s.Calls, s.RateLimited, test.wantRateLimited)
+			}
+		})
+	}
+}
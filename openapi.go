@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminRoute is an endpoint under /admin. The routes are registered and
+// described in the OpenAPI spec from adminRoutes, so the two can't drift.
+type adminRoute struct {
+	Method  string
+	Path    string
+	Summary string
+	Handler gin.HandlerFunc
+}
+
+var adminRoutes []adminRoute
+
+func init() {
+	// Assigned here because openAPIHandler reads adminRoutes.
+	adminRoutes = []adminRoute{
+		{"POST", "/preview", "Render a sample message for each destination of its group", previewHandler},
+		{"GET", "/dead-letters", "List messages that failed every delivery attempt", deadLettersHandler},
+		{"POST", "/dead-letters/:id/replay", "Retry delivery of a dead-lettered message", replayHandler},
+		{"GET", "/capture", "Show which outbound posts are logged", captureHandler},
+		{"PUT", "/capture", "Choose which outbound posts are logged", setCaptureHandler},
+		{"GET", "/openapi.json", "Describe the admin API", openAPIHandler},
+	}
+}
+
+// registerAdminRoutes adds every admin route to the group.
+func registerAdminRoutes(group *gin.RouterGroup) {
+	for _, route := range adminRoutes {
+		group.Handle(route.Method, route.Path, route.Handler)
+	}
+}
+
+// openAPIPath converts a gin path such as /dead-letters/:id/replay to its
+// OpenAPI form, /dead-letters/{id}/replay, returning the parameter names.
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// openAPISpec describes the admin routes as an OpenAPI 3 document.
+func openAPISpec() gin.H {
+	paths := gin.H{}
+	for _, route := range adminRoutes {
+		path, params := openAPIPath("/admin" + route.Path)
+		operation := gin.H{
+			"summary":   route.Summary,
+			"security":  []gin.H{{"bearer": []string{}}},
+			"responses": gin.H{"200": gin.H{"description": "OK"}, "403": gin.H{"description": "Missing or invalid admin token"}},
+		}
+		if len(params) > 0 {
+			parameters := make([]gin.H, len(params))
+			for i, name := range params {
+				parameters[i] = gin.H{"name": name, "in": "path", "required": true, "schema": gin.H{"type": "string"}}
+			}
+			operation["parameters"] = parameters
+		}
+		methods, present := paths[path].(gin.H)
+		if !present {
+			methods = gin.H{}
+			paths[path] = methods
+		}
+		methods[strings.ToLower(route.Method)] = operation
+	}
+
+	return gin.H{
+		"openapi": "3.0.0",
+		"info":    gin.H{"title": "slackline admin API", "version": "1"},
+		"paths":   paths,
+		"components": gin.H{
+			"securitySchemes": gin.H{"bearer": gin.H{"type": "http", "scheme": "bearer"}},
+		},
+	}
+}
+
+func openAPIHandler(c *gin.Context) {
+	c.JSON(200, openAPISpec())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		path       string
+		want       string
+		wantParams []string
+	}{
+		{"/admin/preview", "/admin/preview", nil},
+		{"/admin/dead-letters/:id/replay", "/admin/dead-letters/{id}/replay", []string{"id"}},
+		{"/admin/:team/:channel", "/admin/{team}/{channel}", []string{"team", "channel"}},
+	}
+	for _, test := range tests {
+		got, params := openAPIPath(test.path)
+		if got != test.want || !reflect.DeepEqual(params, test.wantParams) {
+			t.Errorf("openAPIPath(%q) = %q, %v, want %q, %v", test.path, got, params, test.want, test.wantParams)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerAdminRoutes(router.Group("/admin"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/openapi.json", nil))
+	if w.Code != 200 {
+		t.Fatalf("openAPIHandler returned %v", w.Code)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Summary    string
+			Parameters []struct{ Name string }
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method     string
+		path       string
+		wantParams int
+	}{
+		{"post", "/admin/preview", 0},
+		{"get", "/admin/dead-letters", 0},
+		{"post", "/admin/dead-letters/{id}/replay", 1},
+		{"get", "/admin/capture", 0},
+		{"put", "/admin/capture", 0},
+		{"get", "/admin/openapi.json", 0},
+	}
+	if len(tests) != len(adminRoutes) {
+		t.Errorf("Spec test covers %d routes, want all %d admin routes", len(tests), len(adminRoutes))
+	}
+	for _, test := range tests {
+		operation, present := spec.Paths[test.path][test.method]
+		if !present {
+			t.Errorf("Spec is missing %v %v", test.method, test.path)
+			continue
+		}
+		if operation.Summary == "" || len(operation.Parameters) != test.wantParams {
+			t.Errorf("%v %v has summary %q and %d parameters, want %d", test.method, test.path, operation.Summary, len(operation.Parameters), test.wantParams)
+		}
+	}
+}
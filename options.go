@@ -0,0 +1,684 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Settings holds process-wide options, given in SLACKLINE_SETTINGS using
+// the same key=value format as group options.
+type Settings struct {
+	// BreakerThreshold is the number of consecutive failures after which
+	// a destination's circuit breaker opens.
+	BreakerThreshold int `json:"breaker_threshold"`
+	// BreakerCooldown is how long an open breaker waits before letting a
+	// trial post through.
+	BreakerCooldown Duration `json:"breaker_cooldown"`
+	// EventsToken is the legacy verification token Slack sends with Events
+	// API requests, accepted alongside SigningSecrets. Both apply to teams
+	// that don't set their own.
+	EventsToken Credentials `json:"events_token"`
+	// SigningSecrets verify the signature of Events API requests.
+	SigningSecrets Credentials `json:"signing_secrets"`
+	// AuthFailOpen processes requests that fail verification instead of
+	// dropping them, logging each one.
+	AuthFailOpen bool `json:"auth_fail_open"`
+	// IgnoreBotIds lists the bot IDs of the bridge's own integrations, so
+	// groups forwarding bot messages don't echo mirrored posts.
+	IgnoreBotIds StringList `json:"ignore_bot_ids"`
+	// ShutdownGrace bounds how long shutdown waits for in-flight requests
+	// and pending work to be flushed.
+	ShutdownGrace Duration `json:"shutdown_grace"`
+	// TeamConcurrency is the default bound on concurrent Slack calls made
+	// with one team's tokens. Zero means unbounded.
+	TeamConcurrency int `json:"team_concurrency"`
+	// HTTPIngress serves the /bridge and /events endpoints.
+	HTTPIngress bool `json:"http_ingress"`
+	// AppToken is an app-level token; when set, events are also received
+	// over Socket Mode.
+	AppToken string `json:"app_token"`
+	// MaxMessageAge drops messages older than this, such as late webhook
+	// retries. Zero disables the check.
+	MaxMessageAge Duration `json:"max_message_age"`
+	// DedupeWindow is how long delivered messages are remembered so that
+	// retries aren't forwarded twice.
+	DedupeWindow Duration `json:"dedupe_window"`
+	// DedupeScope is "global" to drop any repeat of a source message, or
+	// "destination" to deliver it to each destination once, so a message
+	// that reaches the bridge through several paths still gets to every
+	// destination. Either way, loops are broken by the bridge's own posts
+	// being bot messages, which aren't forwarded unless the group sets
+	// forward_bots; groups that do should ignore the bridge's bot ID.
+	DedupeScope string `json:"dedupe_scope"`
+	// QueueSize bounds the messages waiting to be forwarded; messages
+	// arriving while it is full are dropped.
+	QueueSize int `json:"queue_size"`
+	// Workers is the number of messages forwarded concurrently.
+	Workers int `json:"workers"`
+	// InboundHeader names a header that must be present on requests to the
+	// ingress endpoints, with the value InboundHeaderValue.
+	InboundHeader      string `json:"inbound_header"`
+	InboundHeaderValue string `json:"inbound_header_value"`
+	// FanoutTimeout bounds the time spent forwarding one message to all of
+	// its destinations, independently of the request that delivered it.
+	FanoutTimeout Duration `json:"fanout_timeout"`
+	// StatsEndpoint serves message counters as JSON on GET /stats. Passing
+	// reset=true zeroes them after reading.
+	StatsEndpoint bool `json:"stats_endpoint"`
+	// AdminTokens are the bearer tokens accepted by the /admin endpoints,
+	// which are disabled when none are set.
+	AdminTokens Credentials `json:"admin_tokens"`
+	// PostRetries is how many times a failed post to a destination is
+	// retried, waiting RetryDelay before the first retry and doubling it
+	// for each one after.
+	PostRetries int      `json:"post_retries"`
+	RetryDelay  Duration `json:"retry_delay"`
+	// DeadLetterSize bounds the in-memory queue of messages that failed
+	// every retry, listed and replayed through /admin/dead-letters. Zero
+	// disables it. DeadLetterFile, when set, also appends them to a file.
+	DeadLetterSize int    `json:"dead_letter_size"`
+	DeadLetterFile string `json:"dead_letter_file"`
+	// DefaultColor is the attachment color for teams without one. When
+	// neither is set attachments keep their own color.
+	DefaultColor string `json:"default_color"`
+	// BotMentions controls messages mentioning the bridge itself:
+	// "command" runs them as commands, "forward" forwards them like any
+	// other message and "drop" ignores them.
+	BotMentions string `json:"bot_mentions"`
+	// MaxHops drops messages that have been forwarded through more than
+	// this many channels, as recorded in their message metadata. Zero
+	// disables the limit.
+	MaxHops int `json:"max_hops"`
+	// Timezone is the IANA timezone used to render dates for teams without
+	// their own, UTC by default.
+	Timezone string `json:"timezone"`
+	// TranslatorURL is a LibreTranslate-compatible endpoint used for
+	// destinations with a language, authenticated with TranslatorKey.
+	// Text is forwarded untranslated when it is unset.
+	TranslatorURL string `json:"translator_url"`
+	TranslatorKey string `json:"translator_key"`
+	// IconReuseWindow reuses the icon looked up for a message's author when
+	// the previous message in the channel was theirs and arrived within
+	// the window. Zero looks up every message's author.
+	IconReuseWindow Duration `json:"icon_reuse_window"`
+	// ArchiveCheckInterval is how often each destination is checked for
+	// being archived. Posts to archived destinations are skipped until a
+	// later check finds them unarchived. Zero disables the check.
+	ArchiveCheckInterval Duration `json:"archive_check_interval"`
+	// MaxOutboundCalls bounds the concurrent Slack, webhook and translator
+	// calls made across all teams, on top of team_concurrency. Zero means
+	// unbounded. Changes take effect on restart.
+	MaxOutboundCalls int `json:"max_outbound_calls"`
+	// DuplicateChannels is the policy for a channel listed more than once
+	// in the same group: "reject" fails the entry like any invalid one and
+	// "dedupe" ignores the repeats with a warning. A channel in two
+	// different groups is always rejected.
+	DuplicateChannels string `json:"duplicate_channels"`
+	// PauseErrorRate, between 0 and 1, pauses forwarding to a destination
+	// once that share of its posts within PauseWindow has failed, counting
+	// at least PauseMinPosts posts. After PauseCooldown posts resume as
+	// probes, and forwarding resumes once a few succeed in a row. Unlike
+	// the breaker it catches destinations failing intermittently. Zero
+	// disables pausing.
+	PauseErrorRate float64  `json:"pause_error_rate"`
+	PauseWindow    Duration `json:"pause_window"`
+	PauseMinPosts  int      `json:"pause_min_posts"`
+	PauseCooldown  Duration `json:"pause_cooldown"`
+	// LogFile also writes the log to this file, as JSON lines with LogJSON.
+	// The file is rotated once it reaches LogMaxSize bytes or is LogMaxAge
+	// old, keeping LogKeep old files as LogFile.1 to LogFile.N. Changes
+	// take effect on restart.
+	LogFile    string   `json:"log_file"`
+	LogJSON    bool     `json:"log_json"`
+	LogMaxSize int64    `json:"log_max_size"`
+	LogMaxAge  Duration `json:"log_max_age"`
+	LogKeep    int      `json:"log_keep"`
+	// TokenCheck is what happens when a team's API token fails auth.test
+	// on loading the configuration: "fail" fails loading, "warn" logs it
+	// and "off" skips the check, leaving the bridge's own user unknown so
+	// mentions of it aren't recognized. Teams are checked at once, each
+	// within TokenCheckTimeout.
+	TokenCheck        string   `json:"token_check"`
+	TokenCheckTimeout Duration `json:"token_check_timeout"`
+	// CaptureRate, between 0 and 1, logs that fraction of outbound posts
+	// in full, with Slack's response and tokens masked, as are all posts
+	// to CaptureDestinations (TID/CID). Both can be changed at runtime
+	// through /admin/capture.
+	CaptureRate         float64    `json:"capture_rate"`
+	CaptureDestinations StringList `json:"capture_destinations"`
+	// AuditBuffer is how many audit events may wait to be sent to audit
+	// webhooks. Changes take effect on restart.
+	AuditBuffer int `json:"audit_buffer"`
+	// MethodTiers paces Web API calls to keep each team within the rate
+	// limit tier of each method, so one busy method doesn't hold up the
+	// others. MethodRateLimits overrides a method's calls per minute, zero
+	// meaning no limit.
+	MethodTiers      bool           `json:"method_tiers"`
+	MethodRateLimits map[string]int `json:"method_rate_limits,omitempty"`
+	// StorePath keeps the bridge's state, such as the messages seen within
+	// the dedupe window and the channels already backfilled, in this file
+	// so it survives restarts. It is kept in memory when unset. Changes
+	// take effect on restart.
+	StorePath string `json:"store_path"`
+	// InstanceId identifies this bridge on the messages it forwards, in
+	// their metadata and in a header on generic webhook posts. Messages
+	// carrying it, or one of PeerInstanceIds, are dropped, so instances
+	// bridging the same channels don't echo each other.
+	InstanceId      string     `json:"instance_id"`
+	PeerInstanceIds StringList `json:"peer_instance_ids"`
+	// Warmup looks up whether the mapped channels are archived or shared,
+	// their channel icons and up to WarmupMembers of each one's members on
+	// startup, WarmupConcurrency at a time, so the first messages find
+	// them cached.
+	Warmup            bool `json:"warmup"`
+	WarmupMembers     int  `json:"warmup_members"`
+	WarmupConcurrency int  `json:"warmup_concurrency"`
+}
+
+const (
+	tokenCheckFail = "fail"
+	tokenCheckWarn = "warn"
+	tokenCheckOff  = "off"
+)
+
+const (
+	duplicatesReject = "reject"
+	duplicatesDedupe = "dedupe"
+)
+
+func DefaultSettings() Settings {
+	return Settings{
+		BreakerThreshold:     5,
+		BreakerCooldown:      Duration{time.Minute},
+		ShutdownGrace:        Duration{10 * time.Second},
+		TeamConcurrency:      10,
+		HTTPIngress:          true,
+		DedupeWindow:         Duration{10 * time.Minute},
+		DedupeScope:          dedupeGlobal,
+		QueueSize:            1000,
+		Workers:              4,
+		FanoutTimeout:        Duration{30 * time.Second},
+		StatsEndpoint:        true,
+		PostRetries:          2,
+		RetryDelay:           Duration{time.Second},
+		DeadLetterSize:       100,
+		BotMentions:          botMentionsCommand,
+		MaxHops:              5,
+		Timezone:             "UTC",
+		IconReuseWindow:      Duration{time.Minute},
+		ArchiveCheckInterval: Duration{10 * time.Minute},
+		MaxOutboundCalls:     100,
+		DuplicateChannels:    duplicatesReject,
+		PauseWindow:          Duration{5 * time.Minute},
+		PauseMinPosts:        10,
+		PauseCooldown:        Duration{10 * time.Minute},
+		LogMaxSize:           100 << 20,
+		LogMaxAge:            Duration{24 * time.Hour},
+		LogKeep:              7,
+		TokenCheck:           tokenCheckFail,
+		TokenCheckTimeout:    Duration{10 * time.Second},
+		AuditBuffer:          1000,
+		MethodTiers:          true,
+		WarmupMembers:        200,
+		WarmupConcurrency:    4,
+	}
+}
+
+// GroupOptions holds the per-group settings for a set of bridged channels.
+// Options are decoded from JSON, so each field's json tag is also its key in
+// the legacy environment format.
+type GroupOptions struct {
+	// Threads mirrors thread replies into the matching destination thread.
+	// This requires posting through the Web API so destination timestamps
+	// can be recorded.
+	Threads bool `json:"threads"`
+	// ReplyBroadcast also sends mirrored thread replies to the destination
+	// channel.
+	ReplyBroadcast bool `json:"reply_broadcast"`
+	// ReplyCounts adds the thread's reply count to mirrored thread roots,
+	// updated once no reply has arrived for ReplyCountDelay (30s by
+	// default). Only roots posted through the Web API can be updated.
+	ReplyCounts     bool     `json:"reply_counts"`
+	ReplyCountDelay Duration `json:"reply_count_delay"`
+	// ForwardBots forwards messages posted by bots and integrations received
+	// through the Events API.
+	ForwardBots bool `json:"forward_bots"`
+	// BotAttachmentText forwards bot messages that have no text, only
+	// attachments, with the attachments rendered as their text, for
+	// integrations whose attachments don't show well once bridged.
+	BotAttachmentText bool `json:"bot_attachment_text"`
+	// FlattenAttachments renders attachments into the message text instead
+	// of forwarding them as attachments.
+	FlattenAttachments bool `json:"flatten_attachments"`
+	// AppendPermalink links forwarded messages back to the source message.
+	AppendPermalink bool `json:"append_permalink"`
+	// ConfirmForwards tells the author, in an ephemeral message, where their
+	// message was mirrored to. Batched destinations are confirmed
+	// separately, once their batch is posted.
+	ConfirmForwards bool `json:"confirm_forwards"`
+	// MirrorReactions adds reactions made on forwarded messages to the
+	// source message, for example as approvals. Only messages posted
+	// through the Web API can be traced back to their source.
+	MirrorReactions bool `json:"mirror_reactions"`
+	// MirrorPins posts a note to the rest of the group when a message is
+	// pinned or unpinned, in the thread of its mirror when known. This
+	// needs the pin_added and pin_removed events.
+	MirrorPins bool `json:"mirror_pins"`
+	// SampleRate, between 0 and 1, forwards only that fraction of the
+	// group's messages. All messages are forwarded when it is unset.
+	SampleRate *float64 `json:"sample_rate,omitempty"`
+	// MaxInFlight limits the group's messages queued or being forwarded at
+	// once. Messages beyond it are dropped. Zero means no limit.
+	MaxInFlight int `json:"max_in_flight"`
+	// FanoutConcurrency is how many of the group's destinations a message
+	// is posted to at once, one by default.
+	FanoutConcurrency int `json:"fanout_concurrency"`
+	// FlapInterval drops messages arriving within the interval of the last
+	// message forwarded from the same channel when their words are at
+	// least FlapSimilarity (0.9 by default, 1 meaning identical) alike,
+	// collapsing alerts that flap. Zero disables the check.
+	FlapInterval   Duration `json:"flap_interval"`
+	FlapSimilarity float64  `json:"flap_similarity"`
+	// ReactionActions maps reaction names to actions run when one of
+	// ReactionActionUsers reacts to a bridged message: "delete" removes
+	// its mirrors, "pin" pins them and "promote:TID/CID" forwards the
+	// message to the group containing that channel.
+	ReactionActions     map[string]string `json:"reaction_actions,omitempty"`
+	ReactionActionUsers StringList        `json:"reaction_action_users"`
+	// SyncOnly stops new messages being forwarded while still applying
+	// edits and deletions to messages forwarded earlier.
+	SyncOnly bool `json:"sync_only"`
+	// Webhooks are generic HTTP endpoints the group's messages are also
+	// sent to.
+	Webhooks []WebhookOptions `json:"webhooks,omitempty"`
+	// AuditWebhook receives a JSON record of every delivery to the
+	// group's destinations: source, destination, status, latency and
+	// error. Records are sent in the background, buffering up to
+	// audit_buffer of them and dropping any beyond it.
+	AuditWebhook *WebhookOptions `json:"audit_webhook,omitempty"`
+	// ShowChain adds a footer listing the channels a message was forwarded
+	// through, for messages that came through more than one bridge.
+	ShowChain bool `json:"show_chain"`
+	// FileList forwards shared files as a single line of links, public
+	// where the file already is, instead of handling them by each
+	// destination's file mode.
+	FileList bool `json:"file_list"`
+	// ThreadStarters, when set, forwards only top-level messages posted by
+	// these user IDs and the replies in their threads. Threads started
+	// before a restart are no longer recognized.
+	ThreadStarters StringList `json:"thread_starters"`
+	// UnfurlLinks and UnfurlMedia control link previews on forwarded
+	// messages. Slack's defaults apply when they are unset.
+	UnfurlLinks *bool `json:"unfurl_links,omitempty"`
+	UnfurlMedia *bool `json:"unfurl_media,omitempty"`
+	// CoalesceWindow merges consecutive messages from one author arriving
+	// within the window into a single post to each destination. A message
+	// from someone else ends the merge.
+	CoalesceWindow Duration `json:"coalesce_window"`
+	// StripBroadcasts forwards thread replies that were also sent to the
+	// source channel as plain replies, rather than broadcasting them in
+	// mirrored threads too.
+	StripBroadcasts bool `json:"strip_broadcasts"`
+	// Backfill forwards up to this many of the messages posted before a
+	// channel's first bridged message, marked as backfilled, ahead of it.
+	// Messages older than max_message_age are skipped. With a store_path,
+	// channels aren't backfilled again after a restart.
+	Backfill int `json:"backfill"`
+	// Redact lists patterns masked out of forwarded text: "email", "phone"
+	// or regular expressions.
+	Redact StringList `json:"redact"`
+	// RedactMask replaces redacted text, "[redacted]" by default.
+	RedactMask string `json:"redact_mask"`
+	// Linkify wraps bare URLs in Slack's <url> link markup, for sources
+	// whose URLs Slack doesn't link on its own.
+	Linkify bool `json:"linkify"`
+	// LinkDisplay controls links with display text, <url|text>: "both",
+	// the default, keeps them as they are, "text" shows only the text and
+	// "url" only the URL.
+	LinkDisplay string `json:"link_display"`
+	// ShowEdited appends "(edited)" to forwarded messages that were edited
+	// at the source, including edits applied to mirrors.
+	ShowEdited bool `json:"show_edited"`
+	// Template is a text/template for the forwarded text, executed with
+	// .User, .Text, .Channel, .Team and .Permalink. The default forwards the
+	// text unchanged.
+	Template string `json:"template"`
+	// WebhookReply is a template, executed like Template, whose result is
+	// returned to Slack for messages received through outgoing webhooks,
+	// which posts it back in the source channel, such as "mirrored ✓".
+	// Nothing is returned when it is unset.
+	WebhookReply string `json:"webhook_reply"`
+	// Pipeline orders the text transforms applied to forwarded messages,
+	// from "anonymize", "dates", "mentions", "attachments", "redact",
+	// "linkify", "links", "permalink", "template", "edited", "username"
+	// and "truncate", and any custom transforms registered with
+	// RegisterTransform. Transforms left out don't run.
+	Pipeline StringList `json:"pipeline"`
+	// MaxLength truncates forwarded text longer than this many characters
+	// at a word boundary, ending it with TruncateMarker, "… [truncated]"
+	// by default. TruncatePermalink also links to the full message. Zero
+	// means no limit.
+	MaxLength         int    `json:"max_length"`
+	TruncateMarker    string `json:"truncate_marker"`
+	TruncatePermalink bool   `json:"truncate_permalink"`
+	// UsernameDecoration is appended to the author's name on forwarded
+	// messages, such as " 🔗", to set them apart from native ones. Names
+	// are trimmed to keep within Slack's 80 character limit.
+	UsernameDecoration string `json:"username_decoration"`
+	// FallbackIcon is the icon of messages whose author's icon can't be
+	// looked up: an image URL or an emoji such as ":bust_in_silhouette:".
+	FallbackIcon string `json:"fallback_icon"`
+	// AnonymizeSalt, when set, posts messages under a stable pseudonym for
+	// each author, PseudonymPrefix ("User-" by default) and a hash of
+	// their ID salted with it, with the fallback icon. User mentions are
+	// replaced too. Adding "anonymize" to a destination's pipeline as well
+	// gives authors and the users they mention a different pseudonym in
+	// that destination.
+	AnonymizeSalt   string `json:"anonymize_salt"`
+	PseudonymPrefix string `json:"pseudonym_prefix"`
+	// SuppressMentions posts every user, user group and broadcast mention
+	// as plain text that notifies no one, overriding destinations'
+	// usergroups tables and Slack's linking of names.
+	SuppressMentions bool `json:"suppress_mentions"`
+}
+
+// TeamOptions holds per-team settings, given in SLACKLINE_TEAM_OPTIONS as
+// TID:KEY=VALUE;KEY=VALUE.
+type TeamOptions struct {
+	// DisallowPublicFiles prevents the bridge from creating public links
+	// for the team's files.
+	DisallowPublicFiles bool `json:"disallow_public_files"`
+	// Concurrency overrides the team_concurrency setting for this team.
+	Concurrency int `json:"concurrency"`
+	// AllowChannels, when set, lists the only channel IDs of the team that
+	// may be bridged.
+	AllowChannels StringList `json:"allow_channels"`
+	// DenyChannels lists channel IDs of the team that are never bridged,
+	// even if allowed.
+	DenyChannels StringList `json:"deny_channels"`
+	// Color is a hex color, such as "#36a64f", given to the attachments of
+	// the team's forwarded messages.
+	Color string `json:"color"`
+	// Timezone is the team's IANA timezone, such as "Europe/London",
+	// overriding the timezone setting.
+	Timezone string `json:"timezone"`
+}
+
+// Permits reports whether the team's channel lists allow channel to be
+// bridged. The denylist takes precedence.
+func (o TeamOptions) Permits(channel string) bool {
+	if o.DenyChannels.Contains(channel) {
+		return false
+	}
+	return len(o.AllowChannels) == 0 || o.AllowChannels.Contains(channel)
+}
+
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func validateColor(color string) error {
+	if color != "" && !colorRegexp.MatchString(color) {
+		return fmt.Errorf("Invalid color %q, expected #RRGGBB", color)
+	}
+	return nil
+}
+
+const (
+	fileModeUpload     = "upload"
+	fileModePublicLink = "public_link"
+	fileModeLink       = "link"
+)
+
+const (
+	threadMirror  = "mirror"
+	threadFlatten = "flatten"
+	threadCollect = "collect"
+)
+
+// DestinationOptions holds settings for posts to one destination channel,
+// given in SLACKLINE_DESTINATION_OPTIONS as TID/CID:KEY=VALUE;KEY=VALUE.
+type DestinationOptions struct {
+	// FileMode controls how shared files reach the destination: "upload"
+	// re-uploads them, "public_link" posts a public link (re-uploading when
+	// the file can't be made public) and "link" posts the source permalink.
+	FileMode string `json:"file_mode"`
+	// ThreadMode controls how replies are threaded in the destination:
+	// "mirror" posts them in the thread mirroring their source thread,
+	// "flatten" posts them to the channel, and "collect" posts them under
+	// a single message started for each source thread, whether or not its
+	// root was forwarded.
+	ThreadMode string `json:"thread_mode"`
+	// Token overrides the team's API token for posts to this destination,
+	// for example a least-privilege bot token. Setting it posts through the
+	// Web API rather than the incoming webhook.
+	Token string `json:"token"`
+	// UserToken is a user token for the destination team. Messages are
+	// posted as that user, with as_user, instead of the bot. It needs the
+	// chat:write user scope. If Slack rejects the token, the message is
+	// posted as the bot instead.
+	UserToken string `json:"user_token"`
+	// AutoJoin joins the destination channel when a post fails because the
+	// bot isn't a member, then retries the post once. This needs the
+	// channels:join scope and only works for public channels.
+	AutoJoin bool `json:"auto_join"`
+	// WebhookFallback posts through chat.postMessage with the team's API
+	// token when the incoming webhook is rate limited, as the Web API has
+	// its own budget.
+	WebhookFallback bool `json:"webhook_fallback"`
+	// Usergroups maps source user group handles, without the "@", to user
+	// group IDs in the destination team. Other user group mentions are
+	// posted as plain text.
+	Usergroups map[string]string `json:"usergroups,omitempty"`
+	// BroadcastMemberLimit posts @channel, @here and @everyone as plain
+	// text when the destination has more than this many members, checked
+	// hourly. Zero keeps broadcasts whatever the size.
+	BroadcastMemberLimit int `json:"broadcast_member_limit"`
+	// Pipeline lists transforms, by their registered names, run for this
+	// destination alone after the group's pipeline.
+	Pipeline StringList `json:"pipeline"`
+	// BatchWindow, when set, coalesces messages arriving within the window
+	// into a single post, up to BatchSize messages (10 by default).
+	// Replies and messages with files are always posted on their own.
+	BatchWindow Duration `json:"batch_window"`
+	BatchSize   int      `json:"batch_size"`
+	// Language translates forwarded text into this language code, using
+	// the translator_url setting.
+	Language string `json:"language"`
+	// ChannelIcon posts messages with the first emoji in the source
+	// channel's topic or purpose as their icon instead of the author's
+	// picture, which is kept for channels without one.
+	ChannelIcon bool `json:"channel_icon"`
+	// MaxRate paces posts to the destination to at most this many per
+	// second. The rate is halved whenever Slack rate limits a post and
+	// recovers with each successful one. Zero disables pacing.
+	MaxRate float64 `json:"max_rate"`
+	// MaxBytesPerSecond paces posts to the destination by the size of
+	// their payloads, text and attachments, so large messages are spread
+	// out. Zero disables it.
+	MaxBytesPerSecond int `json:"max_bytes_per_second"`
+	// MaxUsernameLength cuts the names messages are posted under to this
+	// many characters, at most Slack's 80. DisallowedUsernameChars lists
+	// characters removed from them, as control characters always are.
+	MaxUsernameLength       int    `json:"max_username_length"`
+	DisallowedUsernameChars string `json:"disallowed_username_chars"`
+}
+
+func DefaultDestinationOptions() DestinationOptions {
+	return DestinationOptions{FileMode: fileModeUpload, ThreadMode: threadMirror}
+}
+
+type Group struct {
+	Channels []Channel
+	Options  GroupOptions
+
+	redactions   []*regexp.Regexp
+	template     *template.Template
+	webhookReply *template.Template
+	pipeline     []pipelineStep
+	inFlight     chan struct{}
+}
+
+// enter takes one of the group's in-flight slots, reporting false if none
+// is free.
+func (g *Group) enter() bool {
+	if g.inFlight == nil {
+		return true
+	}
+	select {
+	case g.inFlight <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *Group) leave() {
+	if g.inFlight != nil {
+		<-g.inFlight
+	}
+}
+
+// NewGroup builds a group, compiling the patterns in its options.
+func NewGroup(channels []Channel, options GroupOptions) (*Group, error) {
+	if rate := options.SampleRate; rate != nil && (*rate < 0 || *rate > 1) {
+		return nil, fmt.Errorf("Invalid sample_rate %v, expected 0 to 1", *rate)
+	}
+	switch options.LinkDisplay {
+	case "", linksBoth, linksText, linksURL:
+	default:
+		return nil, fmt.Errorf("Invalid link_display %q", options.LinkDisplay)
+	}
+	if options.FlapSimilarity < 0 || options.FlapSimilarity > 1 {
+		return nil, fmt.Errorf("Invalid flap_similarity %v, expected 0 to 1", options.FlapSimilarity)
+	}
+	for _, webhook := range options.Webhooks {
+		if err := webhook.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if webhook := options.AuditWebhook; webhook != nil {
+		if err := webhook.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for reaction, action := range options.ReactionActions {
+		if err := validateReactionAction(action); err != nil {
+			return nil, fmt.Errorf("Invalid action for :%v:: %v", reaction, err)
+		}
+	}
+	redactions, err := compileRedactions(options.Redact)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := compileTemplate(options.Template)
+	if err != nil {
+		return nil, err
+	}
+	webhookReply, err := compileTemplate(options.WebhookReply)
+	if err != nil {
+		return nil, err
+	}
+	names := options.Pipeline
+	if len(names) == 0 {
+		names = defaultPipeline
+	}
+	pipeline, err := compilePipeline(names)
+	if err != nil {
+		return nil, err
+	}
+	group := &Group{
+		Channels:     channels,
+		Options:      options,
+		redactions:   redactions,
+		template:     tmpl,
+		webhookReply: webhookReply,
+		pipeline:     pipeline,
+	}
+	if options.MaxInFlight > 0 {
+		group.inFlight = make(chan struct{}, options.MaxInFlight)
+	}
+	return group, nil
+}
+
+// parseOptions decodes a legacy option string of the form
+// key=value;key=value into v, which must be a pointer to an options struct.
+// Values that are valid JSON (booleans, numbers, quoted strings) are used
+// as-is; anything else is treated as a bare string.
+func parseOptions(s string, v interface{}) error {
+	fields := make(map[string]json.RawMessage)
+	for _, pair := range strings.Split(s, ";") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("Invalid option %q, expected key=value", pair)
+		}
+		value := json.RawMessage(kv[1])
+		if !json.Valid(value) {
+			value, _ = json.Marshal(kv[1])
+		}
+		fields[kv[0]] = value
+	}
+
+	raw, _ := json.Marshal(fields)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("Invalid options %q: %v", s, err)
+	}
+	return nil
+}
+
+// Duration is a time.Duration encoded as a string such as "30s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// StringList is a list of strings encoded either as a JSON array or, for
+// the legacy environment format, as a single "a|b|c" string.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(b []byte) error {
+	var list []string
+	if err := json.Unmarshal(b, &list); err == nil {
+		*l = list
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = strings.Split(s, "|")
+	return nil
+}
+
+func (l StringList) Contains(s string) bool {
+	for _, item := range l {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// withTeamOptions sets the options of teamA in a configuration from
+// testConfig.
+func withTeamOptions(content string, options string) string {
+	return strings.Replace(content, `"incoming_token": "hook-a"`, `"incoming_token": "hook-a", "options": `+options, 1)
+}
+
+func TestTeamChannelLists(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		wantErr bool
+	}{
+		{"no lists", `{}`, false},
+		{"allowed", `{"allow_channels": ["` + chanA + `"]}`, false},
+		{"not allowed", `{"allow_channels": ["` + chanC + `"]}`, true},
+		{"denied", `{"deny_channels": ["` + chanA + `"]}`, true},
+		{"denied and allowed", `{"allow_channels": ["` + chanA + `"], "deny_channels": ["` + chanA + `"]}`, true},
+		{"others denied", `{"deny_channels": ["` + chanC + `"]}`, false},
+		{"mistyped entry", `{"deny_channels": ["c0000000"]}`, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fc, err := parseFileConfig([]byte(withTeamOptions(testConfig(""), test.options)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = BuildConfiguration(fc, &ConfigErrors{})
+			if (err != nil) != test.wantErr {
+				t.Errorf("BuildConfiguration error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPermittedAtRuntime(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig(""))
+	// The lists are checked again when forwarding, not only on load.
+	config().teams[teamB].Options.DenyChannels = StringList{chanB}
+
+	Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: "1.000"})
+	if posts := slack.Posts(); len(posts) != 0 {
+		t.Errorf("Forwarded to a denied channel: %v", posts)
+	}
+
+	Bridge(slackMessage{Channel: Channel{teamB, chanB}, Username: "bob", Text: "hi", Timestamp: "2.000"})
+	if posts := slack.Posts(); len(posts) != 0 {
+		t.Errorf("Forwarded from a denied channel: %v", posts)
+	}
+	if dropped := stats.Snapshot(false).Dropped[dropNotPermitted]; dropped != 1 {
+		t.Errorf("Counted %d messages from denied channels, want 1", dropped)
+	}
+}
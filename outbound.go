@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// outboundSlots bounds the bridge's concurrent outbound HTTP calls across
+// every team, on top of each team's own bound. It is nil when unbounded.
+var outboundSlots chan struct{}
+
+// outboundWait is the total time, in nanoseconds, calls spent waiting for
+// an outbound slot.
+var outboundWait int64
+
+// SetOutboundLimit bounds concurrent outbound calls to n, or removes the
+// bound when n is zero. It must be called before any calls are made.
+func SetOutboundLimit(n int) {
+	if n > 0 {
+		outboundSlots = make(chan struct{}, n)
+	} else {
+		outboundSlots = nil
+	}
+}
+
+// acquireOutbound takes an outbound slot, returning ctx's error if it
+// expires first.
+func acquireOutbound(ctx context.Context) error {
+	if outboundSlots == nil {
+		return nil
+	}
+	start := now()
+	defer func() { atomic.AddInt64(&outboundWait, int64(now().Sub(start))) }()
+	select {
+	case outboundSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func releaseOutbound() {
+	if outboundSlots != nil {
+		<-outboundSlots
+	}
+}
+
+// OutboundWait returns the total time spent waiting for outbound slots.
+func OutboundWait() time.Duration {
+	return time.Duration(atomic.LoadInt64(&outboundWait))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboundLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		calls    int
+		wantMax  int
+		wantWait bool
+	}{
+		{"bounded", 3, 30, 3, true},
+		{"one at a time", 1, 10, 1, true},
+		{"unbounded", 0, 10, 10, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			inFlight, peak := 0, 0
+			track := func() {
+				mu.Lock()
+				inFlight++
+				if inFlight > peak {
+					peak = inFlight
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.info", func(fakeCall) string {
+				track()
+				return `{"ok":true}`
+			})
+			server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { track() }))
+			defer server.Close()
+			useConfig(t, testConfig("", `"settings": {"team_concurrency": 100}`))
+			SetOutboundLimit(test.limit)
+			t.Cleanup(func() { SetOutboundLimit(0) })
+			waited := OutboundWait()
+
+			// Half the calls go to Slack, across both teams, and half to a
+			// generic webhook.
+			var wg sync.WaitGroup
+			for i := 0; i < test.calls; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					switch i % 3 {
+					case 0:
+						WebhookOptions{URL: server.URL}.Post(testContext(t), slackMessage{Channel: Channel{teamA, chanA}, Text: "hi"})
+					case 1:
+						config().teams[teamA].apiCall(testContext(t), "conversations.info", url.Values{"channel": {chanA}}, nil)
+					default:
+						config().teams[teamB].apiCall(testContext(t), "conversations.info", url.Values{"channel": {chanB}}, nil)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			if peak > test.wantMax {
+				t.Errorf("Made %d calls at once, want at most %d", peak, test.wantMax)
+			}
+			if test.limit == 0 && peak < 2 {
+				t.Errorf("Made calls one at a time without a limit")
+			}
+			if wait := OutboundWait() - waited; (wait > 0) != test.wantWait {
+				t.Errorf("Calls waited %v for a slot, want waiting %v", wait, test.wantWait)
+			}
+		})
+	}
+}
+
+func TestOutboundLimitCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{"web api", func(ctx context.Context) error {
+			return config().teams[teamA].apiCall(ctx, "conversations.info", url.Values{"channel": {chanA}}, nil)
+		}},
+		{"incoming webhook", func(ctx context.Context) error {
+			return (Channel{teamB, chanB}).WebhookPostMessage(ctx, slackMessage{Channel: Channel{teamA, chanA}, Text: "hi"})
+		}},
+		{"generic webhook", func(ctx context.Context) error {
+			return WebhookOptions{URL: "http://127.0.0.1:1/hook"}.Post(ctx, slackMessage{Channel: Channel{teamA, chanA}, Text: "hi"})
+		}},
+		{"translator", func(ctx context.Context) error {
+			_, err := (&httpTranslator{URL: "http://127.0.0.1:1/translate"}).Translate(ctx, "hello", "de")
+			return err
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"settings": {"team_concurrency": 1}`))
+			SetOutboundLimit(1)
+			t.Cleanup(func() { SetOutboundLimit(0) })
+			// Every outbound slot is taken for the rest of the test.
+			outboundSlots <- struct{}{}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if err := test.call(ctx); err != context.DeadlineExceeded {
+				t.Errorf("Call waiting for a slot = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if calls := len(slack.calls); calls != 0 {
+				t.Errorf("Made %d calls without a slot", calls)
+			}
+			for _, team := range config().teams {
+				if held := len(team.slots); held != 0 {
+					t.Errorf("Team %v kept %d slots after giving up", team.Id, held)
+				}
+			}
+		})
+	}
+}
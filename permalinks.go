@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+)
+
+var permalinks = newCache(10000, 0)
+
+// Permalink resolves the permalink of message ts in channel with
+// chat.getPermalink, which handles shared and enterprise channels.
+func (t *Team) Permalink(ctx context.Context, channel string, ts string) (string, error) {
+	key := t.Id + "/" + channel + "/" + ts
+	if link, present := permalinks.Get(key); present {
+		return link.(string), nil
+	}
+
+	var response struct {
+		Permalink string `json:"permalink"`
+	}
+	values := url.Values{"channel": {channel}, "message_ts": {ts}}
+	if err := t.apiCall(ctx, "chat.getPermalink", values, &response); err != nil {
+		return "", err
+	}
+
+	permalinks.Set(key, response.Permalink)
+	return response.Permalink, nil
+}
+
+// FetchPermalink resolves the source message's permalink, appending it to
+// the text for groups with AppendPermalink.
+func (msg *slackMessage) FetchPermalink(ctx context.Context) {
+	if msg.Timestamp == "" {
+		return
+	}
+	link, err := msg.GetTeam().Permalink(ctx, msg.ChannelId, msg.Timestamp)
+	if err != nil {
+		log.Printf("Unable to fetch permalink for %v: %v", msg.Timestamp, err)
+		return
+	}
+	msg.Permalink = link
+
+	if msg.Group().Options.AppendPermalink {
+		msg.Text += "\n<" + link + "|View original>"
+	}
+}
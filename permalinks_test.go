@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFetchPermalink(t *testing.T) {
+	const link = "https://a.slack.com/archives/C0000000A/p1488369600000100"
+	tests := []struct {
+		name      string
+		options   string
+		ts        string
+		response  string
+		wantText  string
+		wantLink  string
+		wantCalls int
+	}{
+		{"appended", `{"append_permalink": true}`, "1488369600.000100",
+			`{"ok":true,"permalink":"` + link + `"}`, "hi\n<" + link + "|View original>", link, 1},
+		{"resolved only", "", "1488369600.000100", `{"ok":true,"permalink":"` + link + `"}`, "hi", link, 1},
+		{"no timestamp", `{"append_permalink": true}`, "", "", "hi", "", 0},
+		{"lookup failed", `{"append_permalink": true}`, "1488369600.000100",
+			`{"ok":false,"error":"message_not_found"}`, "hi", "", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("chat.getPermalink", func(fakeCall) string { return test.response })
+			useConfig(t, testConfig(test.options))
+
+			// Fetching twice checks that permalinks are cached and
+			// failures aren't.
+			for i := 0; i < 2; i++ {
+				msg := slackMessage{Channel: Channel{teamA, chanA}, Text: "hi", Timestamp: test.ts}
+				msg.FetchPermalink(context.Background())
+				if msg.Text != test.wantText || msg.Permalink != test.wantLink {
+					t.Errorf("Got text %q, permalink %q; want %q, %q", msg.Text, msg.Permalink, test.wantText, test.wantLink)
+				}
+			}
+			calls := slack.Calls("chat.getPermalink")
+			if len(calls) != test.wantCalls {
+				t.Fatalf("Made %d chat.getPermalink calls, want %d", len(calls), test.wantCalls)
+			}
+			if len(calls) > 0 && (calls[0].Get("channel") != chanA || calls[0].Get("message_ts") != test.ts) {
+				t.Errorf("Looked up %v", calls[0].Form)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+type pinEvent struct {
+	Type    string `json:"type"`
+	User    string `json:"user"`
+	Channel string `json:"channel_id"`
+	Item    struct {
+		Type    string `json:"type"`
+		Message struct {
+			Timestamp string `json:"ts"`
+		} `json:"message"`
+	} `json:"item"`
+}
+
+// handlePin posts a note to the rest of the group when a message is pinned
+// or unpinned in a channel of a group with MirrorPins. The note is posted
+// in the thread of the message's mirror when there is one.
+func handlePin(envelope eventEnvelope) {
+	var event pinEvent
+	if err := json.Unmarshal(envelope.Event, &event); err != nil {
+		log.Printf("Malformed event %v: %v", envelope.EventId, err)
+		return
+	}
+	if event.Item.Type != "message" {
+		return
+	}
+
+	source := resolveChannel(envelope.TeamId, event.Channel, nil)
+	group := source.Group()
+	if group == nil || !group.Options.MirrorPins || source.GetTeam() == nil {
+		return
+	}
+
+	name := event.User
+	if info, err := source.GetTeam().GetUserInfo(event.User); err == nil {
+		name = info.Name
+	}
+	verb := "pinned"
+	if event.Type == "pin_removed" {
+		verb = "unpinned"
+	}
+	note := slackMessage{
+		Channel:         source,
+		Text:            "📌 " + name + " " + verb + " a message",
+		ThreadTimestamp: event.Item.Message.Timestamp,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	source.Forward(func(dest Channel) {
+		if err := dest.PostMessage(ctx, note); err != nil {
+			log.Printf("Unable to post pin note to %v: %v", dest, err)
+		}
+	})
+}
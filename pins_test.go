@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func pinEnvelope(eventType string, channel Channel, ts string) eventEnvelope {
+	event, _ := json.Marshal(map[string]interface{}{
+		"type":       eventType,
+		"user":       "U0000000A",
+		"channel_id": channel.ChannelId,
+		"item":       map[string]interface{}{"type": "message", "message": map[string]string{"ts": ts}},
+	})
+	return eventEnvelope{Type: "event_callback", TeamId: channel.TeamId, EventId: "Ev1", Event: event}
+}
+
+func TestMirrorPins(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      string
+		eventType    string
+		wantMethod   string
+		wantText     string
+		wantThreadTs string
+	}{
+		{"pinned", `{"mirror_pins": true}`, "pin_added", "webhook", "📌 name-u0000000a pinned a message", ""},
+		{"unpinned", `{"mirror_pins": true}`, "pin_removed", "webhook", "📌 name-u0000000a unpinned a message", ""},
+		{"in the mirror's thread", `{"mirror_pins": true, "threads": true}`, "pin_added", "chat.postMessage", "📌 name-u0000000a pinned a message", "9.000"},
+		{"disabled", `{}`, "pin_added", "webhook", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			mirrors.Record(Channel{teamA, chanA}, "1.000", Channel{teamB, chanB}, "9.000")
+
+			handlePin(pinEnvelope(test.eventType, Channel{teamA, chanA}, "1.000"))
+
+			calls := slack.Calls(test.wantMethod)
+			if test.wantText == "" {
+				if len(calls) != 0 {
+					t.Errorf("Posted %v, want no note", calls[0].Body)
+				}
+				return
+			}
+			if len(calls) != 1 {
+				t.Fatalf("Made %d %v calls, want 1", len(calls), test.wantMethod)
+			}
+			if call := calls[0]; call.Get("text") != test.wantText || call.Get("thread_ts") != test.wantThreadTs {
+				t.Errorf("Posted %q in thread %q, want %q in %q", call.Get("text"), call.Get("thread_ts"), test.wantText, test.wantThreadTs)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// DestinationInfo describes the destination a message is transformed for.
+// It is empty in a group's pipeline, which runs once for all of the
+// group's destinations.
+type DestinationInfo struct {
+	Channel Channel
+	Options DestinationOptions
+}
+
+// Transform is a step of a message pipeline. Transforms are registered by
+// name with RegisterTransform and referenced by that name in pipelines.
+// A transform that fails leaves the message to the rest of the pipeline.
+type Transform interface {
+	Transform(ctx context.Context, msg *slackMessage, dest DestinationInfo) error
+}
+
+// TransformFunc adapts a function to the Transform interface.
+type TransformFunc func(context.Context, *slackMessage, DestinationInfo) error
+
+func (f TransformFunc) Transform(ctx context.Context, msg *slackMessage, dest DestinationInfo) error {
+	return f(ctx, msg, dest)
+}
+
+// plain adapts a built-in transform that makes no Slack calls.
+func plain(f func(*slackMessage)) Transform {
+	return TransformFunc(func(_ context.Context, msg *slackMessage, _ DestinationInfo) error {
+		f(msg)
+		return nil
+	})
+}
+
+// withContext adapts a built-in transform that uses ctx.
+func withContext(f func(*slackMessage, context.Context)) Transform {
+	return TransformFunc(func(ctx context.Context, msg *slackMessage, _ DestinationInfo) error {
+		f(msg, ctx)
+		return nil
+	})
+}
+
+// transforms are the registered transforms pipelines are built from.
+var transforms = struct {
+	sync.RWMutex
+	byName map[string]Transform
+}{byName: make(map[string]Transform)}
+
+// RegisterTransform adds a transform under name, for custom transforms
+// registered from an init function in a file built with the bridge. It
+// panics if the name is already taken.
+func RegisterTransform(name string, t Transform) {
+	transforms.Lock()
+	defer transforms.Unlock()
+
+	if _, present := transforms.byName[name]; present {
+		panic("slackline: transform " + name + " registered twice")
+	}
+	transforms.byName[name] = t
+}
+
+func init() {
+	RegisterTransform("anonymize", TransformFunc(func(ctx context.Context, msg *slackMessage, dest DestinationInfo) error {
+		return msg.Anonymize(ctx, dest)
+	}))
+	RegisterTransform("dates", plain((*slackMessage).RewriteDates))
+	RegisterTransform("mentions", plain((*slackMessage).RewriteMentions))
+	RegisterTransform("attachments", plain((*slackMessage).PrepareAttachments))
+	RegisterTransform("redact", plain((*slackMessage).Redact))
+	RegisterTransform("linkify", plain((*slackMessage).Linkify))
+	RegisterTransform("links", plain((*slackMessage).RenderLinks))
+	RegisterTransform("permalink", withContext((*slackMessage).permalinkTransform))
+	RegisterTransform("template", plain((*slackMessage).ApplyTemplate))
+	RegisterTransform("edited", plain((*slackMessage).MarkEdited))
+	RegisterTransform("username", plain((*slackMessage).DecorateUsername))
+	RegisterTransform("truncate", withContext((*slackMessage).Truncate))
+}
+
+// defaultPipeline is the order transforms run in when a group doesn't
+// configure one.
+var defaultPipeline = []string{"anonymize", "dates", "mentions", "attachments", "redact", "linkify", "links", "permalink", "template", "edited", "username", "truncate"}
+
+// pipelineStep is a transform in a compiled pipeline, with its name for
+// logging failures.
+type pipelineStep struct {
+	name string
+	Transform
+}
+
+// compilePipeline looks up the named transforms, in order.
+func compilePipeline(names []string) ([]pipelineStep, error) {
+	transforms.RLock()
+	defer transforms.RUnlock()
+
+	pipeline := make([]pipelineStep, len(names))
+	for i, name := range names {
+		transform, present := transforms.byName[name]
+		if !present {
+			return nil, fmt.Errorf("Unknown transform %q in pipeline", name)
+		}
+		pipeline[i] = pipelineStep{name, transform}
+	}
+	return pipeline, nil
+}
+
+// runPipeline runs msg through each step of pipeline for dest.
+func runPipeline(ctx context.Context, pipeline []pipelineStep, msg *slackMessage, dest DestinationInfo) {
+	for _, step := range pipeline {
+		if err := step.Transform.Transform(ctx, msg, dest); err != nil {
+			log.Printf("Transform %v failed for %v: %v", step.name, msg.Channel, err)
+		}
+	}
+}
+
+// Transform runs the message through its group's pipeline.
+func (msg *slackMessage) Transform(ctx context.Context) {
+	runPipeline(ctx, msg.Group().pipeline, msg, DestinationInfo{})
+}
+
+// TransformFor runs the message through the channel's own pipeline, if it
+// has one, just before it is posted there.
+func (c Channel) TransformFor(ctx context.Context, msg *slackMessage) {
+	options := c.Options()
+	if len(options.Pipeline) == 0 {
+		return
+	}
+	pipeline, err := compilePipeline(options.Pipeline)
+	if err != nil {
+		log.Printf("Skipping the pipeline of %v: %v", c, err)
+		return
+	}
+	runPipeline(ctx, pipeline, msg, DestinationInfo{c, options})
+}
+
+// MarkEdited appends "(edited)" to the text of messages edited at the
+// source, for groups with ShowEdited.
+func (msg *slackMessage) MarkEdited() {
+	if msg.Edited && msg.Group().Options.ShowEdited {
+		msg.Text += " (edited)"
+	}
+}
+
+func (msg *slackMessage) permalinkTransform(ctx context.Context) {
+	options := msg.Group().Options
+	if msg.Preview {
+		return
+	}
+	if options.AppendPermalink || strings.Contains(options.Template, ".Permalink") {
+		msg.FetchPermalink(ctx)
+	}
+}
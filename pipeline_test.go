@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func init() {
+	// test-reverse stands in for a custom transform, reversing the text
+	// and recording the destination it ran for.
+	RegisterTransform("test-reverse", TransformFunc(func(_ context.Context, msg *slackMessage, dest DestinationInfo) error {
+		runes := []rune(msg.Text)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		msg.Text = string(runes)
+		if dest.Channel != (Channel{}) {
+			msg.Text += " @" + dest.Channel.ChannelId
+		}
+		return nil
+	}))
+	RegisterTransform("test-fail", TransformFunc(func(context.Context, *slackMessage, DestinationInfo) error {
+		return errors.New("failed")
+	}))
+}
+
+func TestPipelineOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline string
+		want     string
+	}{
+		{"redact then template", `["redact", "template"]`, "alice@example.com: mail [redacted]"},
+		{"template then redact", `["template", "redact"]`, "[redacted]: mail [redacted]"},
+		{"custom transform", `["test-reverse", "template"]`, "alice@example.com: moc.elpmaxe@bob liam"},
+		{"failing transform", `["test-fail", "redact"]`, "mail [redacted]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(`{"redact": ["email"], "template": "{{.User}}: {{.Text}}", "pipeline": `+test.pipeline+`}`))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice@example.com", Text: "mail bob@example.com"}
+			msg.Transform(context.Background())
+			if msg.Text != test.want {
+				t.Errorf("Transform() = %q, want %q", msg.Text, test.want)
+			}
+		})
+	}
+}
+
+func TestDefaultPipeline(t *testing.T) {
+	useConfig(t, testConfig(`{"redact": ["email"], "template": "{{.User}}: {{.Text}}"}`))
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice@example.com", Text: "mail bob@example.com"}
+	msg.Transform(context.Background())
+	// The default pipeline redacts the text before the template runs.
+	if want := "alice@example.com: mail [redacted]"; msg.Text != want {
+		t.Errorf("Transform() = %q, want %q", msg.Text, want)
+	}
+}
+
+func TestDestinationPipeline(t *testing.T) {
+	useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"pipeline": ["test-reverse"]}}`))
+	tests := []struct {
+		dest Channel
+		want string
+	}{
+		{Channel{teamB, chanB}, "olleh @" + chanB},
+		{Channel{teamA, chanC}, "hello"},
+	}
+	for _, test := range tests {
+		msg := slackMessage{Channel: Channel{teamA, chanA}, Text: "hello"}
+		test.dest.TransformFor(context.Background(), &msg)
+		if msg.Text != test.want {
+			t.Errorf("TransformFor(%v) = %q, want %q", test.dest, msg.Text, test.want)
+		}
+	}
+}
+
+func TestCompilePipeline(t *testing.T) {
+	if _, err := compilePipeline(defaultPipeline); err != nil {
+		t.Errorf("Default pipeline doesn't compile: %v", err)
+	}
+	_, err := compilePipeline([]string{"redact", "missing"})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("compilePipeline with an unknown transform = %v", err)
+	}
+
+	fc, err := parseFileConfig([]byte(testConfig(`{"pipeline": ["missing"]}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildConfiguration(fc, &ConfigErrors{}); err == nil {
+		t.Errorf("BuildConfiguration accepted an unknown transform")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Registering a transform twice didn't panic")
+		}
+	}()
+	RegisterTransform("redact", plain((*slackMessage).Redact))
+}
+
+func TestMarkEdited(t *testing.T) {
+	edited := `{"type":"message","channel":"` + chanA + `","user":"U0000000A","text":"fixed typo","ts":"1.000","edited":{"user":"U0000000A","ts":"2.000"}}`
+	unedited := `{"type":"message","channel":"` + chanA + `","user":"U0000000A","text":"fixed typo","ts":"1.000"}`
+	edit := `{"type":"message","subtype":"message_changed","channel":"` + chanA + `",` +
+		`"message":{"type":"message","user":"U0000000A","text":"fixed typo","ts":"1.000","edited":{"user":"U0000000A","ts":"2.000"}}}`
+	tests := []struct {
+		name       string
+		options    string
+		event      string
+		wantMethod string
+		wantText   string
+	}{
+		{"edited", `{"show_edited": true}`, edited, "webhook", "fixed typo (edited)"},
+		{"unedited", `{"show_edited": true}`, unedited, "webhook", "fixed typo"},
+		{"off by default", `{}`, edited, "webhook", "fixed typo"},
+		{"edit applied to the mirror", `{"show_edited": true}`, edit, "chat.update", "fixed typo (edited)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			useQueue(t)
+			mirrors.Record(Channel{teamA, chanA}, "1.000", Channel{teamB, chanB}, "9.000")
+
+			handleEvent(eventEnvelope{Type: "event_callback", TeamId: teamA, EventId: "Ev1", Event: []byte(test.event)})
+			queue.Flush(testContext(t))
+			waitFor(t, test.wantMethod, func() bool { return len(slack.Calls(test.wantMethod)) > 0 })
+
+			if got := slack.Calls(test.wantMethod)[0].Get("text"); got != test.wantText {
+				t.Errorf("Sent %q, want %q", got, test.wantText)
+			}
+		})
+	}
+}
+
+func TestDestinationPipelinePosts(t *testing.T) {
+	tests := []struct {
+		name        string
+		group       string
+		destination string
+		want        string
+	}{
+		{"group only", `["template"]`, `[]`, "alice: hello"},
+		{"destination after the group", `["template"]`, `["test-reverse"]`, "olleh :ecila @" + chanB},
+		{"failing destination transform", `["template"]`, `["test-fail"]`, "alice: hello"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(`{"template": "{{.User}}: {{.Text}}", "pipeline": `+test.group+`}`,
+				`"destinations": {"`+teamB+"/"+chanB+`": {"pipeline": `+test.destination+`}}`))
+			useQueue(t)
+
+			if !queue.Enqueue(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello", Timestamp: "1.000"}) {
+				t.Fatal("Enqueue dropped the message")
+			}
+			// Flush returns once the message's posts are made.
+			if err := queue.Flush(testContext(t)); err != nil {
+				t.Fatal(err)
+			}
+
+			posts := slack.Posts()
+			if len(posts) != 1 {
+				t.Fatalf("Made %d posts, want 1", len(posts))
+			}
+			if got := posts[0].Get("text"); got != test.want {
+				t.Errorf("Posted %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDestinationPipelineConfig(t *testing.T) {
+	tests := []struct {
+		pipeline string
+		wantErr  bool
+	}{
+		{`["test-reverse"]`, false},
+		{`["redact", "missing"]`, true},
+	}
+	for _, test := range tests {
+		fc, err := parseFileConfig([]byte(testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"pipeline": `+test.pipeline+`}}`)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := BuildConfiguration(fc, nil); (err != nil) != test.wantErr {
+			t.Errorf("BuildConfiguration() with destination pipeline %s = %v, want error %v", test.pipeline, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// deliveryQueue decouples ingress from fan-out: handlers enqueue verified
+// messages and return immediately, and a fixed pool of workers bridges
+// them. When the queue is full new messages are dropped.
+type deliveryQueue struct {
+	messages chan queuedMessage
+	pending  sync.WaitGroup
+}
+
+// queuedMessage is a message waiting to be bridged, with the group whose
+// in-flight slot it holds, if any, or other work such as syncing an edit.
+type queuedMessage struct {
+	slackMessage
+	group *Group
+	task  func()
+}
+
+var queue *deliveryQueue
+
+func StartQueue(size int, workers int) *deliveryQueue {
+	q := &deliveryQueue{messages: make(chan queuedMessage, size)}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	OnFlush(q.Flush)
+	return q
+}
+
+func (q *deliveryQueue) work() {
+	for queued := range q.messages {
+		switch {
+		case queued.task != nil:
+			queued.task()
+		case queued.group == nil && queued.Channel.routable():
+			bridgeRouted(queued.slackMessage)
+		default:
+			Bridge(queued.slackMessage)
+		}
+		if queued.group != nil {
+			queued.group.leave()
+		}
+		q.pending.Done()
+	}
+}
+
+// bridgeRouted bridges a message from a channel whose route was unknown
+// when it was queued. Once the route is resolved the message holds one of
+// its group's in-flight slots like any other.
+func bridgeRouted(msg slackMessage) {
+	group := msg.Channel.resolveRoute()
+	if group != nil && !group.enter() {
+		log.Printf("Group of %v has too many messages in flight, dropping message %v", msg.Channel, msg.Timestamp)
+		stats.Dropped(dropShed)
+		return
+	}
+	Bridge(msg)
+	if group != nil {
+		group.leave()
+	}
+}
+
+// Enqueue queues msg for bridging, reporting false if the queue or the
+// message's group was full and the message was dropped.
+func (q *deliveryQueue) Enqueue(msg slackMessage) bool {
+	stats.Received()
+	group := msg.Group()
+	if group != nil && !group.enter() {
+		log.Printf("Group of %v has too many messages in flight, dropping message %v", msg.Channel, msg.Timestamp)
+		stats.Dropped(dropShed)
+		return false
+	}
+
+	q.pending.Add(1)
+	select {
+	case q.messages <- queuedMessage{slackMessage: msg, group: group}:
+		return true
+	default:
+		q.pending.Done()
+		if group != nil {
+			group.leave()
+		}
+		stats.Dropped(dropQueueFull)
+		log.Printf("Delivery queue full, dropping message %v from %v", msg.Timestamp, msg.Channel)
+		return false
+	}
+}
+
+// Run queues task to run on a worker, reporting false if the queue was
+// full and the task, described by what, was dropped.
+func (q *deliveryQueue) Run(what string, task func()) bool {
+	q.pending.Add(1)
+	select {
+	case q.messages <- queuedMessage{task: task}:
+		return true
+	default:
+		q.pending.Done()
+		log.Printf("Delivery queue full, dropping %v", what)
+		return false
+	}
+}
+
+// Flush waits for queued and in-flight messages to be bridged.
+func (q *deliveryQueue) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		q.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		log.Printf("Shutdown grace expired with %v messages queued", len(q.messages))
+		return ctx.Err()
+	}
+}
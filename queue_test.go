@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestQueueDrains(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig(""))
+	useQueue(t)
+
+	for i := 0; i < 5; i++ {
+		msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: fmt.Sprintf("%d.000", i+1)}
+		if !queue.Enqueue(msg) {
+			t.Fatalf("Enqueue dropped message %d", i)
+		}
+	}
+	if err := queue.Flush(testContext(t)); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if posts := len(slack.Posts()); posts != 5 {
+		t.Errorf("Got %d posts, want 5", posts)
+	}
+	if received := stats.Snapshot(false).Received; received != 5 {
+		t.Errorf("Counted %d received, want 5", received)
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  string
+		size     int
+		wantKept int
+		wantDrop string
+	}{
+		{"queue full", "", 2, 2, dropQueueFull},
+		{"group in flight", `{"max_in_flight": 1}`, 10, 1, dropShed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(test.options))
+			// Without workers nothing leaves the queue.
+			q := &deliveryQueue{messages: make(chan queuedMessage, test.size)}
+			kept := 0
+			for i := 0; i < 3; i++ {
+				if q.Enqueue(slackMessage{Channel: Channel{teamA, chanA}, Timestamp: fmt.Sprintf("%d.000", i+1)}) {
+					kept++
+				}
+			}
+			if kept != test.wantKept {
+				t.Errorf("Kept %d messages, want %d", kept, test.wantKept)
+			}
+			if dropped := stats.Snapshot(false).Dropped[test.wantDrop]; dropped != int64(3-test.wantKept) {
+				t.Errorf("Counted %d %v drops, want %d", dropped, test.wantDrop, 3-test.wantKept)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := q.Flush(ctx); err != context.Canceled {
+				t.Errorf("Flush with messages stuck in the queue = %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
+
+func TestGroupInFlight(t *testing.T) {
+	limited, other := Channel{teamA, chanA}, Channel{teamA, chanC}
+	tests := []struct {
+		name     string
+		channels []Channel
+		wantKept int
+	}{
+		{"within the limit", []Channel{limited, limited}, 2},
+		{"shed", []Channel{limited, limited, limited}, 2},
+		{"other groups unaffected", []Channel{limited, limited, limited, other, other, other}, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"groups": [
+				{"channels": ["`+teamA+"/"+chanA+`", "`+teamB+"/"+chanB+`"], "options": {"max_in_flight": 2}},
+				{"channels": ["`+teamA+"/"+chanC+`", "`+teamB+"/"+chanC+`"]}
+			]`))
+			q := &deliveryQueue{messages: make(chan queuedMessage, 10)}
+			kept := 0
+			for i, channel := range test.channels {
+				if q.Enqueue(slackMessage{Channel: channel, Timestamp: fmt.Sprintf("%d.000", i+1)}) {
+					kept++
+				}
+			}
+			if kept != test.wantKept {
+				t.Errorf("Kept %d messages, want %d", kept, test.wantKept)
+			}
+			if shed := stats.Snapshot(false).Dropped[dropShed]; shed != int64(len(test.channels)-test.wantKept) {
+				t.Errorf("Counted %d shed, want %d", shed, len(test.channels)-test.wantKept)
+			}
+		})
+	}
+}
+
+func TestGroupInFlightReleased(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig(`{"max_in_flight": 1}`))
+	useQueue(t)
+
+	for i := 0; i < 3; i++ {
+		if !queue.Enqueue(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: fmt.Sprintf("%d.000", i+1)}) {
+			t.Fatalf("Enqueue shed message %d after the previous one was bridged", i)
+		}
+		if err := queue.Flush(testContext(t)); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	if posts := len(slack.Posts()); posts != 3 {
+		t.Errorf("Got %d posts, want 3", posts)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		workers  int
+		size     int
+		wantKept int
+		wantRan  int
+	}{
+		{"run by the workers", 2, 10, 3, 3},
+		{"queue full", 0, 2, 2, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(""))
+			isolateFlushers(t)
+			q := StartQueue(test.size, test.workers)
+			defer close(q.messages)
+
+			var mu sync.Mutex
+			ran, kept := 0, 0
+			for i := 0; i < 3; i++ {
+				if q.Run(fmt.Sprint("task ", i), func() { mu.Lock(); ran++; mu.Unlock() }) {
+					kept++
+				}
+			}
+			if kept != test.wantKept {
+				t.Errorf("Kept %d tasks, want %d", kept, test.wantKept)
+			}
+			if test.workers == 0 {
+				return
+			}
+			if err := q.Flush(testContext(t)); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if ran != test.wantRan {
+				t.Errorf("Ran %d tasks before Flush returned, want %d", ran, test.wantRan)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// minAdaptiveRate is the lowest rate, in posts per second, an adaptive
+// limiter backs off to.
+const minAdaptiveRate = 0.05
+
+// adaptiveRate paces posts to one destination. The rate is halved each
+// time Slack rate limits a post and grows by a tenth of the maximum with
+// each success, back up to the destination's max_rate.
+type adaptiveRate struct {
+	rate float64
+	next time.Time
+}
+
+type rateRegistry struct {
+	sync.Mutex
+	destinations map[Channel]*adaptiveRate
+}
+
+var rates = &rateRegistry{destinations: make(map[Channel]*adaptiveRate)}
+
+func (r *rateRegistry) get(c Channel, max float64) *adaptiveRate {
+	limiter, present := r.destinations[c]
+	if !present {
+		limiter = &adaptiveRate{rate: max}
+		r.destinations[c] = limiter
+	}
+	if limiter.rate > max {
+		limiter.rate = max
+	}
+	return limiter
+}
+
+// Wait blocks until the next post to c is allowed by its current rate,
+// reporting false if ctx expired first. Destinations without a max_rate
+// aren't paced.
+func (r *rateRegistry) Wait(ctx context.Context, c Channel) bool {
+	max := c.Options().MaxRate
+	if max <= 0 {
+		return true
+	}
+
+	r.Lock()
+	limiter := r.get(c, max)
+	at := limiter.next
+	if at.Before(now()) {
+		at = now()
+	}
+	limiter.next = at.Add(time.Duration(float64(time.Second) / limiter.rate))
+	r.Unlock()
+
+	return sleep(ctx, at.Sub(now()))
+}
+
+// Record adjusts c's rate with the outcome of a post.
+func (r *rateRegistry) Record(c Channel, err error) {
+	max := c.Options().MaxRate
+	if max <= 0 {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	limiter := r.get(c, max)
+	if _, limited := err.(*rateLimitedError); limited {
+		limiter.rate /= 2
+		if limiter.rate < minAdaptiveRate {
+			limiter.rate = minAdaptiveRate
+		}
+	} else if err == nil {
+		limiter.rate += max / 10
+		if limiter.rate > max {
+			limiter.rate = max
+		}
+	}
+}
+
+// Snapshot returns the current rate of each paced destination, keyed by
+// TID/CID.
+func (r *rateRegistry) Snapshot() map[string]float64 {
+	r.Lock()
+	defer r.Unlock()
+
+	snapshot := make(map[string]float64, len(r.destinations))
+	for c, limiter := range r.destinations {
+		snapshot[c.String()] = limiter.rate
+	}
+	return snapshot
+}
+
+// byteRegistry paces posts to destinations with a max_bytes_per_second by
+// the size of their serialized payloads, and counts the bytes posted.
+type byteRegistry struct {
+	sync.Mutex
+	next map[Channel]time.Time
+	sent map[Channel]int64
+}
+
+var byteRates = &byteRegistry{next: make(map[Channel]time.Time), sent: make(map[Channel]int64)}
+
+// Wait blocks until size more bytes may be posted to c, reporting false if
+// ctx expired first. A payload is let through once the time the previous
+// ones take at the destination's byte rate has passed.
+func (r *byteRegistry) Wait(ctx context.Context, c Channel, size int) bool {
+	limit := c.Options().MaxBytesPerSecond
+	r.Lock()
+	r.sent[c] += int64(size)
+	if limit <= 0 {
+		r.Unlock()
+		return true
+	}
+	at := r.next[c]
+	if at.Before(now()) {
+		at = now()
+	}
+	r.next[c] = at.Add(time.Duration(float64(size) / float64(limit) * float64(time.Second)))
+	r.Unlock()
+
+	return sleep(ctx, at.Sub(now()))
+}
+
+// Snapshot returns the bytes posted to each destination, keyed by TID/CID.
+func (r *byteRegistry) Snapshot() map[string]int64 {
+	r.Lock()
+	defer r.Unlock()
+
+	snapshot := make(map[string]int64, len(r.sent))
+	for c, n := range r.sent {
+		snapshot[c.String()] = n
+	}
+	return snapshot
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRate(t *testing.T) {
+	limited := &rateLimitedError{Err: errors.New("rate_limited")}
+	repeat := func(err error, n int) []error {
+		errs := make([]error, n)
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	tests := []struct {
+		name     string
+		maxRate  string
+		outcomes []error
+		want     float64
+	}{
+		{"rate limited", "10", []error{limited}, 5},
+		{"rate limited twice", "10", []error{limited, limited}, 2.5},
+		{"floor", "10", repeat(limited, 20), minAdaptiveRate},
+		{"successes recover", "10", []error{limited, limited, nil, nil}, 4.5},
+		{"recovered to the maximum", "10", append([]error{limited}, repeat(nil, 10)...), 10},
+		{"other errors keep the rate", "10", []error{limited, errors.New("channel_not_found")}, 5},
+		{"unpaced", "0", []error{limited}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"max_rate": `+test.maxRate+`}}`))
+			dest := Channel{teamB, chanB}
+			for _, err := range test.outcomes {
+				rates.Record(dest, err)
+			}
+			if got := rates.Snapshot()[dest.String()]; math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("Rate is %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRatePosts(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"max_rate": 10}}`))
+	advance := fakeClock(t)
+	dest := Channel{teamB, chanB}
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi"}
+
+	steps := []struct {
+		status   int
+		wantRate float64
+	}{
+		{429, 5},
+		{429, 2.5},
+		{0, 3.5},
+		{0, 4.5},
+	}
+	for i, step := range steps {
+		slack.Fail("webhook", step.status)
+		advance(time.Second)
+		dest.PostMessage(testContext(t), msg)
+		if got := stats.Snapshot(false).Rates[dest.String()]; math.Abs(got-step.wantRate) > 1e-9 {
+			t.Errorf("After post %d the rate is %v, want %v", i, got, step.wantRate)
+		}
+	}
+
+	// The last post, paced at 3.5 a second, made the next one due in
+	// 286ms, which an expired context doesn't wait for.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if rates.Wait(ctx, dest) {
+		t.Errorf("Wait allowed a post before it was due")
+	}
+}
+
+func TestByteRate(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         string
+		sizes         []int
+		gap           time.Duration
+		wantThrottled bool
+	}{
+		{"small payloads pass", "1000", []int{100, 200, 300}, time.Second, false},
+		{"large payload throttles the next", "1000", []int{5000}, time.Second, true},
+		{"large payload sent long ago", "1000", []int{5000}, 6 * time.Second, false},
+		{"bytes add up", "1000", []int{400, 400, 400}, time.Second, true},
+		{"unpaced", "0", []int{5000, 5000}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"max_bytes_per_second": `+test.limit+`}}`))
+			advance := fakeClock(t)
+			dest := Channel{teamB, chanB}
+
+			// Payloads take their share of the rate even when their
+			// context expires before they are due.
+			expired, cancel := context.WithCancel(context.Background())
+			cancel()
+			total := int64(1)
+			for _, size := range test.sizes {
+				byteRates.Wait(expired, dest, size)
+				total += int64(size)
+			}
+			advance(test.gap)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if got := byteRates.Wait(ctx, dest, 1); got == test.wantThrottled {
+				t.Errorf("Wait = %v, want throttled %v", got, test.wantThrottled)
+			}
+			if got := stats.Snapshot(false).BytesSent[dest.String()]; got != total {
+				t.Errorf("Counted %d bytes sent, want %d", got, total)
+			}
+		})
+	}
+}
+
+func TestByteRatePosts(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantPosts int
+	}{
+		{"small payloads pass", "hi", 2},
+		{"large payload throttled", strings.Repeat("x", 5000), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"max_bytes_per_second": 2000}}`))
+			advance := fakeClock(t)
+			dest := Channel{teamB, chanB}
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: test.text}
+
+			for i := 0; i < 2; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				dest.PostMessage(ctx, msg)
+				cancel()
+				advance(time.Second)
+			}
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Made %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
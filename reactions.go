@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"time"
+)
+
+type reactionEvent struct {
+	Type     string `json:"type"`
+	User     string `json:"user"`
+	Reaction string `json:"reaction"`
+	Item     struct {
+		Type      string `json:"type"`
+		Channel   string `json:"channel"`
+		Timestamp string `json:"ts"`
+	} `json:"item"`
+}
+
+// mirroredReactions holds the reactions the bridge added itself, so the
+// reaction_added events they cause aren't mirrored again.
+var mirroredReactions = newCache(10000, 10*time.Minute)
+
+func reactionKey(c Channel, ts string, reaction string) string {
+	return c.String() + "/" + ts + "/" + reaction
+}
+
+// handleReaction runs the group's action for the reaction, if it has one,
+// and otherwise mirrors a reaction on a forwarded message onto the source
+// message it was forwarded from.
+func handleReaction(envelope eventEnvelope) {
+	var event reactionEvent
+	if err := json.Unmarshal(envelope.Event, &event); err != nil {
+		log.Printf("Malformed event %v: %v", envelope.EventId, err)
+		return
+	}
+	if event.Item.Type != "message" {
+		return
+	}
+
+	dest := resolveChannel(envelope.TeamId, event.Item.Channel, nil)
+	key := reactionKey(dest, event.Item.Timestamp, event.Reaction)
+	if _, present := mirroredReactions.Get(key); present {
+		mirroredReactions.Delete(key)
+		return
+	}
+
+	group := dest.Group()
+	if group == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	if action, present := group.Options.ReactionActions[event.Reaction]; present {
+		if !group.Options.ReactionActionUsers.Contains(event.User) {
+			log.Printf("Ignoring :%v: on %v by unauthorized user %v", event.Reaction, dest, event.User)
+			return
+		}
+		if err := runReactionAction(ctx, action, dest, event.Item.Timestamp); err != nil {
+			log.Printf("Unable to %v message %v in %v: %v", action, event.Item.Timestamp, dest, err)
+		}
+		return
+	}
+
+	if !group.Options.MirrorReactions {
+		return
+	}
+	source, ts, ok := mirrors.Source(dest, event.Item.Timestamp)
+	if !ok || source.GetTeam() == nil {
+		return
+	}
+
+	if err := source.AddReaction(ctx, ts, event.Reaction); err != nil {
+		log.Printf("Unable to mirror :%v: from %v to %v: %v", event.Reaction, dest, source, err)
+	}
+}
+
+// AddReaction reacts to message ts in the channel, recording the reaction
+// so it isn't mirrored back.
+func (c Channel) AddReaction(ctx context.Context, ts string, reaction string) error {
+	key := reactionKey(c, ts, reaction)
+	mirroredReactions.Set(key, true)
+
+	values := url.Values{"channel": {c.ChannelId}, "timestamp": {ts}, "name": {reaction}}
+	err := c.GetTeam().apiCall(ctx, "reactions.add", values, nil)
+	if err != nil {
+		mirroredReactions.Delete(key)
+		if apiErr, ok := err.(*apiError); ok && apiErr.Code == "already_reacted" {
+			return nil
+		}
+	}
+	return err
+}
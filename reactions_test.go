@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// reactionEnvelope builds a reaction_added event for message ts in
+// channel.
+func reactionEnvelope(channel Channel, ts string, reaction string) eventEnvelope {
+	event, _ := json.Marshal(map[string]interface{}{
+		"type":     "reaction_added",
+		"user":     "U0000000B",
+		"reaction": reaction,
+		"item":     map[string]string{"type": "message", "channel": channel.ChannelId, "ts": ts},
+	})
+	return eventEnvelope{Type: "event_callback", TeamId: channel.TeamId, EventId: "Ev1", Event: event}
+}
+
+func TestMirrorReactions(t *testing.T) {
+	source := Channel{teamA, chanA}
+	dest := Channel{teamB, chanB}
+	tests := []struct {
+		name    string
+		options string
+		channel Channel
+		ts      string
+		want    bool
+	}{
+		{"mirrored", `{"mirror_reactions": true}`, dest, "9.000", true},
+		{"disabled", "", dest, "9.000", false},
+		{"unknown message", `{"mirror_reactions": true}`, dest, "8.000", false},
+		{"unmapped channel", `{"mirror_reactions": true}`, Channel{teamB, chanC}, "9.000", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			mirrors.Record(source, "1.000", dest, "9.000")
+
+			handleReaction(reactionEnvelope(test.channel, test.ts, "white_check_mark"))
+
+			calls := slack.Calls("reactions.add")
+			if !test.want {
+				if len(calls) != 0 {
+					t.Errorf("Added %v, want no reaction", calls)
+				}
+				return
+			}
+			if len(calls) != 1 {
+				t.Fatalf("Added %d reactions, want 1", len(calls))
+			}
+			call := calls[0]
+			if call.Get("channel") != chanA || call.Get("timestamp") != "1.000" || call.Get("name") != "white_check_mark" || call.Get("token") != "xoxb-a" {
+				t.Errorf("Added the reaction with %v", call.Form)
+			}
+
+			// The event for the bridge's own reaction isn't mirrored back.
+			handleReaction(reactionEnvelope(source, "1.000", "white_check_mark"))
+			if calls := slack.Calls("reactions.add"); len(calls) != 1 {
+				t.Errorf("Mirrored reaction re-triggered %d times", len(calls)-1)
+			}
+		})
+	}
+}
+
+func TestAddReactionAlreadyReacted(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.Handle("reactions.add", func(fakeCall) string { return `{"ok":false,"error":"already_reacted"}` })
+	useConfig(t, testConfig(""))
+
+	source := Channel{teamA, chanA}
+	if err := source.AddReaction(testContext(t), "1.000", "eyes"); err != nil {
+		t.Errorf("AddReaction = %v, want already_reacted ignored", err)
+	}
+	if _, present := mirroredReactions.Get(reactionKey(source, "1.000", "eyes")); present {
+		t.Errorf("Reaction recorded as mirrored though it wasn't added")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const defaultRedactMask = "[redacted]"
+
+// builtinRedactions are the named patterns accepted in a group's redact
+// option; any other entry is compiled as a regular expression. Phone
+// numbers must be international, starting with +, or grouped as
+// (NNN) NNN-NNNN or NNN-NNN-NNNN, so that dates, IDs, versions and the
+// digits in links are left alone.
+var builtinRedactions = map[string]*regexp.Regexp{
+	"email": regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	"phone": regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?)?(?:[ .-]?\d{2,4}){2,4}\b|\(\d{3}\) ?\d{3}[ .-]\d{4}\b|\b\d{3}[ .-]\d{3}[ .-]\d{4}\b`),
+}
+
+func compileRedactions(patterns []string) ([]*regexp.Regexp, error) {
+	redactions := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if builtin, present := builtinRedactions[pattern]; present {
+			redactions = append(redactions, builtin)
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid redact pattern %q: %v", pattern, err)
+		}
+		redactions = append(redactions, re)
+	}
+	return redactions, nil
+}
+
+// Redact masks every match of the group's redaction patterns in the text.
+func (msg *slackMessage) Redact() {
+	group := msg.Group()
+	mask := group.Options.RedactMask
+	if mask == "" {
+		mask = defaultRedactMask
+	}
+	for _, re := range group.redactions {
+		msg.Text = re.ReplaceAllLiteralString(msg.Text, mask)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		text    string
+		want    string
+	}{
+		{"email", `{"redact": ["email"]}`, "Mail alice@example.com now", "Mail [redacted] now"},
+		{"international phone", `{"redact": ["phone"]}`, "Call +44 20 7946 0958.", "Call [redacted]."},
+		{"international phone with area code", `{"redact": ["phone"]}`, "Call +1 (415) 555-2671", "Call [redacted]"},
+		{"compact international phone", `{"redact": ["phone"]}`, "Call +14155552671 today", "Call [redacted] today"},
+		{"national phone", `{"redact": ["phone"]}`, "Call (415) 555-2671", "Call [redacted]"},
+		{"grouped phone", `{"redact": ["phone"]}`, "Call 415-555-2671 or 415.555.2671", "Call [redacted] or [redacted]"},
+		{"both", `{"redact": ["email", "phone"]}`, "bob@example.org, +33 1 23 45 67 89", "[redacted], [redacted]"},
+		{"custom mask", `{"redact": ["email"], "redact_mask": "***"}`, "alice@example.com", "***"},
+		{"custom pattern", `{"redact": ["ACME-\\d+"]}`, "See ACME-1234", "See [redacted]"},
+		{"plain text", `{"redact": ["email", "phone"]}`, "Nothing to see here", "Nothing to see here"},
+
+		// None of these are phone numbers.
+		{"iso date", `{"redact": ["phone"]}`, "Released 2017-03-01", "Released 2017-03-01"},
+		{"iso timestamp", `{"redact": ["phone"]}`, "At 2017-03-01T12:00:00Z", "At 2017-03-01T12:00:00Z"},
+		{"date range", `{"redact": ["phone"]}`, "2017-03-01 - 2017-03-31", "2017-03-01 - 2017-03-31"},
+		{"id", `{"redact": ["phone"]}`, "Order 1488369600000100", "Order 1488369600000100"},
+		{"message timestamp", `{"redact": ["phone"]}`, "ts 1488369600.000100", "ts 1488369600.000100"},
+		{"version", `{"redact": ["phone"]}`, "Upgrade to v10.13.6 or 2.0.1-rc.12", "Upgrade to v10.13.6 or 2.0.1-rc.12"},
+		{"ip address", `{"redact": ["phone"]}`, "Host 192.168.100.200", "Host 192.168.100.200"},
+		{"url", `{"redact": ["phone"]}`, "<https://ci.example.com/builds/123456789/steps/1234-5678>", "<https://ci.example.com/builds/123456789/steps/1234-5678>"},
+		{"amount", `{"redact": ["phone"]}`, "Costs 1 234 567.89", "Costs 1 234 567.89"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(test.options))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: test.text}
+			msg.Redact()
+			if msg.Text != test.want {
+				t.Errorf("Redact(%q) = %q, want %q", test.text, msg.Text, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileRedactions(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  bool
+	}{
+		{[]string{"email", "phone"}, false},
+		{[]string{`\d{4}`}, false},
+		{[]string{"("}, true},
+	}
+	for _, test := range tests {
+		if _, err := compileRedactions(test.patterns); (err != nil) != test.wantErr {
+			t.Errorf("compileRedactions(%q) error = %v, want error %v", test.patterns, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const defaultReplyCountDelay = 30 * time.Second
+
+// replyCountUpdates holds the pending reply count update of each source
+// thread, so a burst of replies updates the mirrored roots once. running
+// counts the updates that are pending or still being made.
+var replyCountUpdates = struct {
+	sync.Mutex
+	pending map[mirrorKey]*time.Timer
+	running sync.WaitGroup
+}{pending: make(map[mirrorKey]*time.Timer)}
+
+// ScheduleReplyCount updates the mirrors of the reply's thread root with
+// its reply count once the group's ReplyCountDelay has passed without
+// another reply.
+func (msg *slackMessage) ScheduleReplyCount() {
+	delay := msg.Group().Options.ReplyCountDelay.Duration
+	if delay <= 0 {
+		delay = defaultReplyCountDelay
+	}
+	key := mirrorKey{msg.Channel, msg.ThreadTimestamp}
+
+	replyCountUpdates.Lock()
+	defer replyCountUpdates.Unlock()
+	// A timer that already fired is making its update, so the reply gets
+	// one of its own.
+	if timer, present := replyCountUpdates.pending[key]; present && timer.Stop() {
+		timer.Reset(delay)
+		return
+	}
+	var timer *time.Timer
+	replyCountUpdates.running.Add(1)
+	timer = time.AfterFunc(delay, func() {
+		defer replyCountUpdates.running.Done()
+		replyCountUpdates.Lock()
+		if replyCountUpdates.pending[key] == timer {
+			delete(replyCountUpdates.pending, key)
+		}
+		replyCountUpdates.Unlock()
+		key.Channel.UpdateReplyCount(key.Timestamp)
+	})
+	replyCountUpdates.pending[key] = timer
+}
+
+// stopReplyCounts cancels the pending reply count updates and waits for
+// those being made.
+func stopReplyCounts() {
+	replyCountUpdates.Lock()
+	for key, timer := range replyCountUpdates.pending {
+		if timer.Stop() {
+			replyCountUpdates.running.Done()
+		}
+		delete(replyCountUpdates.pending, key)
+	}
+	replyCountUpdates.Unlock()
+	replyCountUpdates.running.Wait()
+}
+
+// UpdateReplyCount rewrites the mirrors of thread root ts, run through the
+// group's pipeline again, with the thread's current reply count.
+func (c Channel) UpdateReplyCount(ts string) {
+	mirrored := mirrors.Destinations(c, ts)
+	if len(mirrored) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	root, count, err := c.FetchThreadRoot(ctx, ts)
+	if err != nil {
+		log.Printf("Unable to fetch thread %v in %v: %v", ts, c, err)
+		return
+	}
+	root.Transform(ctx)
+	if count == 1 {
+		root.Text += "\n💬 1 reply"
+	} else if count > 1 {
+		root.Text += fmt.Sprintf("\n💬 %v replies", count)
+	}
+	for dest, destTs := range mirrored {
+		if err := dest.UpdateMessage(ctx, destTs, root); err != nil {
+			log.Printf("Unable to update reply count of %v in %v: %v", destTs, dest, err)
+		}
+	}
+}
+
+// FetchThreadRoot reads thread root ts and its reply count with
+// conversations.replies.
+func (c Channel) FetchThreadRoot(ctx context.Context, ts string) (slackMessage, int, error) {
+	var response struct {
+		Messages []struct {
+			messageEvent
+			ReplyCount int `json:"reply_count"`
+		} `json:"messages"`
+	}
+	values := url.Values{"channel": {c.ChannelId}, "ts": {ts}, "limit": {"1"}}
+	if err := c.GetTeam().apiCall(ctx, "conversations.replies", values, &response); err != nil {
+		return slackMessage{}, 0, err
+	}
+	if len(response.Messages) == 0 || response.Messages[0].Timestamp != ts {
+		return slackMessage{}, 0, fmt.Errorf("Thread %v not found in %v", ts, c)
+	}
+	root := response.Messages[0]
+	return root.message(c), root.ReplyCount, nil
+}
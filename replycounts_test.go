@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReplyCounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     string
+		mirrored    bool
+		gaps        []time.Duration
+		replyCount  int
+		wantUpdates []string
+	}{
+		{"one reply", `{"reply_counts": true, "reply_count_delay": "30ms"}`, true,
+			[]time.Duration{0}, 1, []string{"root\n💬 1 reply"}},
+		{"burst debounced", `{"reply_counts": true, "reply_count_delay": "30ms"}`, true,
+			[]time.Duration{0, 5 * time.Millisecond, 5 * time.Millisecond}, 3, []string{"root\n💬 3 replies"}},
+		{"spaced replies", `{"reply_counts": true, "reply_count_delay": "30ms"}`, true,
+			[]time.Duration{0, 100 * time.Millisecond}, 2, []string{"root\n💬 2 replies", "root\n💬 2 replies"}},
+		{"unmirrored root", `{"reply_counts": true, "reply_count_delay": "30ms"}`, false,
+			[]time.Duration{0}, 1, nil},
+		{"disabled", `{}`, true, []time.Duration{0}, 1, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.replies", func(fakeCall) string {
+				return fmt.Sprintf(`{"ok":true,"messages":[{"type":"message","user":"U0000000A","text":"root","ts":"1.000","reply_count":%d}]}`, test.replyCount)
+			})
+			useConfig(t, testConfig(test.options))
+			if test.mirrored {
+				mirrors.Record(Channel{teamA, chanA}, "1.000", Channel{teamB, chanB}, "9.000")
+			}
+
+			for i, gap := range test.gaps {
+				time.Sleep(gap)
+				Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "reply",
+					Timestamp: fmt.Sprintf("%d.000", i+2), ThreadTimestamp: "1.000"})
+			}
+			// Wait for the pending updates to be made.
+			replyCountUpdates.running.Wait()
+
+			updates := slack.Calls("chat.update")
+			if len(updates) != len(test.wantUpdates) {
+				t.Fatalf("Made %d chat.update calls, want %d", len(updates), len(test.wantUpdates))
+			}
+			for i, update := range updates {
+				if update.Get("ts") != "9.000" || update.Get("channel") != chanB || update.Get("text") != test.wantUpdates[i] {
+					t.Errorf("Update %d set %v in %v to %q, want %q on the mirror", i, update.Get("ts"), update.Get("channel"), update.Get("text"), test.wantUpdates[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStopReplyCounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		delay       string
+		wantUpdates int
+	}{
+		{"pending update cancelled", "1h", 0},
+		{"update being made waited for", "1ms", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.replies", func(fakeCall) string {
+				time.Sleep(20 * time.Millisecond)
+				return `{"ok":true,"messages":[{"type":"message","user":"U0000000A","text":"root","ts":"1.000","reply_count":1}]}`
+			})
+			useConfig(t, testConfig(`{"reply_counts": true, "reply_count_delay": "`+test.delay+`"}`))
+			mirrors.Record(Channel{teamA, chanA}, "1.000", Channel{teamB, chanB}, "9.000")
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: "reply", Timestamp: "2.000", ThreadTimestamp: "1.000"}
+			msg.ScheduleReplyCount()
+			if test.wantUpdates > 0 {
+				waitFor(t, "the update to start", func() bool { return len(slack.Calls("conversations.replies")) > 0 })
+			}
+			stopReplyCounts()
+
+			if updates := len(slack.Calls("chat.update")); updates != test.wantUpdates {
+				t.Errorf("Made %d updates by the time stopReplyCounts returned, want %d", updates, test.wantUpdates)
+			}
+			replyCountUpdates.Lock()
+			defer replyCountUpdates.Unlock()
+			if len(replyCountUpdates.pending) != 0 {
+				t.Errorf("Kept %d pending updates", len(replyCountUpdates.pending))
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errBatched = errors.New("added to a pending batch")
+
+// Deliver posts msg to the channel, or adds it to the channel's pending
+// batch when the group coalesces messages by author or the destination
+// batches messages. Batched messages return errBatched: they are counted
+// and confirmed once the batch is posted.
+func (c Channel) Deliver(ctx context.Context, msg slackMessage) error {
+	if msg.batchable() {
+		if window := msg.Group().Options.CoalesceWindow.Duration; window > 0 {
+			batches.Add(c, msg, window, true)
+			return errBatched
+		}
+		if window := c.Options().BatchWindow.Duration; window > 0 {
+			batches.Add(c, msg, window, false)
+			return errBatched
+		}
+	}
+	return c.deliverNow(ctx, msg)
+}
+
+// deliverNow posts msg to the channel, retrying failed posts up to
+// PostRetries times with exponential backoff from RetryDelay, or after
+// the delay Slack asked for when rate limited. Posts that can't succeed on
+// retry, such as those skipped by an open breaker or refused for their
+// token or channel, are not retried. Messages that fail every attempt go
+// to the dead-letter queue. The outcome is sent to the group's audit
+// webhook.
+func (c Channel) deliverNow(ctx context.Context, msg slackMessage) error {
+	start := now()
+	err := c.PostMessage(ctx, msg)
+	attempts := 1
+	delay := config().settings.RetryDelay.Duration
+	for ; err != nil && retryable(err) && attempts <= config().settings.PostRetries; attempts++ {
+		wait := delay
+		if limited, ok := err.(*rateLimitedError); ok && limited.RetryAfter > 0 {
+			wait = limited.RetryAfter
+		}
+		if !sleep(ctx, wait) {
+			break
+		}
+		delay *= 2
+		err = c.PostMessage(ctx, msg)
+	}
+	if err != nil {
+		deadLetters.Add(c, msg, err)
+	}
+	c.audit(msg, err, attempts, now().Sub(start))
+	return err
+}
+
+func retryable(err error) bool {
+	switch err.(type) {
+	case *authError, *channelNotFoundError:
+		return false
+	}
+	return err != errUnknownTeam && err != errBreakerOpen && err != errPaused
+}
+
+// sleep waits for d, reporting false if ctx expired first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
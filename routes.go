@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"time"
+)
+
+// RouteConfig adds the team's unmapped channels whose names match Pattern,
+// a glob such as "team-*", or Regexp to the group containing the channel
+// Group, as sources. Token is the outgoing webhook token that payloads
+// from routed channels carry to /bridge.
+type RouteConfig struct {
+	Team    string      `json:"team"`
+	Pattern string      `json:"pattern,omitempty"`
+	Regexp  string      `json:"regexp,omitempty"`
+	Group   string      `json:"group"`
+	Token   Credentials `json:"token,omitempty"`
+}
+
+type route struct {
+	RouteConfig
+	teamId string
+	regexp *regexp.Regexp
+	group  *Group
+}
+
+func (r route) matches(name string) bool {
+	if r.regexp != nil {
+		return r.regexp.MatchString(name)
+	}
+	matched, _ := path.Match(r.Pattern, name)
+	return matched
+}
+
+// buildRoute validates rc, finding its group in channelMap.
+func buildRoute(rc RouteConfig, channelMap map[Channel]*Group) (route, error) {
+	r := route{RouteConfig: rc}
+	var err error
+	if r.teamId, err = normalizeId(rc.Team, teamIdPrefixes, "team"); err != nil {
+		return r, fmt.Errorf("Invalid route: %v", err)
+	}
+	switch {
+	case (rc.Pattern == "") == (rc.Regexp == ""):
+		return r, fmt.Errorf("Route for team %v needs one of pattern or regexp", r.teamId)
+	case rc.Pattern != "":
+		if _, err := path.Match(rc.Pattern, ""); err != nil {
+			return r, fmt.Errorf("Invalid route pattern %q: %v", rc.Pattern, err)
+		}
+	default:
+		if r.regexp, err = regexp.Compile(rc.Regexp); err != nil {
+			return r, fmt.Errorf("Invalid route regexp %q: %v", rc.Regexp, err)
+		}
+	}
+	channel, err := ParseChannel(rc.Group)
+	if err != nil {
+		return r, fmt.Errorf("Invalid route group: %v", err)
+	}
+	if r.group = channelMap[channel]; r.group == nil {
+		return r, fmt.Errorf("Route group %v is not a mapped channel", channel)
+	}
+	return r, nil
+}
+
+// channelNames caches the name of each channel looked up for routing.
+// Channels whose name matches no route stay cached, so they aren't looked
+// up again on every message. Lookups that fail are kept in
+// channelNameFailures, so a failing team isn't asked on every message.
+var (
+	channelNames        = newCache(10000, time.Hour)
+	channelNameFailures = newCache(10000, time.Minute)
+)
+
+// ChannelName returns the name of channel, using conversations.info.
+func (t *Team) ChannelName(ctx context.Context, channel string) (string, error) {
+	key := t.Id + "/" + channel
+	if name, present := channelNames.Get(key); present {
+		return name.(string), nil
+	}
+
+	var response struct {
+		Channel struct {
+			Name string `json:"name"`
+		} `json:"channel"`
+	}
+	if err := t.apiCall(ctx, "conversations.info", url.Values{"channel": {channel}}, &response); err != nil {
+		return "", err
+	}
+	channelNames.Set(key, response.Channel.Name)
+	return response.Channel.Name, nil
+}
+
+// routes returns the routes for the team of c when it isn't mapped.
+func (c Channel) routes() []route {
+	if _, present := config().channelMap[c]; present || c.IsUser() {
+		return nil
+	}
+	var routes []route
+	for _, r := range config().routes {
+		if r.teamId == c.TeamId {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// routable reports whether the unmapped channel c could be added to a
+// group by a route.
+func (c Channel) routable() bool {
+	return len(c.routes()) > 0
+}
+
+// verifyRouteToken reports whether token is the outgoing webhook token of
+// a route that could add the unmapped channel c to a group.
+func (c Channel) verifyRouteToken(token string) bool {
+	for _, r := range c.routes() {
+		if r.Token.Accepts(token) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRoute(routes []route, name string) *Group {
+	for _, r := range routes {
+		if r.matches(name) {
+			return r.group
+		}
+	}
+	return nil
+}
+
+// routedGroup returns the group of the first route matching the name of
+// the unmapped channel c, or nil. It never calls Slack: a channel's name
+// is only known once resolveRoute has looked it up.
+func (c Channel) routedGroup() *Group {
+	routes := c.routes()
+	if len(routes) == 0 {
+		return nil
+	}
+	name, present := channelNames.Get(c.String())
+	if !present {
+		return nil
+	}
+	return matchRoute(routes, name.(string))
+}
+
+// resolveRoute looks up the name of the unmapped channel c, returning the
+// group of the first route matching it. It is called by the queue's
+// workers, so only verified payloads cause a lookup and receiving them
+// isn't held up by it.
+func (c Channel) resolveRoute() *Group {
+	routes := c.routes()
+	if len(routes) == 0 || c.GetTeam() == nil {
+		return nil
+	}
+	key := c.String()
+	if _, failed := channelNameFailures.Get(key); failed {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+	name, err := c.GetTeam().ChannelName(ctx, c.ChannelId)
+	if err != nil {
+		log.Printf("Unable to look up the name of %v for routing: %v", c, err)
+		channelNameFailures.Set(key, true)
+		return nil
+	}
+	return matchRoute(routes, name)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+const chanD = "C0000000D"
+
+func TestBuildRoute(t *testing.T) {
+	group := &Group{}
+	channelMap := map[Channel]*Group{{teamA, chanA}: group}
+	tests := []struct {
+		name    string
+		route   RouteConfig
+		matches string
+		wantErr bool
+	}{
+		{"glob", RouteConfig{Team: teamA, Pattern: "team-*", Group: teamA + "/" + chanA}, "team-alpha", false},
+		{"regexp", RouteConfig{Team: teamA, Regexp: "^ops-(eu|us)$", Group: teamA + "/" + chanA}, "ops-eu", false},
+		{"pattern and regexp", RouteConfig{Team: teamA, Pattern: "team-*", Regexp: "team", Group: teamA + "/" + chanA}, "", true},
+		{"neither", RouteConfig{Team: teamA, Group: teamA + "/" + chanA}, "", true},
+		{"invalid glob", RouteConfig{Team: teamA, Pattern: "team-[", Group: teamA + "/" + chanA}, "", true},
+		{"invalid regexp", RouteConfig{Team: teamA, Regexp: "team-(", Group: teamA + "/" + chanA}, "", true},
+		{"unmapped group", RouteConfig{Team: teamA, Pattern: "team-*", Group: teamA + "/" + chanC}, "", true},
+		{"invalid team", RouteConfig{Team: "acme", Pattern: "team-*", Group: teamA + "/" + chanA}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := buildRoute(test.route, channelMap)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("buildRoute() = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if r.group != group || !r.matches(test.matches) || r.matches("general") {
+				t.Errorf("Route %+v doesn't match only %q in the group", test.route, test.matches)
+			}
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		name      string
+		route     string
+		response  string
+		event     string
+		wantPosts int
+		wantCalls int
+	}{
+		{"glob", `{"team": "` + teamA + `", "pattern": "team-*", "group": "` + teamA + "/" + chanA + `"}`,
+			`{"ok":true,"channel":{"name":"team-alpha"}}`, `"user":"U0000000A"`, 4, 1},
+		{"regexp", `{"team": "` + teamA + `", "regexp": "^team-(alpha|beta)$", "group": "` + teamA + "/" + chanA + `"}`,
+			`{"ok":true,"channel":{"name":"team-alpha"}}`, `"user":"U0000000A"`, 4, 1},
+		{"no matching route", `{"team": "` + teamA + `", "pattern": "ops-*", "group": "` + teamA + "/" + chanA + `"}`,
+			`{"ok":true,"channel":{"name":"team-alpha"}}`, `"user":"U0000000A"`, 0, 1},
+		{"failed lookup", `{"team": "` + teamA + `", "pattern": "team-*", "group": "` + teamA + "/" + chanA + `"}`,
+			`{"ok":false,"error":"channel_not_found"}`, `"user":"U0000000A"`, 0, 1},
+		{"route for another team", `{"team": "` + teamB + `", "pattern": "team-*", "group": "` + teamA + "/" + chanA + `"}`,
+			`{"ok":true,"channel":{"name":"team-alpha"}}`, `"user":"U0000000A"`, 0, 0},
+		{"bot message filtered on the worker", `{"team": "` + teamA + `", "pattern": "team-*", "group": "` + teamA + "/" + chanA + `"}`,
+			`{"ok":true,"channel":{"name":"team-alpha"}}`, `"subtype":"bot_message","bot_id":"B1","username":"ci"`, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.info", func(fakeCall) string { return test.response })
+			useConfig(t, testConfig("", `"routes": [`+test.route+`]`, `"settings": {"archive_check_interval": "0s"}`))
+			useQueue(t)
+
+			// The second message must be routed from the cached name.
+			for i := 1; i <= 2; i++ {
+				event := fmt.Sprintf(`{"type":"message","channel":%q,%v,"text":"hi","ts":"%d.000"}`, chanD, test.event, i)
+				handleEvent(eventEnvelope{Type: "event_callback", TeamId: teamA, EventId: fmt.Sprint("Ev", i), Event: json.RawMessage(event)})
+			}
+			if err := queue.Flush(testContext(t)); err != nil {
+				t.Fatal(err)
+			}
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Made %d posts, want %d", posts, test.wantPosts)
+			}
+			if calls := len(slack.Calls("conversations.info")); calls != test.wantCalls {
+				t.Errorf("Made %d conversations.info calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRoutingBeforeVerification(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.Handle("conversations.info", func(fakeCall) string { return `{"ok":true,"channel":{"name":"team-alpha"}}` })
+	useConfig(t, testConfig("", `"routes": [{"team": "`+teamA+`", "pattern": "team-*", "group": "`+teamA+"/"+chanA+`"}]`))
+	useQueue(t)
+
+	if group := (Channel{teamA, chanD}).Group(); group != nil {
+		t.Errorf("Unresolved channel has group %v", group)
+	}
+	w := serveRequest(bridgeHandler, "/bridge", postForm("/bridge", url.Values{
+		"token":      {"forged"},
+		"team_id":    {teamA},
+		"channel_id": {chanD},
+		"user_name":  {"mallory"},
+		"text":       {"hello"},
+		"timestamp":  {"1488369600.000100"},
+	}))
+	if w.Code != 200 {
+		t.Fatalf("bridgeHandler returned %v", w.Code)
+	}
+	queue.Flush(testContext(t))
+	if calls := len(slack.Calls("conversations.info")); calls != 0 {
+		t.Errorf("Made %d conversations.info calls for an unverified payload", calls)
+	}
+}
+
+func TestRoutedBridge(t *testing.T) {
+	tests := []struct {
+		name        string
+		routeToken  string
+		token       string
+		holdSlot    bool
+		wantPosts   int
+		wantCalls   int
+		wantDropped int64
+	}{
+		{"route token", `, "token": "out-routed"`, "out-routed", false, 2, 1, 0},
+		{"wrong token", `, "token": "out-routed"`, "forged", false, 0, 0, 0},
+		{"route without a token", ``, "out-routed", false, 0, 0, 0},
+		{"group in flight", `, "token": "out-routed"`, "out-routed", true, 0, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("conversations.info", func(fakeCall) string { return `{"ok":true,"channel":{"name":"team-alpha"}}` })
+			useConfig(t, testConfig(`{"max_in_flight": 1}`,
+				`"routes": [{"team": "`+teamA+`", "pattern": "team-*", "group": "`+teamA+"/"+chanA+`"`+test.routeToken+`}]`,
+				`"settings": {"archive_check_interval": "0s"}`))
+			useQueue(t)
+			if test.holdSlot {
+				group := (Channel{teamA, chanA}).Group()
+				group.enter()
+				defer group.leave()
+			}
+
+			w := serveRequest(bridgeHandler, "/bridge", postForm("/bridge", url.Values{
+				"token":      {test.token},
+				"team_id":    {teamA},
+				"channel_id": {chanD},
+				"user_name":  {"alice"},
+				"text":       {"hello"},
+				"timestamp":  {"1488369600.000100"},
+			}))
+			if w.Code != 200 {
+				t.Fatalf("bridgeHandler returned %v", w.Code)
+			}
+			if err := queue.Flush(testContext(t)); err != nil {
+				t.Fatal(err)
+			}
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Made %d posts, want %d", posts, test.wantPosts)
+			}
+			if calls := len(slack.Calls("conversations.info")); calls != test.wantCalls {
+				t.Errorf("Made %d conversations.info calls, want %d", calls, test.wantCalls)
+			}
+			if dropped := stats.Snapshot(false).Dropped[dropShed]; dropped != test.wantDropped {
+				t.Errorf("Counted %d shed, want %d", dropped, test.wantDropped)
+			}
+		})
+	}
+}
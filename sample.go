@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+)
+
+// Sampled reports whether the message falls within its group's sample
+// rate. The decision hashes the message's channel and timestamp, so
+// re-deliveries of a message are always sampled the same way. The hash is
+// SHA-256 as FNV spreads runs of similar timestamps unevenly.
+func (msg *slackMessage) Sampled() bool {
+	rate := msg.Group().Options.SampleRate
+	if rate == nil || *rate >= 1 {
+		return true
+	}
+
+	key := msg.Channel.String() + "/" + msg.Timestamp
+	if msg.Timestamp == "" {
+		key += msg.Text
+	}
+	sum := sha256.Sum256([]byte(key))
+	return float64(binary.BigEndian.Uint64(sum[:8]))/math.MaxUint64 < *rate
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSampled(t *testing.T) {
+	const messages = 10000
+	tests := []struct {
+		options string
+		want    float64
+	}{
+		{"", 1},
+		{`{"sample_rate": 1}`, 1},
+		{`{"sample_rate": 0.25}`, 0.25},
+		{`{"sample_rate": 0.5}`, 0.5},
+		{`{"sample_rate": 0}`, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.options, func(t *testing.T) {
+			useConfig(t, testConfig(test.options))
+			sampled := 0
+			for i := 0; i < messages; i++ {
+				msg := slackMessage{Channel: Channel{teamA, chanA}, Timestamp: fmt.Sprintf("1488369600.%06d", i)}
+				first := msg.Sampled()
+				if first {
+					sampled++
+				}
+				// A re-delivery is sampled the same way.
+				if again := msg.Sampled(); again != first {
+					t.Fatalf("Message %v sampled inconsistently", msg.Timestamp)
+				}
+			}
+			if got := float64(sampled) / messages; math.Abs(got-test.want) > 0.02 {
+				t.Errorf("Sampled %.3f of messages, want about %.2f", got, test.want)
+			}
+		})
+	}
+}
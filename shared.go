@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+)
+
+// sharedChannels caches whether each configured channel is shared with
+// other workspaces. Failed checks are cached as not shared for a minute, in
+// sharedFailures, so a failing team isn't asked on every payload.
+var (
+	sharedChannels = newCache(10000, time.Hour)
+	sharedFailures = newCache(10000, time.Minute)
+)
+
+// IsShared reports whether channel is shared with other workspaces, using
+// conversations.info.
+func (t *Team) IsShared(ctx context.Context, channel string) (bool, error) {
+	var response struct {
+		Channel struct {
+			IsShared    bool `json:"is_shared"`
+			IsExtShared bool `json:"is_ext_shared"`
+		} `json:"channel"`
+	}
+	if err := t.apiCall(ctx, "conversations.info", url.Values{"channel": {channel}}, &response); err != nil {
+		return false, err
+	}
+	return response.Channel.IsShared || response.Channel.IsExtShared, nil
+}
+
+// resolveChannel returns the configured channel a payload from teamId
+// about channelId refers to. A Slack Connect channel has the same ID in
+// every workspace it is shared with, so a payload can name a team other
+// than the one it is configured under. When the channel isn't mapped
+// under teamId, the channel configured under another team with the same
+// ID is used if that team confirms it is shared, so it is bridged and
+// posted to with the configured team's token.
+//
+// Only candidates accepted by accept are checked, so unverified payloads
+// can't make the bridge call Slack; a nil accept is for payloads whose
+// team is already verified.
+func resolveChannel(teamId string, channelId string, accept func(Channel) bool) Channel {
+	c := Channel{teamId, channelId}
+	if c.Group() != nil {
+		return c
+	}
+	for _, candidate := range config().channelsById[channelId] {
+		if candidate.TeamId == teamId || (accept != nil && !accept(candidate)) {
+			continue
+		}
+		if candidate.isShared() {
+			return candidate
+		}
+	}
+	return c
+}
+
+// isShared reports whether the configured channel is shared with other
+// workspaces, treating channels that can't be checked as not shared.
+func (c Channel) isShared() bool {
+	key := c.String()
+	if shared, present := sharedChannels.Get(key); present {
+		return shared.(bool)
+	}
+	if _, present := sharedFailures.Get(key); present {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+	shared, err := c.GetTeam().IsShared(ctx, c.ChannelId)
+	if err != nil {
+		log.Printf("Unable to check whether %v is shared: %v", c, err)
+		sharedFailures.Set(key, true)
+		return false
+	}
+	if shared {
+		log.Printf("Channel %v is shared, resolving it from other teams", c)
+	}
+	sharedChannels.Set(key, shared)
+	return shared
+}
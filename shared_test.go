@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestResolveChannel(t *testing.T) {
+	tests := []struct {
+		name      string
+		teamId    string
+		channelId string
+		response  string
+		status    int
+		token     string
+		want      Channel
+		wantCalls int
+	}{
+		{"mapped", teamA, chanA, "", 0, "", Channel{teamA, chanA}, 0},
+		{"shared", teamB, chanA, `{"ok":true,"channel":{"is_ext_shared":true}}`, 0, "", Channel{teamA, chanA}, 1},
+		{"not shared", teamB, chanA, `{"ok":true,"channel":{}}`, 0, "", Channel{teamB, chanA}, 1},
+		{"check failed", teamB, chanA, "", 500, "", Channel{teamB, chanA}, 1},
+		{"unknown channel", teamB, chanC, "", 0, "", Channel{teamB, chanC}, 0},
+		{"verified token", teamB, chanA, `{"ok":true,"channel":{"is_shared":true}}`, 0, "out-a", Channel{teamA, chanA}, 1},
+		{"unverified token", teamB, chanA, `{"ok":true,"channel":{"is_shared":true}}`, 0, "wrong", Channel{teamB, chanA}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			if test.response != "" {
+				slack.Handle("conversations.info", func(fakeCall) string { return test.response })
+			}
+			slack.Fail("conversations.info", test.status)
+			useConfig(t, testConfig(""))
+
+			var accept func(Channel) bool
+			if test.token != "" {
+				accept = func(c Channel) bool { return c.VerifyToken(test.token) }
+			}
+			// The second payload must be answered from the cache.
+			for i := 0; i < 2; i++ {
+				if got := resolveChannel(test.teamId, test.channelId, accept); got != test.want {
+					t.Errorf("resolveChannel(%v, %v) = %v, want %v", test.teamId, test.channelId, got, test.want)
+				}
+			}
+			calls := slack.Calls("conversations.info")
+			if len(calls) != test.wantCalls {
+				t.Errorf("Made %d conversations.info calls, want %d", len(calls), test.wantCalls)
+			}
+			for _, call := range calls {
+				if !strings.Contains(call.Header.Get("Authorization"), "xoxb-a") && call.Get("token") != "xoxb-a" {
+					t.Errorf("Checked %v with the token of another team", call.Get("channel"))
+				}
+			}
+		})
+	}
+}
+
+func TestBridgeSharedChannel(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.Handle("conversations.info", func(fakeCall) string { return `{"ok":true,"channel":{"is_shared":true}}` })
+	useConfig(t, testConfig(""))
+	useQueue(t)
+
+	// The outgoing webhook of teamA's channel, seen through teamB.
+	w := serveRequest(bridgeHandler, "/bridge", postForm("/bridge", url.Values{
+		"token":      {"out-a"},
+		"team_id":    {teamB},
+		"channel_id": {chanA},
+		"user_name":  {"alice"},
+		"text":       {"hello"},
+		"timestamp":  {"1488369600.000100"},
+	}))
+	if w.Code != 200 {
+		t.Fatalf("bridgeHandler returned %v", w.Code)
+	}
+	waitFor(t, "the post", func() bool { return len(slack.Posts()) > 0 })
+	if post := slack.Posts()[0]; !strings.HasSuffix(post.Path, "/"+teamB+"/hook-b") {
+		t.Errorf("Posted to %v, want the webhook of %v", post.Path, teamB)
+	}
+}
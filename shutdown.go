@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// flushers drain pending work, such as queued or batched messages, when
+// the process shuts down.
+var flushers struct {
+	sync.Mutex
+	funcs []func(context.Context) error
+}
+
+// OnFlush registers f to be called by Flush. Flushers run in registration
+// order.
+func OnFlush(f func(context.Context) error) {
+	flushers.Lock()
+	defer flushers.Unlock()
+	flushers.funcs = append(flushers.funcs, f)
+}
+
+// Flush runs every registered flusher, stopping early if ctx expires. It
+// returns the first error encountered.
+func Flush(ctx context.Context) error {
+	flushers.Lock()
+	funcs := append([]func(context.Context) error(nil), flushers.funcs...)
+	flushers.Unlock()
+
+	var first error
+	for _, f := range funcs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// serve runs server until SIGINT or SIGTERM, then stops accepting requests
+// and flushes pending work within the configured grace period.
+func serve(server *http.Server) {
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("Received %v, shutting down", <-signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.ShutdownGrace.Duration)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+	if err := Flush(ctx); err != nil {
+		log.Printf("Flush: %v", err)
+	}
+}
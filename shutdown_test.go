@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// isolateFlushers clears the registered flushers, restoring them when the
+// test ends.
+func isolateFlushers(t testing.TB) {
+	flushers.Lock()
+	previous := flushers.funcs
+	flushers.funcs = nil
+	flushers.Unlock()
+	t.Cleanup(func() {
+		flushers.Lock()
+		flushers.funcs = previous
+		flushers.Unlock()
+	})
+}
+
+func TestFlushOrder(t *testing.T) {
+	first, second := errors.New("first"), errors.New("second")
+	tests := []struct {
+		name    string
+		results []error
+		cancel  int
+		wantRun []int
+		wantErr error
+	}{
+		{"all", []error{nil, nil, nil}, -1, []int{0, 1, 2}, nil},
+		{"first error", []error{nil, first, second}, -1, []int{0, 1, 2}, first},
+		{"expired", []error{nil, nil, nil}, 1, []int{0, 1}, context.Canceled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isolateFlushers(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var run []int
+			for i, err := range test.results {
+				i, err := i, err
+				OnFlush(func(context.Context) error {
+					run = append(run, i)
+					if i == test.cancel {
+						cancel()
+					}
+					return err
+				})
+			}
+
+			if err := Flush(ctx); err != test.wantErr {
+				t.Errorf("Flush() = %v, want %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(run, test.wantRun) {
+				t.Errorf("Ran flushers %v, want %v", run, test.wantRun)
+			}
+		})
+	}
+}
+
+func TestFlushPostsPendingBatches(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"batch_window": "1h"}}`))
+	isolateFlushers(t)
+	OnFlush(batches.Flush)
+
+	dest := Channel{teamB, chanB}
+	for _, text := range []string{"one", "two"} {
+		msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: text}
+		if err := dest.Deliver(context.Background(), msg); err != errBatched {
+			t.Fatalf("Deliver = %v, want %v", err, errBatched)
+		}
+	}
+	if posts := slack.Posts(); len(posts) != 0 {
+		t.Fatalf("Batch posted before its window: %v", posts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	posts := slack.Posts()
+	if len(posts) != 1 {
+		t.Fatalf("Got %d posts, want the batch", len(posts))
+	}
+	if got := posts[0].Get("text"); got != "one\ntwo" {
+		t.Errorf("Posted %q, want the combined batch", got)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// liveMentionRegexp matches the markup of mentions that notify someone:
+// users, user groups and broadcasts, with an optional label.
+var liveMentionRegexp = regexp.MustCompile(`<(@|!subteam\^|!here|!channel|!everyone)([^|>]*)(?:\|([^>]*))?>`)
+
+// mentionsSuppressed reports whether the message's group renders every
+// mention as plain text.
+func (msg *slackMessage) mentionsSuppressed() bool {
+	group := msg.Group()
+	return group != nil && group.Options.SuppressMentions
+}
+
+// silenceMentions renders the mentions in text as plain text, such as
+// "@name" or "@here", so that posting it notifies no one.
+func silenceMentions(text string) string {
+	return liveMentionRegexp.ReplaceAllStringFunc(text, func(s string) string {
+		match := liveMentionRegexp.FindStringSubmatch(s)
+		kind, id, label := match[1], match[2], strings.TrimPrefix(match[3], "@")
+		switch {
+		case label != "":
+			return "@" + label
+		case kind == "@" || kind == "!subteam^":
+			return "@" + id
+		}
+		return "@" + strings.TrimPrefix(kind, "!")
+	})
+}
+
+// SilenceMentions renders every mention in the message's text and
+// attachments as plain text.
+func (msg *slackMessage) SilenceMentions() {
+	msg.Text = silenceMentions(msg.Text)
+	if len(msg.Attachments) == 0 {
+		return
+	}
+	attachments := make([]slack.Attachment, len(msg.Attachments))
+	for i, attachment := range msg.Attachments {
+		attachment.Pretext = silenceMentions(attachment.Pretext)
+		attachment.Title = silenceMentions(attachment.Title)
+		attachment.Text = silenceMentions(attachment.Text)
+		attachment.Fallback = silenceMentions(attachment.Fallback)
+		attachment.Footer = silenceMentions(attachment.Footer)
+		fields := make([]slack.AttachmentField, len(attachment.Fields))
+		for j, field := range attachment.Fields {
+			field.Value = silenceMentions(field.Value)
+			fields[j] = field
+		}
+		attachment.Fields = fields
+		attachments[i] = attachment
+	}
+	msg.Attachments = attachments
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestSilenceMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"hi <@U0000000A>", "hi @U0000000A"},
+		{"hi <@U0000000A|alice>", "hi @alice"},
+		{"ping <!subteam^S0000000A|@ops>", "ping @ops"},
+		{"ping <!subteam^S0000000A>", "ping @S0000000A"},
+		{"<!here> <!channel> <!everyone>", "@here @channel @everyone"},
+		{"<!here|here> now", "@here now"},
+		{"see <https://example.com|this> and <#C0000000A|general>", "see <https://example.com|this> and <#C0000000A|general>"},
+		{"no mentions", "no mentions"},
+	}
+	for _, test := range tests {
+		if got := silenceMentions(test.text); got != test.want {
+			t.Errorf("silenceMentions(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSuppressMentions(t *testing.T) {
+	text := "<@U0000000A|alice> <!subteam^S0000000A|@ops> <!here>"
+	tests := []struct {
+		name          string
+		options       string
+		wantLive      bool
+		wantLinkNames string
+	}{
+		{"off", `{}`, true, "true"},
+		{"on, overriding usergroups", `{"suppress_mentions": true}`, false, "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeSlack(t)
+			useConfig(t, testConfig(test.options, `"destinations": {"`+teamB+"/"+chanB+`": {"usergroups": {"ops": "S0000000B"}}}`))
+			msg := slackMessage{
+				Channel:     Channel{teamA, chanA},
+				Username:    "alice",
+				Text:        text,
+				Attachments: []slack.Attachment{{Text: text, Fields: []slack.AttachmentField{{Value: text}}}},
+			}
+
+			if err := (Channel{teamB, chanB}).PostMessage(testContext(t), msg); err != nil {
+				t.Fatalf("PostMessage: %v", err)
+			}
+			posts := fake.Posts()
+			if len(posts) != 1 {
+				t.Fatalf("Made %d posts, want 1", len(posts))
+			}
+			post := posts[0]
+			for _, field := range []string{"text", "attachments"} {
+				got := post.Get(field)
+				if live := strings.Contains(got, "U0000000A|") || strings.Contains(got, "subteam^") || strings.Contains(got, "!here"); live != test.wantLive {
+					t.Errorf("Posted %v %q, want live mentions %v", field, got, test.wantLive)
+				}
+			}
+			if got := post.Get("link_names"); got != test.wantLinkNames {
+				t.Errorf("link_names = %v, want %v", got, test.wantLinkNames)
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/nlopes/slack"
@@ -14,25 +16,106 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Team struct {
 	Id string
 	*slack.Client
 	IncomingToken string
+	APIToken      string
+	Options       TeamOptions
+	// UserId is the bridge's own user in the team, learned from AuthTest.
+	UserId string
+	// SigningSecrets and EventsToken verify the team's Events API
+	// requests; when both are empty the settings of the same name are
+	// used.
+	SigningSecrets Credentials
+	EventsToken    Credentials
+
+	location *time.Location
+
+	// slots bounds the number of concurrent calls made with the team's
+	// tokens; nil means unbounded.
+	slots chan struct{}
 }
 
-func NewTeam(s string) (*Team, error) {
-	parts := strings.Split(s, ":")
-	client := slack.New(parts[1])
+func NewTeam(id string, apiToken string, incomingToken string) *Team {
+	client := slack.New(apiToken)
 	client.SetDebug(true)
-	t := &Team{parts[0], client, parts[2]}
-	_, err := t.AuthTest()
-	if err != nil {
-		return nil, err
+	return &Team{Id: id, Client: client, IncomingToken: incomingToken, APIToken: apiToken}
+}
+
+// SetConcurrency bounds the team's concurrent Slack calls to n, or removes
+// the bound when n is zero.
+func (t *Team) SetConcurrency(n int) {
+	if n > 0 {
+		t.slots = make(chan struct{}, n)
 	} else {
-		return t, nil
+		t.slots = nil
+	}
+}
+
+// acquire takes one of the team's call slots and then an outbound slot,
+// returning ctx's error, and holding neither, if it expires first.
+func (t *Team) acquire(ctx context.Context) error {
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := acquireOutbound(ctx); err != nil {
+		if t.slots != nil {
+			<-t.slots
+		}
+		return err
+	}
+	return nil
+}
+
+func (t *Team) release() {
+	releaseOutbound()
+	if t.slots != nil {
+		<-t.slots
+	}
+}
+
+// Location returns the team's timezone.
+func (t *Team) Location() *time.Location {
+	if t.location == nil {
+		return time.UTC
 	}
+	return t.location
+}
+
+// GetUserInfo looks up a user, cached for an hour, failing fast while the
+// team's client breaker is open so a revoked token doesn't cost an API
+// call per message.
+func (t *Team) GetUserInfo(user string) (*slack.User, error) {
+	cacheKey := t.Id + "/" + user
+	if info, present := userInfos.Get(cacheKey); present {
+		return info.(*slack.User), nil
+	}
+	key := Channel{TeamId: t.Id}
+	if !clients.Allow(key) {
+		return nil, errBreakerOpen
+	}
+
+	ctx := context.Background()
+	methodLimits.Wait(ctx, t.Id, "users.info")
+	if err := t.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer t.release()
+	info, err := t.Client.GetUserInfo(user)
+	clients.Record(key, clientFailure(err))
+	if err == nil {
+		userInfos.Set(cacheKey, info)
+	}
+	return info, err
 }
 
 func (t *Team) AuthTest() (*slack.AuthTestResponse, error) {
@@ -58,123 +141,242 @@ func MakeChannel(s string) Channel {
 	return Channel{parts[0], parts[1]}
 }
 
+func (c Channel) String() string {
+	return c.TeamId + "/" + c.ChannelId
+}
+
 func (c *Channel) GetTeam() *Team {
-	return config.teams[c.TeamId]
+	return config().teams[c.TeamId]
 }
 
-func (c Channel) Forward(f func(Channel)) {
-	for _, other := range config.channelMap[c] {
-		if c != other {
-			f(other)
-		}
+// Group returns the group the channel is mapped to, or that a route adds
+// it to once the channel's name has been looked up.
+func (c Channel) Group() *Group {
+	if group, present := config().channelMap[c]; present {
+		return group
 	}
+	return c.routedGroup()
 }
 
-type Configuration struct {
-	teams          map[string]*Team
-	channelMap     map[Channel][]Channel
-	outboundTokens map[Channel]string
+// Poster returns the team to post to c as, with the destination's token
+// override applied when set.
+func (c Channel) Poster() *Team {
+	team := c.GetTeam()
+	if token := c.Options().Token; token != "" {
+		override := *team
+		override.APIToken = token
+		return &override
+	}
+	return team
 }
 
-// Configuration format:
-// SLACKLINE_TEAMS=TEAM_ID:API_TOKEN:INCOMING_TOKEN,...
-// Incoming tokens are of the format Bxxxxxxx/xxxxxxxxxxxxxxx
-//
-// SLACKLINE_CHANNEL_MAP=TID/CID:TID/CID:TID/CID,...
-// SLACKLINE_OUTBOUND_TOKENS=TID/CID:OUTGOING_TOKEN,...
-func GetConfiguration() *Configuration {
-	team_strs := strings.Split(os.Getenv("SLACKLINE_TEAMS"), ",")
-	teams := make(map[string]*Team, len(team_strs))
-
-	for _, team_str := range team_strs {
-		team, err := NewTeam(team_str)
-		if err != nil {
-			log.Fatal(err)
-		}
-		teams[team.Id] = team
+func (c Channel) Options() DestinationOptions {
+	if options, present := config().destinations[c]; present {
+		return options
 	}
+	return DefaultDestinationOptions()
+}
 
-	channels_strs := strings.Split(os.Getenv("SLACKLINE_CHANNEL_MAP"), ",")
-	channelMap := make(map[Channel][]Channel, len(channels_strs)*3)
-	for _, channels_str := range channels_strs {
-		channel_strs := strings.Split(channels_str, ":")
-		channels := make([]Channel, len(channel_strs))
-
-		for key, channel_str := range channel_strs {
-			channel := MakeChannel(channel_str)
-			channels[key] = channel
-
-			if _, present := channelMap[channel]; !present {
-				channelMap[channel] = channels
-			} else {
-				panic(fmt.Sprintf("%s already present in channel map configuration.", channel_str))
-			}
-		}
+func (c Channel) Forward(f func(Channel)) {
+	group := c.Group()
+	if group == nil {
+		return
 	}
-
-	tokens := strings.Split(os.Getenv("SLACKLINE_OUTBOUND_TOKENS"), ",")
-	outboundTokens := make(map[Channel]string, len(tokens))
-	for _, token := range tokens {
-		parts := strings.Split(token, ":")
-		outboundTokens[MakeChannel(parts[0])] = parts[1]
+	for _, other := range group.Channels {
+		if c == other {
+			continue
+		}
+		if !other.Permitted() {
+			log.Printf("Not forwarding to %v: not permitted by its team's channel lists", other)
+			continue
+		}
+		f(other)
 	}
+}
 
-	return &Configuration{teams, channelMap, outboundTokens}
+// Permitted reports whether the channel's team allows it to be bridged.
+func (c Channel) Permitted() bool {
+	team := c.GetTeam()
+	return team != nil && team.Options.Permits(c.ChannelId)
 }
 
-var config *Configuration
+var errUnknownTeam = errors.New("team is not configured")
 
+// VerifyToken checks an outgoing webhook token from the channel against
+// its own tokens, or those of its routes when it has none.
 func (c Channel) VerifyToken(token string) bool {
-	return config.outboundTokens[c] == token
+	if credentials, present := config().outboundTokens[c]; present {
+		return credentials.Accepts(token)
+	}
+	return c.verifyRouteToken(token)
 }
 
 type slackMessage struct {
 	Channel
 	Username  string `json:"username"`
-	Text      string `json:"text"`
+	Text      string `json:"text,omitempty"`
 	Icon      string `json:"icon_url"`
 	LinkNames bool   `json:"link_names"`
+	IconEmoji string `json:"icon_emoji,omitempty"`
+
+	ThreadTs       string             `json:"thread_ts,omitempty"`
+	ReplyBroadcast bool               `json:"reply_broadcast,omitempty"`
+	Attachments    []slack.Attachment `json:"attachments,omitempty"`
+	Metadata       *messageMetadata   `json:"metadata,omitempty"`
+	UnfurlLinks    *bool              `json:"unfurl_links,omitempty"`
+	UnfurlMedia    *bool              `json:"unfurl_media,omitempty"`
+	AsUser         bool               `json:"as_user,omitempty"`
+
+	Files     []sharedFile `json:"-"`
+	Permalink string       `json:"-"`
+	// Names of the source team and channel, when the payload has them.
+	TeamDomain  string `json:"-"`
+	ChannelName string `json:"-"`
+	// Replay is set for messages explicitly replayed by an operator, which
+	// bypass the age check.
+	Replay bool `json:"-"`
+	// Preview is set for messages rendered by /admin/preview, which must
+	// not make any Slack API calls.
+	Preview bool `json:"-"`
+	// Chain is the channels the message was forwarded through, ending
+	// with its source channel once it is being bridged.
+	Chain []string `json:"-"`
+	// Instance is the ID of the bridge instance that forwarded the
+	// message, when it says.
+	Instance string `json:"-"`
+	// Broadcast is set for thread replies also sent to the channel.
+	Broadcast bool `json:"-"`
+	// Backfill is set for earlier messages forwarded when a channel is
+	// first active.
+	Backfill bool `json:"-"`
+	// Edited is set for messages edited at the source.
+	Edited bool `json:"-"`
+	// Event is set for messages from a channel that may be routed by name
+	// but wasn't yet when it was received. Bridge filters it once the
+	// channel's group is known.
+	Event *messageEvent `json:"-"`
+	// Pseudonyms maps the pseudonyms that replaced user mentions in the
+	// text to the users' IDs, so a destination's own anonymize step can
+	// replace them with its own.
+	Pseudonyms map[string]string `json:"-"`
+
+	UserId      string `json:"-"`
+	BotId       string `json:"-"`
+	ClientMsgId string `json:"-"`
+	// Timestamps of the source message and of its thread root, if any.
+	Timestamp       string `json:"-"`
+	ThreadTimestamp string `json:"-"`
+}
+
+func (msg *slackMessage) IsReply() bool {
+	return msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp
 }
 
+// size is the length of the message's serialized payload.
+func (s slackMessage) size() int {
+	n, _ := io.Copy(ioutil.Discard, s.payload())
+	return int(n)
+}
+
+// payload serializes the message for posting. Empty text is left out, as
+// an empty text field can get attachment-only posts refused. Names are
+// linked unless the group suppresses mentions.
 func (s *slackMessage) payload() io.Reader {
-	s.LinkNames = true
+	s.LinkNames = !s.mentionsSuppressed()
 	content, _ := json.Marshal(s)
 	return bytes.NewReader(content)
 }
 
 var mentionRegexp = regexp.MustCompile("<@[^>]+>")
 
+// RewriteMentions replaces user mentions with @name, using the label given
+// in the mention or looking the user up once per message.
 func (msg *slackMessage) RewriteMentions() {
-	text := mentionRegexp.ReplaceAllStringFunc(msg.Text, func(s string) string {
-		s = s[2 : len(s)-1]
-		if strings.Contains(s, "|") {
-			s = strings.Split(s, "|")[1]
-		} else {
-			user, err := msg.GetTeam().GetUserInfo(s)
-			if err != nil {
-				log.Printf("Unable to map %v to username: %v", s, err)
-			} else {
-				s = user.Name
+	matches := mentionRegexp.FindAllStringIndex(msg.Text, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	var names map[string]string
+	var text strings.Builder
+	text.Grow(len(msg.Text))
+	last := 0
+	for _, match := range matches {
+		text.WriteString(msg.Text[last:match[0]])
+		last = match[1]
+
+		s := msg.Text[match[0]+2 : match[1]-1]
+		if bar := strings.IndexByte(s, '|'); bar >= 0 {
+			label := s[bar+1:]
+			if end := strings.IndexByte(label, '|'); end >= 0 {
+				label = label[:end]
 			}
+			s = label
+		} else if !msg.Preview {
+			name, present := names[s]
+			if !present {
+				name = s
+				user, err := msg.GetTeam().GetUserInfo(s)
+				if err != nil {
+					log.Printf("Unable to map %v to username: %v", s, err)
+				} else {
+					name = user.Name
+				}
+				if names == nil {
+					names = make(map[string]string)
+				}
+				names[s] = name
+			}
+			s = name
 		}
-		return "@" + s
-	})
-	msg.Text = text
+		text.WriteByte('@')
+		text.WriteString(s)
+	}
+	text.WriteString(msg.Text[last:])
+	msg.Text = text.String()
 }
 
+// FetchUserIcon looks up the author by ID when known, falling back to the
+// username, and fills in the icon and any missing username. The lookup is
+// skipped for a quick repeat from the previous author in the channel.
 func (msg *slackMessage) FetchUserIcon() error {
-	userInfo, err := msg.GetTeam().GetUserInfo(msg.Username)
+	user := msg.UserId
+	if user == "" {
+		user = msg.Username
+	}
+	if msg.reuseIcon(user) {
+		return nil
+	}
+	userInfo, err := msg.GetTeam().GetUserInfo(user)
 	if err != nil {
-		log.Printf("Unable to fetch user icon for %v: %v", msg.Username, err)
+		log.Printf("Unable to fetch user icon for %v: %v", user, err)
+		msg.setFallbackIcon()
 	} else {
 		msg.Icon = userInfo.Profile.ImageOriginal
+		if msg.Username == "" {
+			msg.Username = userInfo.Name
+		}
+		msg.rememberIcon(user)
 	}
 	return err
 }
 
-const postMessageURL = "https://hooks.slack.com/services"
+// setFallbackIcon uses the group's fallback icon, an image URL or an
+// :emoji:, when it has one.
+func (msg *slackMessage) setFallbackIcon() {
+	fallback := msg.Group().Options.FallbackIcon
+	switch {
+	case fallback == "":
+	case strings.HasPrefix(fallback, ":") && strings.HasSuffix(fallback, ":"):
+		msg.Icon, msg.IconEmoji = "", fallback
+	default:
+		msg.Icon = fallback
+	}
+}
+
+var postMessageURL = "https://hooks.slack.com/services"
 
-func (c Channel) WebhookPostMessage(msg slackMessage) (err error) {
+func (c Channel) WebhookPostMessage(ctx context.Context, msg slackMessage) (err error) {
 
 	msg.Channel = c
 	team := c.GetTeam()
@@ -182,62 +384,494 @@ func (c Channel) WebhookPostMessage(msg slackMessage) (err error) {
 
 	log.Printf("Posting message to %v", url)
 
-	res, err := http.Post(
-		url,
-		"application/json",
-		msg.payload(),
-	)
+	if err := team.acquire(ctx); err != nil {
+		return err
+	}
+	defer team.release()
+
+	payload, _ := ioutil.ReadAll(msg.payload())
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
 
+	captured := c.Captured()
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
+		if captured {
+			c.logCapture("webhook", payload, err.Error())
+		}
 		log.Println(err)
-		return err
+		return classifyPostError(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if captured {
+		c.logCapture("webhook", payload, res.Status+" - "+string(body))
 	}
 
 	if res.StatusCode != 200 {
-		defer res.Body.Close()
-		body, _ := ioutil.ReadAll(res.Body)
 		err := errors.New(res.Status + " - " + string(body))
 		log.Println(err)
-		return err
+		return classifyResponse(err, res, strings.TrimSpace(string(body)))
 	}
 
 	return
 }
 
-func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("$PORT must be set")
+// PostMessage forwards msg to the channel, skipping destinations whose
+// circuit breaker is open and recording the outcome in the health registry.
+// Destinations with a max_rate are paced by their adaptive rate, and those
+// with a max_bytes_per_second by the size of what is posted.
+func (c Channel) PostMessage(ctx context.Context, msg slackMessage) error {
+	if c.GetTeam() == nil {
+		log.Printf("Skipping post to %v: %v", c, errUnknownTeam)
+		return errUnknownTeam
+	}
+	if health.Paused(c) {
+		log.Printf("Skipping post to %v: %v", c, errPaused)
+		return errPaused
 	}
+	if !rates.Wait(ctx, c) {
+		return ctx.Err()
+	}
+	if !health.Allow(c) {
+		log.Printf("Skipping post to %v: %v", c, errBreakerOpen)
+		return errBreakerOpen
+	}
+	uploads := c.prepare(ctx, &msg)
+	if !byteRates.Wait(ctx, c, msg.size()) {
+		health.Record(c, ctx.Err())
+		return ctx.Err()
+	}
+	err := c.postMessage(ctx, msg)
+	health.Record(c, err)
+	rates.Record(c, err)
+	if err != nil {
+		return err
+	}
+	// The text is posted, so a failed upload is only logged: retrying the
+	// message would post the text again.
+	for _, f := range uploads {
+		if err := c.UploadFile(ctx, msg.GetTeam(), f); err != nil {
+			log.Printf("Unable to upload %v to %v: %v", f.Id, c, err)
+		}
+	}
+	return nil
+}
 
-	config = GetConfiguration()
+// prepare readies msg, already through its group's pipeline, for posting
+// to the channel, rendering it and linking its files, returning the files
+// still to be uploaded.
+func (c Channel) prepare(ctx context.Context, msg *slackMessage) []sharedFile {
+	c.render(ctx, msg)
+	return msg.LinkFiles(ctx, c)
+}
 
-	router := gin.Default()
+// render runs msg through the destination's pipeline, renders mentions
+// and broadcasts, translates the text and fixes up the author. Posts and
+// edits of their mirrors are rendered alike.
+func (c Channel) render(ctx context.Context, msg *slackMessage) {
+	c.TransformFor(ctx, msg)
+	msg.Text = c.RenderUsergroups(ctx, *msg)
+	if msg.mentionsSuppressed() {
+		msg.SilenceMentions()
+	}
+	msg.Text = c.DowngradeBroadcasts(ctx, *msg)
+	msg.Text = c.Translate(ctx, *msg)
+	msg.Username = c.SanitizeUsername(msg.Username)
+	if c.Options().ChannelIcon {
+		msg.ApplyChannelIcon(ctx)
+	}
+}
 
-	router.POST("/bridge", func(c *gin.Context) {
-		msg := slackMessage{
-			Channel:  Channel{c.PostForm("team_id"), c.PostForm("channel_id")},
-			Username: c.PostForm("user_name"),
-			Text:     c.PostForm("text"),
+// postMessage sends msg to the channel. Groups mirroring threads post
+// through the Web API so replies can later find their destination thread,
+// as do destinations collecting threads, with their own token, a user
+// token or user DMs; everything else goes through the incoming webhook,
+// falling back to the Web API when it is rate limited if the destination
+// allows. Replies are threaded according to the destination's thread
+// mode.
+func (c Channel) postMessage(ctx context.Context, msg slackMessage) error {
+	options := msg.Group().Options
+	msg.UnfurlLinks, msg.UnfurlMedia = options.UnfurlLinks, options.UnfurlMedia
+	destination := c.Options()
+	if !options.Threads && destination.ThreadMode != threadCollect && destination.Token == "" && destination.UserToken == "" && !c.IsUser() {
+		err := c.WebhookPostMessage(ctx, msg)
+		if _, limited := err.(*rateLimitedError); limited && destination.WebhookFallback {
+			log.Printf("Webhook for %v is rate limited, posting via chat.postMessage: %v", c, err)
+			return c.postViaAPI(ctx, msg, postFallback)
+		}
+		if err == nil {
+			stats.Posted(postWebhook)
 		}
+		return err
+	}
 
-		c.Status(200)
+	if msg.IsReply() {
+		ts, err := c.threadFor(ctx, msg)
+		if err != nil {
+			log.Printf("Unable to start a thread for %v in %v, posting to channel: %v", msg.ThreadTimestamp, c, err)
+		} else if ts != "" {
+			msg.ThreadTs = ts
+			msg.ReplyBroadcast = options.ReplyBroadcast || (msg.Broadcast && !options.StripBroadcasts)
+		} else if destination.ThreadMode != threadFlatten {
+			log.Printf("No mirror of thread %v in %v, posting to channel", msg.ThreadTimestamp, c)
+		}
+	}
 
-		if !msg.VerifyToken(c.PostForm("token")) {
-			log.Printf("Incorrect webhook token: %v", c.PostForm("token"))
-			return
+	return c.postViaAPI(ctx, msg, postAPI)
+}
+
+// postViaAPI posts msg with chat.postMessage, as the destination's user
+// when it has a user token, recording the mirror and counting the post
+// under path.
+func (c Channel) postViaAPI(ctx context.Context, msg slackMessage, path string) error {
+	var ts string
+	var err error
+	if c.Options().UserToken != "" {
+		msg.AsUser = true
+		ts, err = c.APIPostMessage(ctx, msg)
+		if err != nil && isAuthError(err) {
+			log.Printf("User token for %v was rejected, posting as the bot: %v", c, err)
+			msg.AsUser = false
+		}
+	}
+	if !msg.AsUser {
+		ts, err = c.APIPostMessage(ctx, msg)
+	}
+	if err == nil {
+		stats.Posted(path)
+		if msg.Timestamp != "" {
+			mirrors.Record(msg.Channel, msg.Timestamp, c, ts)
 		}
+	}
+	return err
+}
+
+// Bridge forwards a verified message from a source channel to the rest of
+// its group.
+func Bridge(msg slackMessage) {
+	if msg.Username == "slackbot" {
+		stats.Dropped(dropSlackbot)
+		return
+	}
+	group := msg.Group()
+	if group == nil {
+		group = msg.Channel.resolveRoute()
+	}
+	if group == nil {
+		stats.Dropped(dropUnmapped)
+		return
+	}
+	if msg.Event != nil && !msg.accept(*msg.Event, group) {
+		return
+	}
+
+	if msg.Loopback() {
+		log.Printf("Dropping message %v from %v: forwarded by instance %v", msg.Timestamp, msg.Channel, msg.Instance)
+		stats.Dropped(dropLoopback)
+		return
+	}
+
+	if msg.GetTeam() == nil {
+		log.Printf("Dropping message from %v: %v", msg.Channel, errUnknownTeam)
+		stats.Dropped(dropUnknownTeam)
+		return
+	}
 
-		if msg.Username == "slackbot" {
+	if !msg.Permitted() {
+		log.Printf("Dropping message from %v: not permitted by its team's channel lists", msg.Channel)
+		stats.Dropped(dropNotPermitted)
+		return
+	}
+
+	if !msg.Backfill && msg.Group().Options.Backfill > 0 && msg.Timestamp != "" {
+		msg.Channel.BackfillOnce(msg.Timestamp)
+	}
+
+	if msg.Stale() {
+		log.Printf("Dropping stale message %v from %v", msg.Timestamp, msg.Channel)
+		stats.Dropped(dropStale)
+		return
+	}
+
+	if !msg.Replay && config().settings.DedupeScope == dedupeGlobal && !msg.FirstDelivery() {
+		log.Printf("Dropping duplicate message %v from %v", msg.Timestamp, msg.Channel)
+		stats.Dropped(dropDuplicate)
+		return
+	}
+
+	if msg.MentionsBridge() {
+		switch config().settings.BotMentions {
+		case botMentionsCommand:
+			// Like forwarding, the reply is made on the message's worker.
+			msg.RunCommand()
+			stats.Dropped(dropCommand)
+			return
+		case botMentionsDrop:
+			stats.Dropped(dropCommand)
 			return
 		}
+	}
+
+	if msg.Group().Options.SyncOnly {
+		stats.Dropped(dropSyncOnly)
+		return
+	}
+
+	if !msg.Sampled() {
+		stats.Dropped(dropSampled)
+		return
+	}
+
+	if !msg.InQualifyingThread() {
+		stats.Dropped(dropThreadFilter)
+		return
+	}
+
+	if msg.Flapping() {
+		log.Printf("Dropping message %v from %v: too similar to the last one forwarded", msg.Timestamp, msg.Channel)
+		stats.Dropped(dropFlapping)
+		return
+	}
+
+	if !msg.ExtendChain() {
+		log.Printf("Dropping message %v from %v: forwarded through too many hops", msg.Timestamp, msg.Channel)
+		stats.Dropped(dropHopLimit)
+		return
+	}
 
+	// The fan-out runs on a queue worker under its own budget, shared by
+	// every destination, rather than the deadline of the ingress request.
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	if msg.BotId == "" {
 		msg.FetchUserIcon()
-		msg.RewriteMentions()
+	}
+	msg.Transform(ctx)
+	if msg.Group().Options.ShowChain {
+		msg.AppendChain()
+	}
+	if msg.Backfill {
+		msg.MarkBackfilled()
+	}
 
-		msg.Forward(func(c Channel) {
-			c.WebhookPostMessage(msg)
-		})
+	// Each destination's copy of the message is only made once one of
+	// the group's fan-out slots is free, so large groups don't hold a copy
+	// per destination at once.
+	concurrency := msg.Group().Options.FanoutConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var forwarded []Channel
+	msg.Forward(func(c Channel) {
+		if !msg.Replay && config().settings.DedupeScope == dedupeDestination && !msg.FirstDeliveryTo(c) {
+			log.Printf("Not forwarding duplicate message %v from %v to %v", msg.Timestamp, msg.Channel, c)
+			stats.Dropped(dropDuplicate)
+			return
+		}
+		if c.Archived(ctx) {
+			stats.Dropped(dropArchived)
+			return
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			switch c.Deliver(ctx, msg) {
+			case nil:
+				stats.Forwarded()
+				mu.Lock()
+				forwarded = append(forwarded, c)
+				mu.Unlock()
+			case errBatched:
+				// Counted and confirmed by postBatch.
+			default:
+				stats.Error()
+			}
+		}()
+	})
+	wg.Wait()
+
+	for _, webhook := range msg.Group().Options.Webhooks {
+		if err := webhook.Post(ctx, msg); err != nil {
+			log.Printf("Unable to post to webhook: %v", err)
+			stats.Error()
+		} else {
+			stats.Forwarded()
+		}
+	}
+
+	if msg.Group().Options.ConfirmForwards && len(forwarded) > 0 {
+		msg.ConfirmForwards(ctx, forwarded)
+	}
+	if msg.Group().Options.ReplyCounts && msg.IsReply() {
+		msg.ScheduleReplyCount()
+	}
+}
+
+// bridgeHandler receives messages from Slack outgoing webhooks.
+func bridgeHandler(c *gin.Context) {
+	var body webhookBody
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+			log.Printf("Malformed webhook payload: %v", err)
+			c.Status(400)
+			return
+		}
+	} else {
+		body = formWebhookBody(c)
+	}
+
+	// Shared channels are only looked up when the token is one of theirs.
+	accept := func(c Channel) bool { return c.VerifyToken(body.Token) }
+	msg := slackMessage{
+		Channel:     resolveChannel(body.TeamId, body.ChannelId, accept),
+		Username:    body.Username,
+		Text:        body.Text,
+		UserId:      body.UserId,
+		Attachments: body.Attachments,
+
+		TeamDomain:  body.TeamDomain,
+		ChannelName: body.ChannelName,
+
+		Timestamp:       body.Timestamp,
+		ThreadTimestamp: body.ThreadTs,
+		Instance:        c.Request.Header.Get(instanceHeader),
+	}
+
+	if !verified(msg.VerifyToken(body.Token), "webhook") {
+		log.Printf("Incorrect webhook token: %v", body.Token)
+		c.Status(200)
+		return
+	}
+
+	// The reply is rendered before queueing, as the worker changes the
+	// text, and Slack posts it back to the source channel.
+	reply := msg.WebhookReply()
+	if queue.Enqueue(msg) && reply != "" {
+		c.JSON(200, gin.H{"text": reply})
+		return
+	}
+	c.Status(200)
+}
+
+// webhookBody is an outgoing webhook payload, sent either form-encoded or
+// as JSON.
+type webhookBody struct {
+	Token       string             `json:"token"`
+	TeamId      string             `json:"team_id"`
+	TeamDomain  string             `json:"team_domain"`
+	ChannelId   string             `json:"channel_id"`
+	ChannelName string             `json:"channel_name"`
+	UserId      string             `json:"user_id"`
+	Username    string             `json:"user_name"`
+	Text        string             `json:"text"`
+	Timestamp   string             `json:"timestamp"`
+	ThreadTs    string             `json:"thread_ts"`
+	Attachments []slack.Attachment `json:"attachments"`
+}
+
+func formWebhookBody(c *gin.Context) webhookBody {
+	body := webhookBody{
+		Token:       c.PostForm("token"),
+		TeamId:      c.PostForm("team_id"),
+		TeamDomain:  c.PostForm("team_domain"),
+		ChannelId:   c.PostForm("channel_id"),
+		ChannelName: c.PostForm("channel_name"),
+		UserId:      c.PostForm("user_id"),
+		Username:    c.PostForm("user_name"),
+		Text:        c.PostForm("text"),
+		Timestamp:   c.PostForm("timestamp"),
+		ThreadTs:    c.PostForm("thread_ts"),
+	}
+	if attachments := c.PostForm("attachments"); attachments != "" {
+		if err := json.Unmarshal([]byte(attachments), &body.Attachments); err != nil {
+			log.Printf("Ignoring malformed attachments: %v", err)
+		}
+	}
+	return body
+}
+
+func main() {
+	migrate := flag.Bool("migrate-config", false, "print the legacy environment configuration as JSON for SLACKLINE_CONFIG and exit")
+	flag.Parse()
+
+	if *migrate {
+		if err := MigrateConfig(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		log.Fatal("$PORT must be set")
+	}
+
+	initial, source := GetConfiguration()
+	SetConfiguration(initial)
+	if err := SetupLogFile(initial.settings); err != nil {
+		log.Fatal(err)
+	}
+	if err := SetupStore(initial.settings); err != nil {
+		log.Fatal(err)
+	}
+	go WatchConfiguration(source)
+	if config().settings.TranslatorURL != "" {
+		translator = &httpTranslator{config().settings.TranslatorURL, config().settings.TranslatorKey}
+	}
+	SetOutboundLimit(config().settings.MaxOutboundCalls)
+	queue = StartQueue(config().settings.QueueSize, config().settings.Workers)
+	OnFlush(batches.Flush)
+	// The store is flushed last, once the queue and batches have drained
+	// and recorded what they delivered.
+	OnFlush(store.Flush)
+	if config().settings.Warmup {
+		go Warmup()
+	}
+
+	router := gin.Default()
+
+	router.GET("/healthz", func(c *gin.Context) {
+		destinations := health.Snapshot()
+		status := "ok"
+		for _, h := range destinations {
+			if !h.Healthy {
+				status = "degraded"
+			}
+		}
+		c.JSON(200, gin.H{"status": status, "destinations": destinations})
 	})
-	router.Run(":" + port)
+
+	if config().settings.StatsEndpoint {
+		router.GET("/stats", func(c *gin.Context) {
+			c.JSON(200, stats.Snapshot(c.Query("reset") == "true"))
+		})
+	}
+
+	if len(config().settings.AdminTokens) > 0 {
+		registerAdminRoutes(router.Group("/admin", requireAdmin))
+	}
+
+	if config().settings.HTTPIngress {
+		router.POST("/events", requireInboundHeader, eventsHandler)
+		router.POST("/bridge", requireInboundHeader, bridgeHandler)
+	}
+	if config().settings.AppToken != "" {
+		go RunSocketMode(config().settings.AppToken)
+	}
+
+	serve(&http.Server{Addr: ":" + port, Handler: router})
 }
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nlopes/slack"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+		slack.SetLogger(log.New(ioutil.Discard, "", 0))
+	}
+	os.Exit(m.Run())
+}
+
+// Teams and channels used by the test configurations.
+const (
+	teamA = "T0000000A"
+	teamB = "T0000000B"
+	chanA = "C0000000A"
+	chanB = "C0000000B"
+	chanC = "C0000000C"
+)
+
+// fakeCall is one request received by fakeSlack.
+type fakeCall struct {
+	// Method is the Web API method, or "webhook" for incoming webhooks.
+	Method string
+	// Path is the request path, which for webhooks names the team and
+	// token.
+	Path   string
+	Header http.Header
+	Form   url.Values
+	// Body is the decoded JSON body, when the request sent one.
+	Body map[string]interface{}
+}
+
+// Get returns the form value or top-level JSON field key as a string.
+func (c fakeCall) Get(key string) string {
+	if c.Body != nil {
+		switch v := c.Body[key].(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		default:
+			encoded, _ := json.Marshal(v)
+			return string(encoded)
+		}
+	}
+	return c.Form.Get(key)
+}
+
+// fakeSlack stands in for the Web API and incoming webhooks, recording
+// each call. Methods without a handler answer ok, chat.postMessage with
+// increasing timestamps and users.info with a user named after its ID.
+type fakeSlack struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	calls    []fakeCall
+	handlers map[string]func(fakeCall) string
+	statuses map[string]int
+	posts    int
+}
+
+func newFakeSlack(t testing.TB) *fakeSlack {
+	f := &fakeSlack{handlers: make(map[string]func(fakeCall) string), statuses: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+
+	previousAPI, previousSlackAPI, previousWebhook := apiURL, slack.SLACK_API, postMessageURL
+	apiURL = f.URL + "/api/"
+	slack.SLACK_API = f.URL + "/api/"
+	postMessageURL = f.URL + "/services"
+	t.Cleanup(func() {
+		apiURL, slack.SLACK_API, postMessageURL = previousAPI, previousSlackAPI, previousWebhook
+		f.Close()
+	})
+	return f
+}
+
+// Fail answers method with an empty response with HTTP status code,
+// or answers it as usual again when code is zero.
+func (f *fakeSlack) Fail(method string, code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[method] = code
+}
+
+// Handle answers method with the JSON returned by h.
+func (f *fakeSlack) Handle(method string, h func(fakeCall) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[method] = h
+}
+
+func (f *fakeSlack) serve(w http.ResponseWriter, r *http.Request) {
+	call := fakeCall{Path: r.URL.Path, Header: r.Header}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		call.Method = strings.TrimPrefix(r.URL.Path, "/api/")
+	} else {
+		call.Method = "webhook"
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		json.NewDecoder(r.Body).Decode(&call.Body)
+	} else if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		r.ParseMultipartForm(1 << 20)
+		call.Form = r.Form
+	} else {
+		r.ParseForm()
+		call.Form = r.Form
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	handler := f.handlers[call.Method]
+	status := f.statuses[call.Method]
+	if call.Method == "chat.postMessage" {
+		f.posts++
+	}
+	posts := f.posts
+	f.mu.Unlock()
+
+	switch {
+	case status != 0:
+		w.WriteHeader(status)
+	case handler != nil:
+		fmt.Fprint(w, handler(call))
+	case call.Method == "webhook":
+		fmt.Fprint(w, "ok")
+	case call.Method == "chat.postMessage":
+		fmt.Fprintf(w, `{"ok":true,"ts":"%d.000100"}`, 1000+posts)
+	case call.Method == "users.info":
+		user := call.Get("user")
+		fmt.Fprintf(w, `{"ok":true,"user":{"id":%q,"name":"name-%s","profile":{"image_original":"https://img/%s"}}}`, user, strings.ToLower(user), user)
+	default:
+		fmt.Fprint(w, `{"ok":true}`)
+	}
+}
+
+// Calls returns the calls made to method so far.
+func (f *fakeSlack) Calls(method string) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []fakeCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Posts returns the messages posted through either the Web API or a
+// webhook, in order.
+func (f *fakeSlack) Posts() []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var posts []fakeCall
+	for _, call := range f.calls {
+		if call.Method == "chat.postMessage" || call.Method == "webhook" {
+			posts = append(posts, call)
+		}
+	}
+	return posts
+}
+
+// testConfig returns a configuration bridging teamA/chanA and teamB/chanB
+// with the given group options, which may be empty, and any extra
+// top-level members such as `"settings": {...}`. Failed posts aren't
+// retried unless the extra settings say so.
+func testConfig(groupOptions string, extra ...string) string {
+	if groupOptions == "" {
+		groupOptions = "{}"
+	}
+	members := ""
+	for _, member := range extra {
+		members += ",\n" + member
+	}
+	return `{
+		"teams": [
+			{"id": "` + teamA + `", "api_token": "xoxb-a", "incoming_token": "hook-a"},
+			{"id": "` + teamB + `", "api_token": "xoxb-b", "incoming_token": "hook-b"}
+		],
+		"groups": [
+			{"channels": ["` + teamA + "/" + chanA + `", "` + teamB + "/" + chanB + `"], "options": ` + groupOptions + `}
+		],
+		"outbound_tokens": {
+			"` + teamA + "/" + chanA + `": "out-a",
+			"` + teamB + "/" + chanB + `": "out-b"
+		},
+		"settings": {"post_retries": 0}` + members + `
+	}`
+}
+
+// withChannel adds channel, given as TID/CID, to the group of a
+// configuration from testConfig.
+func withChannel(content string, channel string) string {
+	return strings.Replace(content, `"], "options"`, `", "`+channel+`"], "options"`, 1)
+}
+
+// useConfig resets the bridge's state and runs with the configuration in
+// content until the test ends, when background work it started is
+// stopped.
+func useConfig(t testing.TB, content string) *Configuration {
+	t.Helper()
+	fc, err := parseFileConfig([]byte(content))
+	if err != nil {
+		t.Fatalf("parseFileConfig: %v", err)
+	}
+	c, err := BuildConfiguration(fc, &ConfigErrors{})
+	if err != nil {
+		t.Fatalf("BuildConfiguration: %v", err)
+	}
+	resetState()
+	previous := config()
+	SetConfiguration(c)
+	t.Cleanup(func() {
+		// Batches and reply count updates the test left behind are
+		// stopped, and those being posted waited for, before the next
+		// test resets the state they use.
+		batches.Stop()
+		stopReplyCounts()
+		if previous != nil {
+			SetConfiguration(previous)
+		}
+	})
+	return c
+}
+
+// resetState replaces the bridge's caches and registries with empty ones.
+func resetState() {
+	for _, c := range []**cache{
+		&archivedChannels, &memberCounts, &channelIcons, &imChannels,
+		&processedEvents, &lastForwards, &recentAuthors, &permalinks,
+		&mirroredReactions, &channelNames, &channelNameFailures, &sharedChannels,
+		&sharedFailures, &qualifyingThreads, &translations, &usergroupHandles,
+		&userInfos,
+	} {
+		*c = newCache((*c).max, (*c).ttl)
+	}
+	collectedThreads.headers = newCache(maxMirrors, 0)
+
+	health = &healthRegistry{destinations: make(map[Channel]*DestinationHealth), pauses: true}
+	clients = &healthRegistry{destinations: make(map[Channel]*DestinationHealth)}
+	rates = &rateRegistry{destinations: make(map[Channel]*adaptiveRate)}
+	byteRates = &byteRegistry{next: make(map[Channel]time.Time), sent: make(map[Channel]int64)}
+	methodLimits = &methodRegistry{buckets: make(map[string]*methodBucket), stats: make(map[string]*MethodStats)}
+	mirrors = &mirrorMap{
+		entries: make(map[mirrorKey]map[Channel]string),
+		sources: make(map[mirrorKey]mirrorKey),
+	}
+	batches = &batcher{pending: make(map[Channel]*batch)}
+	deadLetters = &deadLetterQueue{}
+	stats = newStats()
+	store = newMemoryStore()
+
+	backfills.channels = make(map[Channel]*sync.Once)
+	captures.override = nil
+	publicLinks.links = make(map[string]string)
+	outboundSlots = nil
+}
+
+// useQueue starts a delivery queue with one worker for the rest of the
+// test, leaving the registered flushers as they were.
+func useQueue(t testing.TB) {
+	t.Helper()
+	isolateFlushers(t)
+	previous := queue
+	queue = StartQueue(100, 1)
+	q := queue
+	t.Cleanup(func() {
+		q.Flush(context.Background())
+		close(q.messages)
+		queue = previous
+	})
+}
+
+// serveRequest sends a request to handler, mounted at path, returning the
+// recorded response.
+func serveRequest(handler gin.HandlerFunc, path string, req *http.Request) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST(path, handler)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// postForm builds a form-encoded POST to path.
+func postForm(path string, form url.Values) *http.Request {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+// testContext returns a context that expires after a second or when the
+// test ends.
+func testContext(t testing.TB) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %v", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTeamConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"one", 1, 1},
+		{"two", 2, 2},
+		{"unbounded", 0, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(""))
+			config().teams[teamA].SetConcurrency(test.limit)
+			config().teams[teamB].SetConcurrency(1)
+
+			var mu sync.Mutex
+			inFlight, peak := make(map[string]int), 0
+			release := make(chan struct{})
+			slack.Handle("test.block", func(call fakeCall) string {
+				token := call.Header.Get("Authorization")
+				mu.Lock()
+				inFlight[token]++
+				if token == "Bearer xoxb-a" && inFlight[token] > peak {
+					peak = inFlight[token]
+				}
+				mu.Unlock()
+				if token == "Bearer xoxb-a" {
+					<-release
+				}
+				mu.Lock()
+				inFlight[token]--
+				mu.Unlock()
+				return `{"ok":true}`
+			})
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					config().teams[teamA].apiCall(context.Background(), "test.block", url.Values{}, nil)
+				}()
+			}
+			waitFor(t, "team A's calls", func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return inFlight["Bearer xoxb-a"] == test.want
+			})
+
+			// Team B isn't held up by team A's calls.
+			if err := config().teams[teamB].apiCall(context.Background(), "test.block", url.Values{}, nil); err != nil {
+				t.Errorf("Team B call failed: %v", err)
+			}
+			close(release)
+			wg.Wait()
+			if peak != test.want {
+				t.Errorf("Team A made %d concurrent calls, want %d", peak, test.want)
+			}
+		})
+	}
+}
+
+func mustMarshal(t testing.TB, v interface{}) []byte {
+	t.Helper()
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestDestinationToken(t *testing.T) {
+	slack := newFakeSlack(t)
+	content := testConfig(`{"threads": true}`, `"destinations": {"`+teamB+"/"+chanB+`": {"token": "xoxb-post"}}`)
+	useConfig(t, withChannel(content, teamA+"/"+chanC))
+
+	Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: "1.000"})
+
+	tokens := make(map[string]string)
+	for _, call := range slack.Calls("chat.postMessage") {
+		tokens[call.Get("channel")] = call.Header.Get("Authorization")
+	}
+	want := map[string]string{chanB: "Bearer xoxb-post", chanC: "Bearer xoxb-a"}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Posted with %v, want %v", tokens, want)
+	}
+}
+
+func TestUnknownTeam(t *testing.T) {
+	tests := []struct {
+		name     string
+		missing  string
+		wantDrop string
+	}{
+		{"source", teamA, dropUnknownTeam},
+		{"destination", teamB, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(""))
+			delete(config().teams, test.missing)
+
+			Bridge(slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: "1.000"})
+
+			if posts := slack.Posts(); len(posts) != 0 {
+				t.Errorf("Posted %v", posts)
+			}
+			snapshot := stats.Snapshot(false)
+			if test.wantDrop != "" && snapshot.Dropped[test.wantDrop] != 1 {
+				t.Errorf("Dropped %v, want one %v", snapshot.Dropped, test.wantDrop)
+			}
+			if snapshot.Forwarded != 0 {
+				t.Errorf("Counted %d forwards", snapshot.Forwarded)
+			}
+		})
+	}
+
+	err := (Channel{"T0000000Z", chanA}).PostMessage(testContext(t), slackMessage{Text: "hi"})
+	if err != errUnknownTeam {
+		t.Errorf("PostMessage to an unknown team = %v, want %v", err, errUnknownTeam)
+	}
+}
+
+func TestConfigRejectsUnknownTeams(t *testing.T) {
+	content := withChannel(testConfig(""), "T0000000Z/"+chanC)
+	fc, err := parseFileConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildConfiguration(fc, &ConfigErrors{}); err == nil {
+		t.Errorf("BuildConfiguration accepted a channel of an unknown team")
+	}
+}
+
+func TestBridgeHandlerBudget(t *testing.T) {
+	slack := newFakeSlack(t)
+	release := make(chan struct{})
+	slack.Handle("webhook", func(fakeCall) string {
+		<-release
+		return "ok"
+	})
+	t.Cleanup(func() { close(release) })
+	useConfig(t, testConfig("", `"settings": {"fanout_timeout": "100ms"}`))
+	useQueue(t)
+
+	start := time.Now()
+	w := serveRequest(bridgeHandler, "/bridge", postForm("/bridge", url.Values{
+		"token":      {"out-a"},
+		"team_id":    {teamA},
+		"channel_id": {chanA},
+		"user_name":  {"alice"},
+		"text":       {"hi"},
+		"timestamp":  {"1.000"},
+	}))
+	if elapsed := time.Since(start); w.Code != 200 || elapsed > 50*time.Millisecond {
+		t.Errorf("bridgeHandler returned %v after %v, want 200 without waiting for the fan-out", w.Code, elapsed)
+	}
+
+	// The fan-out gives up on the slow destination at its own deadline.
+	if err := queue.Flush(testContext(t)); err != nil {
+		t.Fatalf("Fan-out outlived its deadline: %v", err)
+	}
+	if snapshot := stats.Snapshot(false); snapshot.Errors != 1 || snapshot.Forwarded != 0 {
+		t.Errorf("Counted %d errors and %d forwards, want the slow destination to fail", snapshot.Errors, snapshot.Forwarded)
+	}
+}
+
+func TestBridgeBodyFormats(t *testing.T) {
+	form := url.Values{
+		"token":       {"out-a"},
+		"team_id":     {teamA},
+		"channel_id":  {chanA},
+		"user_name":   {"alice"},
+		"text":        {"hello"},
+		"timestamp":   {"1488369600.000100"},
+		"attachments": {`[{"fallback":"build","text":"build"}]`},
+	}
+	body := `{"token":"out-a","team_id":"` + teamA + `","channel_id":"` + chanA + `","user_name":"alice","text":"hello",` +
+		`"timestamp":"1488369600.000100","attachments":[{"fallback":"build","text":"build"}]}`
+	jsonRequest := func(contentType string, body string) *http.Request {
+		req := httptest.NewRequest("POST", "/bridge", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return req
+	}
+	tests := []struct {
+		name      string
+		req       *http.Request
+		wantCode  int
+		wantPosts int
+	}{
+		{"form", postForm("/bridge", form), 200, 1},
+		{"json", jsonRequest("application/json", body), 200, 1},
+		{"json with charset", jsonRequest("application/json; charset=utf-8", body), 200, 1},
+		{"malformed json", jsonRequest("application/json", body[1:]), 400, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(""))
+			useQueue(t)
+
+			if w := serveRequest(bridgeHandler, "/bridge", test.req); w.Code != test.wantCode {
+				t.Fatalf("bridgeHandler returned %v, want %v", w.Code, test.wantCode)
+			}
+			queue.Flush(testContext(t))
+			posts := slack.Posts()
+			if len(posts) != test.wantPosts {
+				t.Fatalf("Got %d posts, want %d", len(posts), test.wantPosts)
+			}
+			if len(posts) > 0 {
+				post := posts[0]
+				if post.Get("text") != "hello" || post.Get("username") != "alice" || !strings.Contains(post.Get("attachments"), "build") {
+					t.Errorf("Posted %v, want the message with its attachment", post.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestUnfurlOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   string
+		wantLinks string
+		wantMedia string
+	}{
+		{"defaults", `{}`, "", ""},
+		{"disabled", `{"unfurl_links": false, "unfurl_media": false}`, "false", "false"},
+		{"enabled", `{"unfurl_links": true, "unfurl_media": true}`, "true", "true"},
+		{"mixed", `{"unfurl_links": true, "unfurl_media": false}`, "true", "false"},
+		{"web api", `{"threads": true, "unfurl_links": false}`, "false", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "https://example.com", Timestamp: "1.000"}
+			if err := (Channel{teamB, chanB}).PostMessage(context.Background(), msg); err != nil {
+				t.Fatalf("PostMessage: %v", err)
+			}
+			posts := slack.Posts()
+			if len(posts) != 1 {
+				t.Fatalf("Got %d posts, want 1", len(posts))
+			}
+			if links, media := posts[0].Get("unfurl_links"), posts[0].Get("unfurl_media"); links != test.wantLinks || media != test.wantMedia {
+				t.Errorf("Posted unfurl_links %q, unfurl_media %q; want %q, %q", links, media, test.wantLinks, test.wantMedia)
+			}
+		})
+	}
+}
+
+func TestRewriteMentions(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		preview   bool
+		want      string
+		wantCalls int
+	}{
+		{"no mentions", "hello", false, "hello", 0},
+		{"looked up", "hi <@U0000000A>!", false, "hi @name-u0000000a!", 1},
+		{"labelled", "hi <@U0000000A|alice>", false, "hi @alice", 0},
+		{"extra label fields", "hi <@U0000000A|alice|extra>", false, "hi @alice", 0},
+		{"repeated user looked up once", "<@U0000000A> and <@U0000000A>", false, "@name-u0000000a and @name-u0000000a", 1},
+		{"several users", "<@U0000000A> <@U0000000B> <@U0000000A>", false, "@name-u0000000a @name-u0000000b @name-u0000000a", 2},
+		{"unknown user", "hi <@UNKNOWN>", false, "hi @UNKNOWN", 1},
+		{"preview", "hi <@U0000000A>", true, "hi @U0000000A", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("users.info", func(call fakeCall) string {
+				if user := call.Get("user"); user != "UNKNOWN" {
+					return `{"ok":true,"user":{"id":"` + user + `","name":"name-` + strings.ToLower(user) + `"}}`
+				}
+				return `{"ok":false,"error":"user_not_found"}`
+			})
+			useConfig(t, testConfig(""))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: test.text, Preview: test.preview}
+			msg.RewriteMentions()
+			if msg.Text != test.want {
+				t.Errorf("RewriteMentions() = %q, want %q", msg.Text, test.want)
+			}
+			if calls := len(slack.Calls("users.info")); calls != test.wantCalls {
+				t.Errorf("Made %d users.info calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func BenchmarkRewriteMentions(b *testing.B) {
+	newFakeSlack(b)
+	useConfig(b, testConfig(""))
+	text := "<@U0000000A> can you look at this with <@U0000000B|bob>? " +
+		strings.Repeat("Some context for the change, ", 10) + "thanks <@U0000000A>"
+	// Fill the user cache so the benchmark measures the rewrite itself.
+	warm := slackMessage{Channel: Channel{teamA, chanA}, Text: text}
+	warm.RewriteMentions()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := slackMessage{Channel: Channel{teamA, chanA}, Text: text}
+		msg.RewriteMentions()
+	}
+}
+
+func TestAttachmentOnlyPayload(t *testing.T) {
+	attachments := []slack.Attachment{{Fallback: "chart", ImageURL: "https://img/chart.png"}}
+	tests := []struct {
+		name        string
+		destination string
+		method      string
+		text        string
+		attachments []slack.Attachment
+		wantText    bool
+	}{
+		{"webhook, attachments only", `{}`, "webhook", "", attachments, false},
+		{"webhook, text and attachments", `{}`, "webhook", "look", attachments, true},
+		{"chat.postMessage, attachments only", `{"token": "xoxb-b"}`, "chat.postMessage", "", attachments, false},
+		{"chat.postMessage, text only", `{"token": "xoxb-b"}`, "chat.postMessage", "look", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.destination+`}`))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: test.text, Attachments: test.attachments}
+
+			if err := (Channel{teamB, chanB}).PostMessage(testContext(t), msg); err != nil {
+				t.Fatalf("PostMessage = %v", err)
+			}
+			calls := slack.Calls(test.method)
+			if len(calls) != 1 || calls[0].Body == nil {
+				t.Fatalf("Made %d %v calls, want one with a JSON body", len(calls), test.method)
+			}
+			body := calls[0].Body
+			if _, ok := body["text"]; ok != test.wantText {
+				t.Errorf("Payload %v has text %v, want %v", body, ok, test.wantText)
+			}
+			if got, want := calls[0].Get("attachments"), mustMarshal(t, test.attachments); len(test.attachments) > 0 && !strings.Contains(got, `"fallback":"chart"`) {
+				t.Errorf("Posted attachments %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWebhookFallback(t *testing.T) {
+	tests := []struct {
+		name          string
+		destination   string
+		webhookStatus int
+		apiStatus     int
+		wantErr       bool
+		wantAPICalls  int
+		wantPath      string
+	}{
+		{"webhook", `{"webhook_fallback": true}`, 0, 0, false, 0, postWebhook},
+		{"rate limited, fallback", `{"webhook_fallback": true}`, 429, 0, false, 1, postFallback},
+		{"rate limited, no fallback", `{}`, 429, 0, true, 0, ""},
+		{"other error", `{"webhook_fallback": true}`, 500, 0, true, 0, ""},
+		{"fallback failed", `{"webhook_fallback": true}`, 429, 500, true, 1, ""},
+		{"Web API destination", `{"token": "xoxb-b"}`, 0, 0, false, 1, postAPI},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Fail("webhook", test.webhookStatus)
+			slack.Fail("chat.postMessage", test.apiStatus)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.destination+`}`))
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hi", Timestamp: "1.000"}
+
+			err := (Channel{teamB, chanB}).PostMessage(testContext(t), msg)
+			if (err != nil) != test.wantErr {
+				t.Errorf("PostMessage = %v, want error %v", err, test.wantErr)
+			}
+			calls := slack.Calls("chat.postMessage")
+			if len(calls) != test.wantAPICalls {
+				t.Fatalf("Made %d chat.postMessage calls, want %d", len(calls), test.wantAPICalls)
+			}
+			for _, call := range calls {
+				if call.Get("channel") != chanB || call.Get("text") != "hi" {
+					t.Errorf("Fell back with %v", call.Body)
+				}
+			}
+			for path, n := range stats.Snapshot(false).Posted {
+				if want := path == test.wantPath; (n == 1) != want || n > 1 {
+					t.Errorf("Counted %d posts by %v", n, path)
+				}
+			}
+		})
+	}
+}
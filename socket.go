@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const socketReconnectDelay = 5 * time.Second
+
+type socketEnvelope struct {
+	EnvelopeId string          `json:"envelope_id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Reason     string          `json:"reason"`
+	// RetryAttempt counts Slack's redeliveries of an event that wasn't
+	// acknowledged in time, zero on its first delivery.
+	RetryAttempt int    `json:"retry_attempt"`
+	RetryReason  string `json:"retry_reason"`
+}
+
+// openSocketURL asks Slack for a Socket Mode WebSocket URL using an
+// app-level token.
+func openSocketURL(appToken string) (string, error) {
+	req, err := http.NewRequest("POST", apiURL+"apps.connections.open", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		apiResponse
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	if !response.Ok {
+		return "", fmt.Errorf("apps.connections.open: %v", response.Error)
+	}
+	return response.URL, nil
+}
+
+// RunSocketMode receives events over Socket Mode and feeds them into the
+// same pipeline as the /events endpoint, reconnecting whenever Slack drops
+// the connection.
+func RunSocketMode(appToken string) {
+	for {
+		if err := socketSession(appToken); err != nil {
+			log.Printf("Socket Mode: %v", err)
+		}
+		time.Sleep(socketReconnectDelay)
+	}
+}
+
+func socketSession(appToken string) error {
+	url, err := openSocketURL(appToken)
+	if err != nil {
+		return err
+	}
+	conn, err := websocket.Dial(url, "", "https://slack.com")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		var envelope socketEnvelope
+		if err := websocket.JSON.Receive(conn, &envelope); err != nil {
+			return err
+		}
+
+		if envelope.EnvelopeId != "" {
+			ack := map[string]string{"envelope_id": envelope.EnvelopeId}
+			if err := websocket.JSON.Send(conn, ack); err != nil {
+				return err
+			}
+		}
+
+		switch envelope.Type {
+		case "disconnect":
+			log.Printf("Socket Mode disconnect requested: %v", envelope.Reason)
+			return nil
+		case "events_api":
+			var event eventEnvelope
+			if err := json.Unmarshal(envelope.Payload, &event); err != nil {
+				log.Printf("Malformed Socket Mode event: %v", err)
+				continue
+			}
+			if event.Type != "event_callback" || handledRetry(event.EventId, strconv.Itoa(envelope.RetryAttempt), envelope.RetryReason) {
+				continue
+			}
+			handleCallback(event)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// fakeSocket serves a Socket Mode connection that sends envelopes in
+// order, recording the IDs acknowledged, then asks the client to
+// disconnect.
+func fakeSocket(t testing.TB, slack *fakeSlack, envelopes []string) *[]string {
+	var acks []string
+	server := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		for _, envelope := range envelopes {
+			if err := websocket.Message.Send(conn, envelope); err != nil {
+				return
+			}
+			var ack struct {
+				EnvelopeId string `json:"envelope_id"`
+			}
+			if err := websocket.JSON.Receive(conn, &ack); err != nil {
+				return
+			}
+			acks = append(acks, ack.EnvelopeId)
+		}
+		websocket.Message.Send(conn, `{"type":"disconnect","reason":"refresh_requested"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	slack.Handle("apps.connections.open", func(call fakeCall) string {
+		return `{"ok":true,"url":"` + url + `"}`
+	})
+	return &acks
+}
+
+// socketEvent wraps an Events API event in a Socket Mode envelope.
+func socketEvent(id string, eventId string, event string) string {
+	return `{"envelope_id":"` + id + `","type":"events_api","payload":{"type":"event_callback","team_id":"` + teamA + `","event_id":"` + eventId + `","event":` + event + `}}`
+}
+
+func TestSocketMode(t *testing.T) {
+	message := `{"type":"message","channel":"` + chanA + `","user":"U0000000A","text":"hello","ts":"1.000"}`
+	tests := []struct {
+		name      string
+		envelopes []string
+		wantPosts int
+	}{
+		{"message", []string{socketEvent("E1", "Ev1", message)}, 1},
+		{"unmapped channel", []string{socketEvent("E1", "Ev1", strings.Replace(message, chanA, chanC, 1))}, 0},
+		{"other event", []string{`{"envelope_id":"E1","type":"slash_commands","payload":{}}`}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(""))
+			useQueue(t)
+			acks := fakeSocket(t, slack, test.envelopes)
+
+			if err := socketSession("xapp-1"); err != nil {
+				t.Fatalf("socketSession: %v", err)
+			}
+			queue.Flush(testContext(t))
+
+			if len(*acks) != len(test.envelopes) {
+				t.Errorf("Acknowledged %v, want every envelope", *acks)
+			}
+			if calls := slack.Calls("apps.connections.open"); len(calls) != 1 || calls[0].Header.Get("Authorization") != "Bearer xapp-1" {
+				t.Errorf("Opened the connection with %v", calls)
+			}
+			posts := slack.Posts()
+			if len(posts) != test.wantPosts {
+				t.Fatalf("Got %d posts, want %d", len(posts), test.wantPosts)
+			}
+			if len(posts) > 0 && posts[0].Get("text") != "hello" {
+				t.Errorf("Posted %q, want hello", posts[0].Get("text"))
+			}
+		})
+	}
+}
+
+func TestSocketModeRetries(t *testing.T) {
+	message := `{"type":"message","channel":"` + chanA + `","user":"U0000000A","text":"hello","ts":"1.000"}`
+	retry := func(envelope string, attempt int) string {
+		return strings.Replace(envelope, `"type":"events_api"`, fmt.Sprintf(`"type":"events_api","retry_attempt":%d,"retry_reason":"timeout"`, attempt), 1)
+	}
+	tests := []struct {
+		name      string
+		envelopes []string
+		wantPosts int
+	}{
+		{"first delivery", []string{retry(socketEvent("E1", "Ev1", message), 0)}, 1},
+		// The retry has its own timestamp so that it isn't deduplicated.
+		{"retry of a handled event", []string{socketEvent("E1", "Ev1", message), retry(socketEvent("E2", "Ev1", strings.Replace(message, "1.000", "2.000", 1)), 1)}, 1},
+		{"retry of an unseen event", []string{retry(socketEvent("E1", "Ev1", message), 1)}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(""))
+			useQueue(t)
+			acks := fakeSocket(t, slack, test.envelopes)
+
+			if err := socketSession("xapp-1"); err != nil {
+				t.Fatalf("socketSession: %v", err)
+			}
+			queue.Flush(testContext(t))
+
+			if len(*acks) != len(test.envelopes) {
+				t.Errorf("Acknowledged %v, want every envelope", *acks)
+			}
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+		})
+	}
+}
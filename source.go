@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// ConfigSource provides the configuration. Load reads it once; Watch
+// sends each changed configuration to updates, for as long as the source
+// can change.
+type ConfigSource interface {
+	Load() (*Configuration, error)
+	Watch(updates chan<- *Configuration)
+}
+
+var current atomic.Value
+
+// config returns the running configuration.
+func config() *Configuration {
+	c, _ := current.Load().(*Configuration)
+	return c
+}
+
+// SetConfiguration atomically replaces the running configuration. Settings
+// read once at startup, such as the queue size, listeners and recorded
+// thread mirrors, are unaffected.
+func SetConfiguration(c *Configuration) {
+	current.Store(c)
+}
+
+// WatchConfiguration swaps in each configuration source sends that
+// differs from the running one.
+func WatchConfiguration(source ConfigSource) {
+	updates := make(chan *Configuration)
+	go func() {
+		source.Watch(updates)
+		close(updates)
+	}()
+	for c := range updates {
+		if config().Equivalent(c) {
+			continue
+		}
+		log.Printf("Configuration changed, reloading")
+		SetConfiguration(c)
+	}
+}
+
+// loadConfiguration builds the configuration read by read and checks
+// every team's API token.
+func loadConfiguration(lenient bool, read func(*ConfigErrors) (*FileConfig, error)) (*Configuration, error) {
+	errs := &ConfigErrors{Lenient: lenient}
+	fc, err := read(errs)
+	if err != nil {
+		return nil, err
+	}
+	c, err := BuildConfiguration(fc, errs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.teams) == 0 || len(c.channelMap) == 0 {
+		log.Printf("Warning: no teams or channels are configured, nothing will be bridged")
+	}
+	if len(errs.Skipped) > 0 {
+		log.Printf("Skipped %v invalid configuration entries:", len(errs.Skipped))
+		for _, err := range errs.Skipped {
+			log.Printf("  %v", err)
+		}
+	}
+
+	if err := checkTokens(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type tokenCheck struct {
+	team     *Team
+	response *slack.AuthTestResponse
+	err      error
+}
+
+// checkTokens runs auth.test for every team at once, learning the bridge's
+// user in each. Teams that haven't answered within token_check_timeout
+// count as failed. Under the "fail" token_check policy any failure fails
+// loading; under "warn" it is logged and the team kept, so it can recover
+// without a restart.
+func checkTokens(c *Configuration) error {
+	if c.settings.TokenCheck == tokenCheckOff {
+		return nil
+	}
+
+	results := make(chan tokenCheck, len(c.teams))
+	for _, team := range c.teams {
+		go func(team *Team) {
+			response, err := team.AuthTest()
+			results <- tokenCheck{team, response, err}
+		}(team)
+	}
+
+	timeout := time.NewTimer(c.settings.TokenCheckTimeout.Duration)
+	defer timeout.Stop()
+	checked := make(map[*Team]bool, len(c.teams))
+	var failed error
+	for len(checked) < len(c.teams) {
+		select {
+		case result := <-results:
+			checked[result.team] = true
+			if result.err != nil {
+				log.Printf("Token for team %v is invalid: %v", result.team.Id, result.err)
+				if failed == nil {
+					failed = result.err
+				}
+				continue
+			}
+			log.Printf("Token for team %v is valid", result.team.Id)
+			result.team.UserId = result.response.UserID
+		case <-timeout.C:
+			for _, team := range c.teams {
+				if !checked[team] {
+					log.Printf("Token check for team %v timed out", team.Id)
+					checked[team] = true
+					if failed == nil {
+						failed = fmt.Errorf("Token check for team %v timed out", team.Id)
+					}
+				}
+			}
+		}
+	}
+
+	if failed != nil && c.settings.TokenCheck == tokenCheckFail {
+		return failed
+	}
+	return nil
+}
+
+// envSource reads the legacy environment configuration, which can't
+// change while running.
+type envSource struct {
+	lenient bool
+}
+
+func (s envSource) Load() (*Configuration, error) {
+	return loadConfiguration(s.lenient, LegacyConfig)
+}
+
+func (s envSource) Watch(updates chan<- *Configuration) {}
+
+const configPollInterval = 10 * time.Second
+
+// fileSource reads a JSON configuration file, reloading it when its
+// modification time changes.
+type fileSource struct {
+	path     string
+	lenient  bool
+	modified time.Time
+}
+
+func (s *fileSource) Load() (*Configuration, error) {
+	if info, err := os.Stat(s.path); err == nil {
+		s.modified = info.ModTime()
+	}
+	return loadConfiguration(s.lenient, func(*ConfigErrors) (*FileConfig, error) {
+		return ReadFileConfig(s.path)
+	})
+}
+
+func (s *fileSource) Watch(updates chan<- *Configuration) {
+	for range time.Tick(configPollInterval) {
+		info, err := os.Stat(s.path)
+		if err != nil || info.ModTime().Equal(s.modified) {
+			continue
+		}
+		c, err := s.Load()
+		if err != nil {
+			log.Printf("Not reloading %v: %v", s.path, err)
+			continue
+		}
+		updates <- c
+	}
+}
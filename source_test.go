@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSource sends each of its updates, then stops watching.
+type fakeSource struct {
+	initial *Configuration
+	updates []*Configuration
+}
+
+func (s *fakeSource) Load() (*Configuration, error) { return s.initial, nil }
+
+func (s *fakeSource) Watch(updates chan<- *Configuration) {
+	for _, c := range s.updates {
+		updates <- c
+	}
+}
+
+// buildConfig builds the configuration in content without running it.
+func buildConfig(t testing.TB, content string) *Configuration {
+	t.Helper()
+	fc, err := parseFileConfig([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := BuildConfiguration(fc, &ConfigErrors{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestWatchConfiguration(t *testing.T) {
+	tests := []struct {
+		name        string
+		update      string
+		wantSwapped bool
+	}{
+		{"changed", withChannel(testConfig(""), teamB+"/"+chanC), true},
+		{"equivalent", testConfig(""), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			running := useConfig(t, testConfig(""))
+			update := buildConfig(t, test.update)
+			source := &fakeSource{initial: running, updates: []*Configuration{update}}
+
+			WatchConfiguration(source)
+			if swapped := config() == update; swapped != test.wantSwapped {
+				t.Errorf("Swapped in the update: %v, want %v", swapped, test.wantSwapped)
+			}
+			if test.wantSwapped && config().channelMap[Channel{teamB, chanC}] == nil {
+				t.Errorf("Running configuration doesn't bridge the added channel")
+			}
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slackline.json")
+	if err := ioutil.WriteFile(path, []byte(testConfig("", `"settings": {"token_check": "off"}`)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := &fileSource{path: path}
+	c, err := source.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(c.teams) != 2 || c.channelMap[Channel{teamA, chanA}] == nil {
+		t.Errorf("Loaded %+v, want the test configuration", c)
+	}
+	if source.modified.IsZero() {
+		t.Errorf("Load didn't record the file's modification time")
+	}
+}
+
+func TestCheckTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		response   string
+		wantErr    bool
+		wantUserId string
+	}{
+		{"valid", tokenCheckFail, `{"ok":true,"user_id":"U0000000Z"}`, false, "U0000000Z"},
+		{"another team's token", tokenCheckFail, `{"ok":true,"user_id":"U0000000Z","team_id":"T0000000Z"}`, true, ""},
+		{"invalid, fail", tokenCheckFail, `{"ok":false,"error":"invalid_auth"}`, true, ""},
+		{"invalid, warn", tokenCheckWarn, `{"ok":false,"error":"invalid_auth"}`, false, ""},
+		{"off", tokenCheckOff, `{"ok":false,"error":"invalid_auth"}`, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("auth.test", func(call fakeCall) string {
+				team := map[string]string{"xoxb-a": teamA, "xoxb-b": teamB}[call.Get("token")]
+				// Responses without their own team answer for the token's.
+				return strings.Replace(test.response, `"ok":true`, `"ok":true,"team_id":"`+team+`"`, 1)
+			})
+			c := buildConfig(t, testConfig("", `"settings": {"token_check": "`+test.policy+`"}`))
+
+			if err := checkTokens(c); (err != nil) != test.wantErr {
+				t.Errorf("checkTokens = %v, want error %v", err, test.wantErr)
+			}
+			if got := c.teams[teamA].UserId; got != test.wantUserId {
+				t.Errorf("Learned user %q, want %q", got, test.wantUserId)
+			}
+		})
+	}
+}
+
+func TestCheckTokensPerTeam(t *testing.T) {
+	valid := `{"ok":true,"user_id":"U0000000Z"}`
+	invalid := `{"ok":false,"error":"invalid_auth"}`
+	tests := []struct {
+		name      string
+		policy    string
+		responseA string
+		responseB string
+		slowB     bool
+		wantErr   bool
+		wantUserB string
+	}{
+		{"both valid", tokenCheckFail, valid, valid, false, false, "U0000000Z"},
+		{"one invalid, fail", tokenCheckFail, valid, invalid, false, true, ""},
+		{"one invalid, warn", tokenCheckWarn, valid, invalid, false, false, ""},
+		{"timed out, fail", tokenCheckFail, valid, valid, true, true, ""},
+		{"timed out, warn", tokenCheckWarn, valid, valid, true, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			release := make(chan struct{})
+			defer close(release)
+			slack.Handle("auth.test", func(call fakeCall) string {
+				if call.Get("token") == "xoxb-a" {
+					return strings.Replace(test.responseA, `"ok":true`, `"ok":true,"team_id":"`+teamA+`"`, 1)
+				}
+				if test.slowB {
+					<-release
+				}
+				return strings.Replace(test.responseB, `"ok":true`, `"ok":true,"team_id":"`+teamB+`"`, 1)
+			})
+			c := buildConfig(t, testConfig("", `"settings": {"token_check": "`+test.policy+`", "token_check_timeout": "50ms"}`))
+
+			if err := checkTokens(c); (err != nil) != test.wantErr {
+				t.Errorf("checkTokens = %v, want error %v", err, test.wantErr)
+			}
+			// The other team is checked however this one fares.
+			if got := c.teams[teamA].UserId; got != "U0000000Z" {
+				t.Errorf("Learned user %q for %v, want U0000000Z", got, teamA)
+			}
+			if got := c.teams[teamB].UserId; got != test.wantUserB {
+				t.Errorf("Learned user %q for %v, want %q", got, teamB, test.wantUserB)
+			}
+		})
+	}
+}
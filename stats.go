@@ -0,0 +1,168 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// Reasons a received message is dropped without being forwarded.
+const (
+	dropQueueFull    = "queue_full"
+	dropShed         = "shed"
+	dropSlackbot     = "slackbot"
+	dropUnmapped     = "unmapped"
+	dropUnknownTeam  = "unknown_team"
+	dropNotPermitted = "not_permitted"
+	dropStale        = "stale"
+	dropDuplicate    = "duplicate"
+	dropSampled      = "sampled"
+	dropSyncOnly     = "sync_only"
+	dropCommand      = "command"
+	dropHopLimit     = "hop_limit"
+	dropThreadFilter = "thread_filter"
+	dropArchived     = "archived"
+	dropFlapping     = "flapping"
+	dropLoopback     = "loopback"
+)
+
+var dropReasons = []string{
+	dropQueueFull,
+	dropShed,
+	dropSlackbot,
+	dropUnmapped,
+	dropUnknownTeam,
+	dropNotPermitted,
+	dropStale,
+	dropDuplicate,
+	dropSampled,
+	dropSyncOnly,
+	dropCommand,
+	dropHopLimit,
+	dropThreadFilter,
+	dropArchived,
+	dropFlapping,
+	dropLoopback,
+}
+
+// Paths a message is posted to a destination by.
+const (
+	postWebhook  = "webhook"
+	postAPI      = "api"
+	postFallback = "api_fallback"
+)
+
+var postPaths = []string{postWebhook, postAPI, postFallback}
+
+// statsRegistry counts messages through the bridge. The counters are
+// updated atomically, and the set of drop reasons is fixed so the map
+// itself is never written after startup.
+type statsRegistry struct {
+	received  int64
+	forwarded int64
+	errors    int64
+	dropped   map[string]*int64
+	posted    map[string]*int64
+
+	auditDropped int64
+}
+
+var stats = newStats()
+
+func newStats() *statsRegistry {
+	s := &statsRegistry{dropped: make(map[string]*int64), posted: make(map[string]*int64)}
+	for _, reason := range dropReasons {
+		s.dropped[reason] = new(int64)
+	}
+	for _, path := range postPaths {
+		s.posted[path] = new(int64)
+	}
+	return s
+}
+
+// Received counts a message accepted by an ingress.
+func (s *statsRegistry) Received() {
+	atomic.AddInt64(&s.received, 1)
+}
+
+// Forwarded counts a message posted to one destination.
+func (s *statsRegistry) Forwarded() {
+	atomic.AddInt64(&s.forwarded, 1)
+}
+
+// Error counts a failed post to one destination.
+func (s *statsRegistry) Error() {
+	atomic.AddInt64(&s.errors, 1)
+}
+
+// Dropped counts a message dropped for reason, one of the drop* constants.
+func (s *statsRegistry) Dropped(reason string) {
+	atomic.AddInt64(s.dropped[reason], 1)
+}
+
+// Posted counts a message posted by path, one of the post* constants.
+func (s *statsRegistry) Posted(path string) {
+	atomic.AddInt64(s.posted[path], 1)
+}
+
+// AuditDropped counts an audit event dropped because the buffer was full.
+func (s *statsRegistry) AuditDropped() {
+	atomic.AddInt64(&s.auditDropped, 1)
+}
+
+type StatsSnapshot struct {
+	Received  int64            `json:"received"`
+	Forwarded int64            `json:"forwarded"`
+	Errors    int64            `json:"errors"`
+	Dropped   map[string]int64 `json:"dropped"`
+	// Posted counts successful posts by the path they took: the incoming
+	// webhook, the Web API, or the Web API after the webhook was rate
+	// limited.
+	Posted map[string]int64 `json:"posted"`
+	// OutboundWaitSeconds is the total time outbound calls have spent
+	// waiting on max_outbound_calls since startup. It isn't reset.
+	OutboundWaitSeconds float64 `json:"outbound_wait_seconds"`
+	// Rates is the current posts per second allowed to each destination
+	// with a max_rate.
+	Rates map[string]float64 `json:"rates,omitempty"`
+	// BytesSent is the size of the payloads posted to each destination
+	// since startup.
+	BytesSent map[string]int64 `json:"bytes_sent,omitempty"`
+	// AuditDropped is how many audit events were dropped for a full
+	// buffer.
+	AuditDropped int64 `json:"audit_dropped"`
+	// Methods counts the Web API calls made to each method, how many Slack
+	// rate limited and the time spent waiting on its budget.
+	Methods map[string]MethodStats `json:"methods,omitempty"`
+}
+
+// Snapshot reads the counters, zeroing them if reset is set. Each counter
+// is read atomically, but not all of them at the same instant.
+func (s *statsRegistry) Snapshot(reset bool) StatsSnapshot {
+	read := func(n *int64) int64 {
+		if reset {
+			return atomic.SwapInt64(n, 0)
+		}
+		return atomic.LoadInt64(n)
+	}
+
+	snapshot := StatsSnapshot{
+		Received:  read(&s.received),
+		Forwarded: read(&s.forwarded),
+		Errors:    read(&s.errors),
+		Dropped:   make(map[string]int64, len(s.dropped)),
+		Posted:    make(map[string]int64, len(s.posted)),
+
+		AuditDropped: read(&s.auditDropped),
+
+		OutboundWaitSeconds: OutboundWait().Seconds(),
+		Rates:               rates.Snapshot(),
+		BytesSent:           byteRates.Snapshot(),
+		Methods:             methodLimits.Snapshot(),
+	}
+	for reason, n := range s.dropped {
+		snapshot.Dropped[reason] = read(n)
+	}
+	for path, n := range s.posted {
+		snapshot.Posted[path] = read(n)
+	}
+	return snapshot
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestStatsCounters(t *testing.T) {
+	s := newStats()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Received()
+			s.Forwarded()
+			s.Forwarded()
+			s.Dropped(dropStale)
+			s.Posted(postWebhook)
+		}()
+	}
+	s.Error()
+	wg.Wait()
+
+	tests := []struct {
+		name  string
+		reset bool
+		want  StatsSnapshot
+	}{
+		{"read", false, StatsSnapshot{Received: 50, Forwarded: 100, Errors: 1}},
+		{"read and reset", true, StatsSnapshot{Received: 50, Forwarded: 100, Errors: 1}},
+		{"after reset", false, StatsSnapshot{}},
+	}
+	for _, test := range tests {
+		got := s.Snapshot(test.reset)
+		if got.Received != test.want.Received || got.Forwarded != test.want.Forwarded || got.Errors != test.want.Errors {
+			t.Errorf("%v: got %d received, %d forwarded, %d errors; want %d, %d, %d", test.name,
+				got.Received, got.Forwarded, got.Errors, test.want.Received, test.want.Forwarded, test.want.Errors)
+		}
+		if wantDropped := test.want.Received; got.Dropped[dropStale] != wantDropped || got.Posted[postWebhook] != wantDropped {
+			t.Errorf("%v: got %d stale drops and %d webhook posts, want %d", test.name, got.Dropped[dropStale], got.Posted[postWebhook], wantDropped)
+		}
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	useConfig(t, testConfig(""))
+	content, err := json.Marshal(newStats().Snapshot(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shape map[string]interface{}
+	if err := json.Unmarshal(content, &shape); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"received", "forwarded", "errors", "dropped", "posted", "outbound_wait_seconds", "audit_dropped"} {
+		if _, present := shape[key]; !present {
+			t.Errorf("Snapshot JSON %s is missing %q", content, key)
+		}
+	}
+	// Every drop reason is reported, even when zero.
+	dropped := shape["dropped"].(map[string]interface{})
+	for _, reason := range dropReasons {
+		if _, present := dropped[reason]; !present {
+			t.Errorf("Snapshot JSON is missing drop reason %q", reason)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store holds bridge state as keys that expire, so a store backed by
+// disk can carry it over a restart.
+type Store interface {
+	// Get returns the value of key, unless it is missing or expired.
+	Get(key string) (string, bool)
+	// Set stores value under key until ttl has passed.
+	Set(key string, value string, ttl time.Duration)
+	// Flush writes out any pending changes.
+	Flush(ctx context.Context) error
+}
+
+type storeEntry struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// storePruneInterval is how often setting a key also removes expired
+// ones, so the cost of pruning is spread over many changes.
+const storePruneInterval = time.Minute
+
+// memoryStore is a Store that lasts until the bridge stops.
+type memoryStore struct {
+	sync.Mutex
+	entries map[string]storeEntry
+	pruned  time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]storeEntry)}
+}
+
+func (s *memoryStore) Get(key string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	entry, present := s.entries[key]
+	if !present || now().After(entry.Expires) {
+		return "", false
+	}
+	return entry.Value, true
+}
+
+func (s *memoryStore) Set(key string, value string, ttl time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	if now().Sub(s.pruned) >= storePruneInterval {
+		s.prune()
+	}
+	s.entries[key] = storeEntry{value, now().Add(ttl)}
+}
+
+// prune removes expired entries. The caller holds the lock.
+func (s *memoryStore) prune() {
+	s.pruned = now()
+	for key, entry := range s.entries {
+		if now().After(entry.Expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *memoryStore) Flush(context.Context) error {
+	return nil
+}
+
+// storeWriteDelay is how long a file store waits after a change before
+// writing, so bursts of changes are written once.
+const storeWriteDelay = time.Second
+
+// fileStore is a Store kept in memory and written to a JSON file shortly
+// after each change, replacing the file atomically.
+type fileStore struct {
+	*memoryStore
+	path    string
+	pending *time.Timer
+}
+
+func openFileStore(path string) (*fileStore, error) {
+	s := &fileStore{memoryStore: newMemoryStore(), path: path}
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &s.entries); err != nil {
+		return nil, err
+	}
+	s.prune()
+	return s, nil
+}
+
+func (s *fileStore) Set(key string, value string, ttl time.Duration) {
+	s.memoryStore.Set(key, value, ttl)
+
+	s.Lock()
+	defer s.Unlock()
+	if s.pending == nil {
+		s.pending = time.AfterFunc(storeWriteDelay, func() {
+			if err := s.Flush(context.Background()); err != nil {
+				log.Printf("Unable to write store %v: %v", s.path, err)
+			}
+		})
+	}
+}
+
+// Flush writes the store's entries to its file.
+func (s *fileStore) Flush(context.Context) error {
+	s.Lock()
+	if s.pending != nil {
+		s.pending.Stop()
+		s.pending = nil
+	}
+	s.prune()
+	content, err := json.Marshal(s.entries)
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), s.path)
+}
+
+// store is the bridge's state store, in memory unless SetupStore opens a
+// file store.
+var store Store = newMemoryStore()
+
+// SetupStore opens the store at StorePath, when set. The caller registers
+// its flush after those of the work that updates it.
+func SetupStore(settings Settings) error {
+	if settings.StorePath == "" {
+		return nil
+	}
+	s, err := openFileStore(settings.StorePath)
+	if err != nil {
+		return err
+	}
+	store = s
+	return nil
+}
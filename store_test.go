@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		wait        time.Duration
+		wantPresent bool
+	}{
+		{"fresh", time.Minute, 30 * time.Second, true},
+		{"expired", time.Minute, 2 * time.Minute, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			s := newMemoryStore()
+			s.Set("key", "value", test.ttl)
+			advance(test.wait)
+
+			value, present := s.Get("key")
+			if present != test.wantPresent || (present && value != "value") {
+				t.Errorf("Get = %q, %v; want present %v", value, present, test.wantPresent)
+			}
+		})
+	}
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	tests := []struct {
+		name        string
+		wait        time.Duration
+		wantEntries int
+	}{
+		{"before the interval", storePruneInterval / 2, 2},
+		{"after the interval", storePruneInterval, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			s := newMemoryStore()
+			s.Set("expired", "", time.Second)
+			advance(test.wait)
+
+			// Expired entries are only removed once per interval.
+			s.Set("new", "", time.Hour)
+			if got := len(s.entries); got != test.wantEntries {
+				t.Errorf("Store holds %d entries, want %d", got, test.wantEntries)
+			}
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		downtime    time.Duration
+		wantPresent bool
+	}{
+		{"survives a restart", time.Hour, time.Minute, true},
+		{"expires while stopped", time.Minute, time.Hour, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advance := fakeClock(t)
+			path := filepath.Join(t.TempDir(), "store.json")
+			s, err := openFileStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Set("key", "value", test.ttl)
+			if err := s.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			advance(test.downtime)
+
+			reopened, err := openFileStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, present := reopened.Get("key")
+			if present != test.wantPresent || (present && value != "value") {
+				t.Errorf("Get after reopening = %q, %v; want present %v", value, present, test.wantPresent)
+			}
+			if !test.wantPresent && len(reopened.entries) != 0 {
+				t.Errorf("Reopened store kept expired entries %v", reopened.entries)
+			}
+		})
+	}
+}
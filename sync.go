@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/nlopes/slack"
+)
+
+// SyncEdit applies an edit of a forwarded message to its mirrors, running
+// the new text through the group's pipeline. Only messages posted through
+// the Web API have recorded mirrors.
+func (msg slackMessage) SyncEdit() {
+	mirrored := mirrors.Destinations(msg.Channel, msg.Timestamp)
+	if len(mirrored) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	msg.Transform(ctx)
+	for dest, destTs := range mirrored {
+		if err := dest.UpdateMessage(ctx, destTs, msg); err != nil {
+			log.Printf("Unable to update %v in %v: %v", destTs, dest, err)
+		}
+	}
+}
+
+// SyncDelete deletes the mirrors of message ts.
+func (c Channel) SyncDelete(ts string) {
+	ctx, cancel := context.WithTimeout(context.Background(), config().settings.FanoutTimeout.Duration)
+	defer cancel()
+
+	for dest, destTs := range mirrors.Destinations(c, ts) {
+		if err := dest.DeleteMessage(ctx, destTs); err != nil {
+			log.Printf("Unable to delete %v from %v: %v", destTs, dest, err)
+		}
+	}
+}
+
+// UpdateMessage replaces the text and attachments of message ts, posted
+// by the bridge, with those of msg using chat.update. The message is
+// rendered for the channel as it was when posted.
+func (c Channel) UpdateMessage(ctx context.Context, ts string, msg slackMessage) error {
+	target, err := c.Target(ctx)
+	if err != nil {
+		return err
+	}
+	c.render(ctx, &msg)
+
+	body, err := json.Marshal(struct {
+		Channel     string             `json:"channel"`
+		Timestamp   string             `json:"ts"`
+		Text        string             `json:"text"`
+		LinkNames   bool               `json:"link_names"`
+		Attachments []slack.Attachment `json:"attachments,omitempty"`
+	}{target, ts, msg.Text, !msg.mentionsSuppressed(), msg.Attachments})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Updating %v in %v", ts, c)
+	return c.Poster().apiCallJSON(ctx, "chat.update", bytes.NewReader(body), nil)
+}
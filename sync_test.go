@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSyncOnly(t *testing.T) {
+	message := `{"type":"message","channel":"` + chanA + `","user":"U0000000A","text":"new","ts":"2.000"}`
+	edit := `{"type":"message","subtype":"message_changed","channel":"` + chanA + `",` +
+		`"message":{"type":"message","user":"U0000000A","text":"edited","ts":"1.000"}}`
+	deletion := `{"type":"message","subtype":"message_deleted","channel":"` + chanA + `","deleted_ts":"1.000"}`
+	tests := []struct {
+		name       string
+		options    string
+		event      string
+		wantMethod string
+		wantCalls  int
+	}{
+		{"new message forwarded", `{}`, message, "webhook", 1},
+		{"new message skipped", `{"sync_only": true}`, message, "webhook", 0},
+		{"edit applied", `{"sync_only": true}`, edit, "chat.update", 1},
+		{"deletion applied", `{"sync_only": true}`, deletion, "chat.delete", 1},
+		{"edit of an unmirrored message", `{"sync_only": true}`, `{"type":"message","subtype":"message_changed","channel":"` + chanA + `",` +
+			`"message":{"type":"message","user":"U0000000A","text":"edited","ts":"3.000"}}`, "chat.update", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			useQueue(t)
+			mirrors.Record(Channel{teamA, chanA}, "1.000", Channel{teamB, chanB}, "9.000")
+
+			handleEvent(eventEnvelope{Type: "event_callback", TeamId: teamA, EventId: "Ev1", Event: json.RawMessage(test.event)})
+			queue.Flush(testContext(t))
+
+			if test.wantCalls > 0 {
+				waitFor(t, test.wantMethod, func() bool { return len(slack.Calls(test.wantMethod)) >= test.wantCalls })
+			} else {
+				time.Sleep(20 * time.Millisecond)
+			}
+			calls := slack.Calls(test.wantMethod)
+			if len(calls) != test.wantCalls {
+				t.Fatalf("Made %d %v calls, want %d", len(calls), test.wantMethod, test.wantCalls)
+			}
+			if test.name == "new message skipped" && stats.Snapshot(false).Dropped[dropSyncOnly] != 1 {
+				t.Errorf("Skipped message wasn't counted as %v", dropSyncOnly)
+			}
+			if test.wantMethod == "chat.update" && test.wantCalls > 0 {
+				if call := calls[0]; call.Get("ts") != "9.000" || call.Get("text") != "edited" || call.Get("channel") != chanB {
+					t.Errorf("Updated with %v, want the mirror's text edited", call.Body)
+				}
+			}
+			if test.wantMethod == "chat.delete" && test.wantCalls > 0 {
+				if call := calls[0]; call.Get("ts") != "9.000" || call.Get("channel") != chanB {
+					t.Errorf("Deleted with %v, want the mirror", call.Form)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		want        string
+	}{
+		{"unchanged", `{}`, "edited"},
+		{"destination pipeline", `{"pipeline": ["test-reverse"]}`, "detide @" + chanB},
+		{"translated", `{"language": "de"}`, "EDITED"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.destination+`}`))
+			useTranslator(t, &fakeTranslator{})
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "edited", Timestamp: "1.000"}
+			if err := (Channel{teamB, chanB}).UpdateMessage(testContext(t), "9.000", msg); err != nil {
+				t.Fatal(err)
+			}
+			calls := slack.Calls("chat.update")
+			if len(calls) != 1 {
+				t.Fatalf("Made %d chat.update calls, want 1", len(calls))
+			}
+			if got := calls[0].Get("text"); got != test.want {
+				t.Errorf("Updated the mirror to %q, want %q", got, test.want)
+			}
+		})
+	}
+}
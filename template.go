@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"text/template"
+)
+
+// templateData is what a group's template is executed with.
+type templateData struct {
+	User      string
+	Text      string
+	Channel   string
+	Team      string
+	Permalink string
+}
+
+func compileTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid message template %q: %v", text, err)
+	}
+	return tmpl, nil
+}
+
+// ApplyTemplate renders the text through the group's template, keeping the
+// text as it is when the template fails.
+func (msg *slackMessage) ApplyTemplate() {
+	tmpl := msg.Group().template
+	if tmpl == nil {
+		return
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, msg.templateData()); err != nil {
+		log.Printf("Message template failed, forwarding raw text: %v", err)
+		return
+	}
+	msg.Text = out.String()
+}
+
+func (msg *slackMessage) templateData() templateData {
+	data := templateData{
+		User:      msg.Username,
+		Text:      msg.Text,
+		Channel:   msg.ChannelName,
+		Team:      msg.TeamDomain,
+		Permalink: msg.Permalink,
+	}
+	if data.Channel == "" {
+		data.Channel = msg.ChannelId
+	}
+	if data.Team == "" {
+		data.Team = msg.TeamId
+	}
+	return data
+}
+
+// WebhookReply renders the group's webhook reply template, returning ""
+// when the group has none or it fails.
+func (msg *slackMessage) WebhookReply() string {
+	group := msg.Group()
+	if group == nil || group.webhookReply == nil {
+		return ""
+	}
+	var out bytes.Buffer
+	if err := group.webhookReply.Execute(&out, msg.templateData()); err != nil {
+		log.Printf("Webhook reply template failed: %v", err)
+		return ""
+	}
+	return out.String()
+}
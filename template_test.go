@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		msg      slackMessage
+		want     string
+	}{
+		{"none", "", slackMessage{Text: "hi"}, "hi"},
+		{"custom", "[{{.Team}}#{{.Channel}}] {{.User}}: {{.Text}}",
+			slackMessage{Username: "alice", Text: "hi", TeamDomain: "acme", ChannelName: "general"}, "[acme#general] alice: hi"},
+		{"ids without names", "[{{.Team}}#{{.Channel}}] {{.Text}}", slackMessage{Text: "hi"}, "[" + teamA + "#" + chanA + "] hi"},
+		{"permalink", "{{.Text}} ({{.Permalink}})", slackMessage{Text: "hi", Permalink: "https://p/1"}, "hi (https://p/1)"},
+		{"broken", "{{.Missing}}: {{.Text}}", slackMessage{Text: "hi"}, "hi"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options, _ := json.Marshal(map[string]string{"template": test.template})
+			useConfig(t, testConfig(string(options)))
+			msg := test.msg
+			msg.Channel = Channel{teamA, chanA}
+			msg.ApplyTemplate()
+			if msg.Text != test.want {
+				t.Errorf("ApplyTemplate() = %q, want %q", msg.Text, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileTemplate(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantNil bool
+		wantErr bool
+	}{
+		{"", true, false},
+		{"{{.Text}}", false, false},
+		{"{{.Text", true, true},
+	}
+	for _, test := range tests {
+		tmpl, err := compileTemplate(test.text)
+		if (tmpl == nil) != test.wantNil || (err != nil) != test.wantErr {
+			t.Errorf("compileTemplate(%q) = %v, %v", test.text, tmpl, err)
+		}
+	}
+}
+
+func TestWebhookReply(t *testing.T) {
+	useConfig(t, testConfig(`{"webhook_reply": "Mirrored {{.User}}'s message"}`))
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice"}
+	if got := msg.WebhookReply(); got != "Mirrored alice's message" {
+		t.Errorf("WebhookReply() = %q", got)
+	}
+	unmapped := slackMessage{Channel: Channel{teamA, chanC}, Username: "alice"}
+	if got := unmapped.WebhookReply(); got != "" {
+		t.Errorf("WebhookReply() for an unmapped channel = %q", got)
+	}
+}
+
+func TestBridgeWebhookReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  string
+		token    string
+		wantBody string
+	}{
+		{"templated", `{"webhook_reply": "mirrored ✓ for {{.User}}"}`, "out-a", `{"text":"mirrored ✓ for alice"}`},
+		{"disabled", `{}`, "out-a", ""},
+		{"broken template", `{"webhook_reply": "{{.Missing}}"}`, "out-a", ""},
+		{"wrong token", `{"webhook_reply": "mirrored ✓"}`, "wrong", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			useQueue(t)
+
+			w := serveRequest(bridgeHandler, "/bridge", postForm("/bridge", url.Values{
+				"token":      {test.token},
+				"team_id":    {teamA},
+				"channel_id": {chanA},
+				"user_name":  {"alice"},
+				"text":       {"hello"},
+				"timestamp":  {"1488369600.000100"},
+			}))
+			if w.Code != 200 {
+				t.Fatalf("bridgeHandler returned %v", w.Code)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != test.wantBody {
+				t.Errorf("bridgeHandler replied %q, want %q", got, test.wantBody)
+			}
+		})
+	}
+}
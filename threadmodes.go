@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// collectedThreads maps each source thread to the header message its
+// replies are collected under in each destination using threadCollect.
+// The first reply reserves the header under the lock and posts it outside
+// it, so concurrent replies share one without holding up other threads.
+var collectedThreads = struct {
+	sync.Mutex
+	headers *cache
+}{headers: newCache(maxMirrors, 0)}
+
+// collectedHeader is a destination thread header, ready once posted.
+type collectedHeader struct {
+	ready chan struct{}
+	ts    string
+	err   error
+}
+
+// threadFor returns the destination thread a reply should be posted in,
+// following the destination's thread mode, or "" to post it to the
+// channel.
+func (c Channel) threadFor(ctx context.Context, msg slackMessage) (string, error) {
+	switch c.Options().ThreadMode {
+	case threadFlatten:
+		return "", nil
+	case threadCollect:
+		return c.collectThread(ctx, msg)
+	}
+	ts, _ := mirrors.Lookup(msg.Channel, msg.ThreadTimestamp, c)
+	return ts, nil
+}
+
+// collectThread returns the header message that replies in msg's source
+// thread are collected under, posting one if there isn't one yet. A failed
+// post is forgotten so the next reply tries again.
+func (c Channel) collectThread(ctx context.Context, msg slackMessage) (string, error) {
+	key := msg.Channel.String() + "/" + msg.ThreadTimestamp + "/" + c.String()
+	collectedThreads.Lock()
+	if value, present := collectedThreads.headers.Get(key); present {
+		collectedThreads.Unlock()
+		header := value.(*collectedHeader)
+		select {
+		case <-header.ready:
+			return header.ts, header.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	header := &collectedHeader{ready: make(chan struct{})}
+	collectedThreads.headers.Set(key, header)
+	collectedThreads.Unlock()
+
+	source := msg.ChannelName
+	if source == "" {
+		source = msg.ChannelId
+	}
+	header.ts, header.err = c.APIPostMessage(ctx, slackMessage{Channel: msg.Channel, Text: "🧵 Replies to a thread in " + source})
+	if header.err != nil {
+		collectedThreads.Lock()
+		if value, _ := collectedThreads.headers.Get(key); value == header {
+			collectedThreads.headers.Delete(key)
+		}
+		collectedThreads.Unlock()
+	}
+	close(header.ready)
+	return header.ts, header.err
+}
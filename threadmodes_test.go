@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThreadModes(t *testing.T) {
+	tests := []struct {
+		mode         string
+		wantPosts    int
+		wantThreadTs string
+	}{
+		{threadMirror, 3, "1001.000100"},
+		{threadFlatten, 3, ""},
+		{threadCollect, 4, "1002.000100"},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(`{"threads": true}`, `"destinations": {"`+teamB+"/"+chanB+`": {"thread_mode": "`+test.mode+`"}}`))
+			source := Channel{teamA, chanA}
+			dest := Channel{teamB, chanB}
+
+			messages := []slackMessage{
+				{Channel: source, Username: "alice", Text: "root", Timestamp: "1.000"},
+				{Channel: source, Username: "bob", Text: "reply", Timestamp: "2.000", ThreadTimestamp: "1.000"},
+				{Channel: source, Username: "alice", Text: "another reply", Timestamp: "3.000", ThreadTimestamp: "1.000"},
+			}
+			for _, msg := range messages {
+				if err := dest.PostMessage(testContext(t), msg); err != nil {
+					t.Fatalf("PostMessage: %v", err)
+				}
+			}
+
+			posts := slack.Calls("chat.postMessage")
+			if len(posts) != test.wantPosts {
+				t.Fatalf("Made %d posts, want %d", len(posts), test.wantPosts)
+			}
+			if got := posts[0].Get("thread_ts"); got != "" {
+				t.Errorf("Root posted in thread %q", got)
+			}
+			if test.mode == threadCollect && !strings.HasPrefix(posts[1].Get("text"), "🧵 Replies to a thread") {
+				t.Errorf("Collected replies under %q, want a header", posts[1].Get("text"))
+			}
+			for _, post := range posts[len(posts)-2:] {
+				if got := post.Get("thread_ts"); got != test.wantThreadTs {
+					t.Errorf("Posted %q in thread %q, want %q", post.Get("text"), got, test.wantThreadTs)
+				}
+			}
+		})
+	}
+}
+
+func TestCollectThreadConcurrently(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"thread_mode": "collect"}}`))
+	release := make(chan struct{})
+	var mu sync.Mutex
+	headers := 0
+	slack.Handle("chat.postMessage", func(call fakeCall) string {
+		mu.Lock()
+		headers++
+		n := headers
+		mu.Unlock()
+		if n == 1 {
+			<-release
+		}
+		return fmt.Sprintf(`{"ok":true,"ts":"%d.000"}`, 100+n)
+	})
+	dest := Channel{teamB, chanB}
+	reply := func(thread string) slackMessage {
+		return slackMessage{Channel: Channel{teamA, chanA}, Text: "reply", ThreadTimestamp: thread}
+	}
+
+	// Replies to the first thread wait on its header being posted.
+	results := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			ts, _ := dest.collectThread(testContext(t), reply("1.000"))
+			results <- ts
+		}()
+	}
+	waitFor(t, "the first header", func() bool { return len(slack.Calls("chat.postMessage")) == 1 })
+
+	// Which doesn't hold up another thread's.
+	done := make(chan string)
+	go func() {
+		ts, _ := dest.collectThread(testContext(t), reply("2.000"))
+		done <- ts
+	}()
+	select {
+	case ts := <-done:
+		if ts != "102.000" {
+			t.Errorf("Second thread collected under %q, want 102.000", ts)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Second thread's header waited on the first")
+	}
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		if ts := <-results; ts != "101.000" {
+			t.Errorf("Reply collected under %q, want 101.000", ts)
+		}
+	}
+	if n := len(slack.Calls("chat.postMessage")); n != 2 {
+		t.Errorf("Posted %d headers, want 2", n)
+	}
+}
+
+func TestCollectThreadRetries(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"thread_mode": "collect"}}`))
+	dest := Channel{teamB, chanB}
+	msg := slackMessage{Channel: Channel{teamA, chanA}, Text: "reply", ThreadTimestamp: "1.000"}
+
+	steps := []struct {
+		status  int
+		wantTs  string
+		wantErr bool
+	}{
+		{500, "", true},
+		{0, "1002.000100", false},
+		{500, "1002.000100", false},
+	}
+	for i, step := range steps {
+		slack.Fail("chat.postMessage", step.status)
+		ts, err := dest.collectThread(testContext(t), msg)
+		if ts != step.wantTs || (err != nil) != step.wantErr {
+			t.Errorf("Reply %d collected under %q, %v; want %q, error %v", i, ts, err, step.wantTs, step.wantErr)
+		}
+	}
+}
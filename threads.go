@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+)
+
+const maxMirrors = 10000
+
+type mirrorKey struct {
+	Channel
+	Timestamp string
+}
+
+// mirrorMap records which destination message each forwarded source message
+// became, so replies can be threaded onto the right destination message,
+// and the reverse, so reactions can be traced back to the source message.
+// Entries are evicted oldest-first once maxMirrors is reached.
+type mirrorMap struct {
+	sync.Mutex
+	entries map[mirrorKey]map[Channel]string
+	sources map[mirrorKey]mirrorKey
+	order   []mirrorKey
+}
+
+var mirrors = &mirrorMap{
+	entries: make(map[mirrorKey]map[Channel]string),
+	sources: make(map[mirrorKey]mirrorKey),
+}
+
+func (m *mirrorMap) Record(source Channel, ts string, dest Channel, destTs string) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := mirrorKey{source, ts}
+	if _, present := m.entries[key]; !present {
+		if len(m.order) >= maxMirrors {
+			oldest := m.order[0]
+			for dest, destTs := range m.entries[oldest] {
+				delete(m.sources, mirrorKey{dest, destTs})
+			}
+			delete(m.entries, oldest)
+			m.order = m.order[1:]
+		}
+		m.entries[key] = make(map[Channel]string)
+		m.order = append(m.order, key)
+	}
+	m.entries[key][dest] = destTs
+	m.sources[mirrorKey{dest, destTs}] = key
+}
+
+// Lookup returns the destination timestamp that source message ts was
+// mirrored to in dest, if known.
+func (m *mirrorMap) Lookup(source Channel, ts string, dest Channel) (string, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	destTs, ok := m.entries[mirrorKey{source, ts}][dest]
+	return destTs, ok
+}
+
+// Destinations returns the destination timestamps source message ts was
+// mirrored to.
+func (m *mirrorMap) Destinations(source Channel, ts string) map[Channel]string {
+	m.Lock()
+	defer m.Unlock()
+
+	destinations := make(map[Channel]string, len(m.entries[mirrorKey{source, ts}]))
+	for dest, destTs := range m.entries[mirrorKey{source, ts}] {
+		destinations[dest] = destTs
+	}
+	return destinations
+}
+
+// Source returns the source message that dest message ts mirrors, if known.
+func (m *mirrorMap) Source(dest Channel, ts string) (Channel, string, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	source, ok := m.sources[mirrorKey{dest, ts}]
+	return source.Channel, source.Timestamp, ok
+}
+
+// qualifyingThreads records the thread roots posted by one of their
+// group's thread_starters, whose replies are forwarded.
+var qualifyingThreads = newCache(maxMirrors, 0)
+
+// InQualifyingThread reports whether the message should be forwarded under
+// its group's thread_starters: top-level messages by a starter qualify,
+// and start a thread whose replies do too. Groups without thread starters
+// forward everything.
+func (msg *slackMessage) InQualifyingThread() bool {
+	starters := msg.Group().Options.ThreadStarters
+	if len(starters) == 0 {
+		return true
+	}
+
+	if msg.IsReply() {
+		_, present := qualifyingThreads.Get(msg.Channel.String() + "/" + msg.ThreadTimestamp)
+		return present
+	}
+	if !starters.Contains(msg.UserId) {
+		return false
+	}
+	qualifyingThreads.Set(msg.Channel.String()+"/"+msg.Timestamp, true)
+	return true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestReplyBroadcast(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   string
+		broadcast bool
+		want      string
+	}{
+		{"off", `{"threads": true}`, false, ""},
+		{"enabled", `{"threads": true, "reply_broadcast": true}`, false, "true"},
+		{"source broadcast", `{"threads": true}`, true, "true"},
+		{"stripped", `{"threads": true, "strip_broadcasts": true}`, true, ""},
+		{"enabled and stripped", `{"threads": true, "reply_broadcast": true, "strip_broadcasts": true}`, true, "true"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			source := Channel{teamA, chanA}
+			dest := Channel{teamB, chanB}
+			mirrors.Record(source, "1.000", dest, "9.000")
+
+			msg := slackMessage{
+				Channel:         source,
+				Username:        "alice",
+				Text:            "reply",
+				Timestamp:       "2.000",
+				ThreadTimestamp: "1.000",
+				Broadcast:       test.broadcast,
+			}
+			if err := dest.PostMessage(context.Background(), msg); err != nil {
+				t.Fatalf("PostMessage: %v", err)
+			}
+
+			posts := slack.Calls("chat.postMessage")
+			if len(posts) != 1 {
+				t.Fatalf("Got %d posts, want 1", len(posts))
+			}
+			if got := posts[0].Get("thread_ts"); got != "9.000" {
+				t.Errorf("thread_ts = %q, want 9.000", got)
+			}
+			if got := posts[0].Get("reply_broadcast"); got != test.want {
+				t.Errorf("reply_broadcast = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMirrorMap(t *testing.T) {
+	source := Channel{teamA, chanA}
+	dest := Channel{teamB, chanB}
+	m := &mirrorMap{
+		entries: make(map[mirrorKey]map[Channel]string),
+		sources: make(map[mirrorKey]mirrorKey),
+	}
+	for i := 0; i <= maxMirrors; i++ {
+		m.Record(source, fmt.Sprint(i), dest, fmt.Sprint("d", i))
+	}
+
+	tests := []struct {
+		ts      string
+		wantTs  string
+		present bool
+	}{
+		{"0", "", false},
+		{"1", "d1", true},
+		{fmt.Sprint(maxMirrors), fmt.Sprint("d", maxMirrors), true},
+	}
+	for _, test := range tests {
+		ts, present := m.Lookup(source, test.ts, dest)
+		if ts != test.wantTs || present != test.present {
+			t.Errorf("Lookup(%v) = %q, %v; want %q, %v", test.ts, ts, present, test.wantTs, test.present)
+		}
+		channel, sourceTs, present := m.Source(dest, "d"+test.ts)
+		if present != test.present || (present && (channel != source || sourceTs != test.ts)) {
+			t.Errorf("Source(d%v) = %v, %q, %v", test.ts, channel, sourceTs, present)
+		}
+	}
+}
+
+func TestThreadStarters(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   string
+		root      string
+		wantPosts int
+	}{
+		{"qualifying thread", `{"thread_starters": ["U0000000S"]}`, "U0000000S", 2},
+		{"other thread", `{"thread_starters": ["U0000000S"]}`, "U0000000A", 0},
+		{"no starters", `{}`, "U0000000A", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			useConfig(t, testConfig(test.options))
+			source := Channel{teamA, chanA}
+
+			Bridge(slackMessage{Channel: source, UserId: test.root, Username: "root", Text: "question", Timestamp: "1.000"})
+			Bridge(slackMessage{Channel: source, UserId: "U0000000B", Username: "bob", Text: "answer", Timestamp: "2.000", ThreadTimestamp: "1.000"})
+
+			if posts := len(slack.Posts()); posts != test.wantPosts {
+				t.Errorf("Got %d posts, want %d", posts, test.wantPosts)
+			}
+			if dropped := stats.Snapshot(false).Dropped[dropThreadFilter]; dropped != int64(2-test.wantPosts) {
+				t.Errorf("Counted %d %v drops, want %d", dropped, dropThreadFilter, 2-test.wantPosts)
+			}
+		})
+	}
+}
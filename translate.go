@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Translator translates forwarded text into a destination's language.
+type Translator interface {
+	Translate(ctx context.Context, text string, language string) (string, error)
+}
+
+// passThrough is the default translator, which leaves text unchanged.
+type passThrough struct{}
+
+func (passThrough) Translate(ctx context.Context, text string, language string) (string, error) {
+	return text, nil
+}
+
+// httpTranslator translates through a LibreTranslate-style HTTP API,
+// posting {"q", "source": "auto", "target", "api_key"} and reading
+// {"translatedText"}.
+type httpTranslator struct {
+	URL    string
+	APIKey string
+}
+
+func (t *httpTranslator) Translate(ctx context.Context, text string, language string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  language,
+		"format":  "text",
+		"api_key": t.APIKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", t.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if err := acquireOutbound(ctx); err != nil {
+		return "", err
+	}
+	defer releaseOutbound()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("Translation failed: %v", res.Status)
+	}
+
+	var response struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	return response.TranslatedText, nil
+}
+
+var translator Translator = passThrough{}
+
+// translations caches translated text by language and a hash of the
+// source text.
+var translations = newCache(10000, 24*time.Hour)
+
+// Translate translates the message's text into the channel's configured
+// language, returning it unchanged when none is set or translation fails.
+// Previews only use cached translations, leaving the text untranslated
+// rather than calling the translator.
+func (c Channel) Translate(ctx context.Context, msg slackMessage) string {
+	text := msg.Text
+	language := c.Options().Language
+	if language == "" || text == "" {
+		return text
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	key := language + "/" + hex.EncodeToString(sum[:])
+	if translated, present := translations.Get(key); present {
+		return translated.(string)
+	}
+	if msg.Preview {
+		return text
+	}
+
+	translated, err := translator.Translate(ctx, text, language)
+	if err != nil {
+		log.Printf("Unable to translate message for %v, posting the original: %v", c, err)
+		return text
+	}
+	translations.Set(key, translated)
+	return translated
+}
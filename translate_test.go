@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTranslator "translates" text by upper-casing it, or fails with err.
+type fakeTranslator struct {
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (f *fakeTranslator) Translate(ctx context.Context, text string, language string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	return strings.ToUpper(text), nil
+}
+
+// useTranslator replaces the translator for the rest of the test.
+func useTranslator(t testing.TB, tr Translator) {
+	previous := translator
+	translator = tr
+	t.Cleanup(func() { translator = previous })
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name      string
+		language  string
+		text      string
+		err       error
+		preview   bool
+		want      string
+		wantCalls int
+	}{
+		{"translated", "de", "hello", nil, false, "HELLO", 1},
+		{"no language", "", "hello", nil, false, "hello", 0},
+		{"empty text", "de", "", nil, false, "", 0},
+		{"failed", "de", "hello", errors.New("unavailable"), false, "hello", 2},
+		{"preview", "de", "hello", nil, true, "hello", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"language": "`+test.language+`"}}`))
+			fake := &fakeTranslator{err: test.err}
+			useTranslator(t, fake)
+
+			// Translations are cached; failures aren't.
+			for i := 0; i < 2; i++ {
+				msg := slackMessage{Text: test.text, Preview: test.preview}
+				if got := (Channel{teamB, chanB}).Translate(context.Background(), msg); got != test.want {
+					t.Errorf("Translate(%q) = %q, want %q", test.text, got, test.want)
+				}
+			}
+			if fake.calls != test.wantCalls {
+				t.Errorf("Translator called %d times, want %d", fake.calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHTTPTranslator(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		want    string
+		wantErr bool
+	}{
+		{"translated", 200, "hallo", false},
+		{"failed", 500, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&request)
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, `{"translatedText":"hallo"}`)
+			}))
+			defer server.Close()
+
+			tr := &httpTranslator{URL: server.URL, APIKey: "key"}
+			got, err := tr.Translate(context.Background(), "hello", "de")
+			if got != test.want || (err != nil) != test.wantErr {
+				t.Errorf("Translate = %q, %v; want %q, error %v", got, err, test.want, test.wantErr)
+			}
+			if request["q"] != "hello" || request["target"] != "de" || request["api_key"] != "key" {
+				t.Errorf("Sent %v", request)
+			}
+		})
+	}
+}
+
+func TestPostTranslated(t *testing.T) {
+	slack := newFakeSlack(t)
+	useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": {"language": "de"}}`))
+	useTranslator(t, &fakeTranslator{err: errors.New("unavailable")})
+
+	if err := (Channel{teamB, chanB}).PostMessage(context.Background(), slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if posts := slack.Posts(); len(posts) != 1 || posts[0].Get("text") != "hello" {
+		t.Errorf("Posted %v, want the original text", posts)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode"
+)
+
+const defaultTruncateMarker = "… [truncated]"
+
+// Truncate shortens text longer than the group's MaxLength to the last
+// word boundary that fits, followed by the truncation marker and, for
+// groups with TruncatePermalink, a link to the full message.
+func (msg *slackMessage) Truncate(ctx context.Context) {
+	options := msg.Group().Options
+	text := []rune(msg.Text)
+	if options.MaxLength <= 0 || len(text) <= options.MaxLength {
+		return
+	}
+
+	marker := options.TruncateMarker
+	if marker == "" {
+		marker = defaultTruncateMarker
+	}
+	if options.TruncatePermalink && !msg.Preview && msg.Timestamp != "" {
+		link := msg.Permalink
+		if link == "" {
+			var err error
+			if link, err = msg.GetTeam().Permalink(ctx, msg.ChannelId, msg.Timestamp); err != nil {
+				log.Printf("Unable to fetch permalink for %v: %v", msg.Timestamp, err)
+			}
+		}
+		if link != "" {
+			marker += " <" + link + "|Read more>"
+		}
+	}
+
+	limit := options.MaxLength - len([]rune(marker)) - 1
+	if limit < 0 {
+		limit = 0
+	}
+	cut := limit
+	for cut > 0 && !unicode.IsSpace(text[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		// A single word longer than the limit is cut mid-word.
+		cut = limit
+	}
+	msg.Text = strings.TrimRightFunc(string(text[:cut]), unicode.IsSpace) + " " + marker
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	long := "the quick brown fox jumps over the lazy dog"
+	tests := []struct {
+		name    string
+		options string
+		text    string
+		want    string
+	}{
+		{"short", `{"max_length": 50}`, long, long},
+		{"no limit", `{}`, long, long},
+		{"default marker", `{"max_length": 20}`, long, "the … [truncated]"},
+		{"custom marker", `{"max_length": 20, "truncate_marker": "…"}`, long, "the quick brown …"},
+		{"long word", `{"max_length": 10, "truncate_marker": "…"}`, "abcdefghijklmnopqrstuvwxyz", "abcdefgh …"},
+		{"permalink", `{"max_length": 46, "truncate_marker": "…", "truncate_permalink": true}`, long + " again and again",
+			"the quick … <https://a.slack.com/p1|Read more>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("chat.getPermalink", func(fakeCall) string { return `{"ok":true,"permalink":"https://a.slack.com/p1"}` })
+			useConfig(t, testConfig(test.options))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: test.text, Timestamp: "1.000"}
+			msg.Truncate(context.Background())
+			if msg.Text != test.want {
+				t.Errorf("Truncate(%q) = %q, want %q", test.text, msg.Text, test.want)
+			}
+			if n := len([]rune(msg.Text)); test.want != test.text && n > config().channelMap[Channel{teamA, chanA}].Options.MaxLength {
+				t.Errorf("Truncated text is %d characters, over the limit", n)
+			}
+		})
+	}
+}
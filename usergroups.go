@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// usergroupRegexp matches user group mentions, <!subteam^ID> or
+// <!subteam^ID|@handle>.
+var usergroupRegexp = regexp.MustCompile(`<!subteam\^([A-Z0-9]+)(?:\|@?([^>]*))?>`)
+
+// usergroupHandles caches each team's user group IDs and handles.
+var usergroupHandles = newCache(1000, time.Hour)
+
+// UsergroupHandles lists the team's user groups with usergroups.list,
+// returning their handles by ID.
+func (t *Team) UsergroupHandles(ctx context.Context) (map[string]string, error) {
+	if handles, present := usergroupHandles.Get(t.Id); present {
+		return handles.(map[string]string), nil
+	}
+
+	var response struct {
+		Usergroups []struct {
+			Id     string `json:"id"`
+			Handle string `json:"handle"`
+		} `json:"usergroups"`
+	}
+	if err := t.apiCall(ctx, "usergroups.list", url.Values{}, &response); err != nil {
+		return nil, err
+	}
+
+	handles := make(map[string]string, len(response.Usergroups))
+	for _, group := range response.Usergroups {
+		handles[group.Id] = group.Handle
+	}
+	usergroupHandles.Set(t.Id, handles)
+	return handles, nil
+}
+
+// RenderUsergroups rewrites the user group mentions in msg for the
+// channel. Group IDs differ between teams, so mentions are mapped through
+// the destination's usergroups table or rendered as plain text, as they
+// always are when the group suppresses mentions.
+func (c Channel) RenderUsergroups(ctx context.Context, msg slackMessage) string {
+	if c.TeamId == msg.TeamId {
+		return msg.Text
+	}
+	aliases := c.Options().Usergroups
+	if msg.mentionsSuppressed() {
+		aliases = nil
+	}
+
+	return usergroupRegexp.ReplaceAllStringFunc(msg.Text, func(s string) string {
+		match := usergroupRegexp.FindStringSubmatch(s)
+		id, handle := match[1], match[2]
+		if handle == "" && !msg.Preview {
+			handles, err := msg.GetTeam().UsergroupHandles(ctx)
+			if err != nil {
+				log.Printf("Unable to map user group %v to a handle: %v", id, err)
+			}
+			handle = handles[id]
+		}
+		if handle == "" {
+			return "@" + id
+		}
+		if alias, present := aliases[handle]; present {
+			return "<!subteam^" + alias + ">"
+		}
+		return "@" + handle
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderUsergroups(t *testing.T) {
+	list := `{"ok":true,"usergroups":[{"id":"S0000000A","handle":"oncall"}]}`
+	tests := []struct {
+		name      string
+		options   string
+		aliases   bool
+		dest      Channel
+		list      string
+		text      string
+		want      string
+		wantCalls int
+	}{
+		{"piped", "", false, Channel{teamB, chanB}, list, "ping <!subteam^S0000000A|@oncall>", "ping @oncall", 0},
+		{"resolved", "", false, Channel{teamB, chanB}, list, "ping <!subteam^S0000000A>", "ping @oncall", 1},
+		{"unresolved", "", false, Channel{teamB, chanB}, `{"ok":true,"usergroups":[]}`, "ping <!subteam^S0000000Z>", "ping @S0000000Z", 1},
+		{"lookup failed", "", false, Channel{teamB, chanB}, `{"ok":false,"error":"missing_scope"}`, "ping <!subteam^S0000000A>", "ping @S0000000A", 1},
+		{"aliased", "", true, Channel{teamB, chanB}, list, "ping <!subteam^S0000000A|@oncall>", "ping <!subteam^S0000000B>", 0},
+		{"suppressed", `{"suppress_mentions": true}`, true, Channel{teamB, chanB}, list, "ping <!subteam^S0000000A|@oncall>", "ping @oncall", 0},
+		{"same team", "", false, Channel{teamA, chanC}, list, "ping <!subteam^S0000000A>", "ping <!subteam^S0000000A>", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			slack.Handle("usergroups.list", func(fakeCall) string { return test.list })
+			var destinations []string
+			if test.aliases {
+				destinations = append(destinations, `"destinations": {"`+teamB+"/"+chanB+`": {"usergroups": {"oncall": "S0000000B"}}}`)
+			}
+			useConfig(t, testConfig(test.options, destinations...))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Text: test.text}
+			if got := test.dest.RenderUsergroups(testContext(t), msg); got != test.want {
+				t.Errorf("RenderUsergroups(%q) = %q, want %q", test.text, got, test.want)
+			}
+			if calls := len(slack.Calls("usergroups.list")); calls != test.wantCalls {
+				t.Errorf("Made %d usergroups.list calls, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxUsernameLength is the longest username Slack displays on a post.
+const maxUsernameLength = 80
+
+// DecorateUsername appends the group's UsernameDecoration to the author's
+// name, trimming the name so the result fits Slack's username limit.
+func (msg *slackMessage) DecorateUsername() {
+	decoration := msg.Group().Options.UsernameDecoration
+	if decoration == "" || msg.Username == "" {
+		return
+	}
+	name, suffix := []rune(msg.Username), []rune(decoration)
+	if len(suffix) >= maxUsernameLength {
+		suffix = suffix[:maxUsernameLength-1]
+	}
+	if keep := maxUsernameLength - len(suffix); len(name) > keep {
+		name = name[:keep]
+	}
+	msg.Username = string(name) + string(suffix)
+}
+
+// SanitizeUsername makes name safe to post to the destination: control
+// characters, such as newlines, and the destination's disallowed username
+// characters are removed, runs of spaces collapsed and the result cut to
+// the destination's username length, Slack's 80 by default.
+func (c Channel) SanitizeUsername(name string) string {
+	options := c.Options()
+	max := options.MaxUsernameLength
+	if max <= 0 || max > maxUsernameLength {
+		max = maxUsernameLength
+	}
+
+	var runes []rune
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r), strings.ContainsRune(options.DisallowedUsernameChars, r):
+		case unicode.IsSpace(r):
+			space = len(runes) > 0
+		default:
+			if space {
+				runes = append(runes, ' ')
+				space = false
+			}
+			runes = append(runes, r)
+		}
+	}
+	if len(runes) > max {
+		runes = []rune(strings.TrimRightFunc(string(runes[:max]), unicode.IsSpace))
+	}
+	return string(runes)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDecorateUsername(t *testing.T) {
+	long := strings.Repeat("a", 90)
+	tests := []struct {
+		name       string
+		decoration string
+		username   string
+		want       string
+	}{
+		{"appended", " 🔗", "alice", "alice 🔗"},
+		{"no decoration", "", "alice", "alice"},
+		{"no username", " 🔗", "", ""},
+		{"trimmed to fit", " 🔗", long, strings.Repeat("a", 78) + " 🔗"},
+		{"exactly at the limit", "!", strings.Repeat("a", 79), strings.Repeat("a", 79) + "!"},
+		{"over-long decoration", strings.Repeat("🔗", 100), "alice", "a" + strings.Repeat("🔗", 79)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(string(mustMarshal(t, map[string]string{"username_decoration": test.decoration}))))
+
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: test.username}
+			msg.DecorateUsername()
+			if msg.Username != test.want {
+				t.Errorf("DecorateUsername() = %q, want %q", msg.Username, test.want)
+			}
+			if length := utf8.RuneCountInString(msg.Username); length > maxUsernameLength {
+				t.Errorf("Decorated username is %d characters", length)
+			}
+		})
+	}
+}
+
+func TestSanitizeUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  string
+		username string
+		want     string
+	}{
+		{"normal", `{}`, "Alice Smith", "Alice Smith"},
+		{"over-length", `{}`, strings.Repeat("a", 100), strings.Repeat("a", 80)},
+		{"destination limit", `{"max_username_length": 5}`, "Alice Smith", "Alice"},
+		{"limit above Slack's", `{"max_username_length": 200}`, strings.Repeat("a", 100), strings.Repeat("a", 80)},
+		{"no trailing space after a cut", `{"max_username_length": 6}`, "Alice Smith", "Alice"},
+		{"control characters", `{}`, "Alice\x00\tSmith\n", "AliceSmith"},
+		{"spaces collapsed", `{}`, "  Alice    Smith  ", "Alice Smith"},
+		{"disallowed characters", `{"disallowed_username_chars": "@#"}`, "@alice#1", "alice1"},
+		{"multibyte", `{"max_username_length": 3}`, "ÄÖÜß", "ÄÖÜ"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig("", `"destinations": {"`+teamB+"/"+chanB+`": `+test.options+`}`))
+			if got := (Channel{teamB, chanB}).SanitizeUsername(test.username); got != test.want {
+				t.Errorf("SanitizeUsername(%q) = %q, want %q", test.username, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// userInfos caches the users looked up by each team, by ID or name.
+var userInfos = newCache(10000, time.Hour)
+
+// warmupTimeout bounds the whole warmup.
+const warmupTimeout = 5 * time.Minute
+
+// Members lists up to limit members of channel with
+// conversations.members.
+func (t *Team) Members(ctx context.Context, channel string, limit int) ([]string, error) {
+	var response struct {
+		Members []string `json:"members"`
+	}
+	values := url.Values{"channel": {channel}, "limit": {strconv.Itoa(limit)}}
+	if err := t.apiCall(ctx, "conversations.members", values, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Members) > limit {
+		response.Members = response.Members[:limit]
+	}
+	return response.Members, nil
+}
+
+// forEach runs f for each item, at most concurrency at once, and waits
+// for them all.
+func forEach(items []Channel, concurrency int, f func(Channel)) {
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(item Channel) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			f(item)
+		}(item)
+	}
+	wg.Wait()
+}
+
+// channelIconWanted reports whether another channel in c's group posts
+// its messages under c's channel icon.
+func (c Channel) channelIconWanted() bool {
+	group := c.Group()
+	if group == nil {
+		return false
+	}
+	for _, dest := range group.Channels {
+		if dest != c && dest.Options().ChannelIcon {
+			return true
+		}
+	}
+	return false
+}
+
+// Warmup checks whether each mapped channel is archived, and shared when
+// several teams are bridged, fetches the channel icons destinations use
+// and fills the user cache, which holds names and icons, for up to
+// WarmupMembers members of each channel. It makes at most
+// WarmupConcurrency lookups at once, so the first messages after startup
+// don't wait on them. Lookups that fail are left to be made on demand.
+func Warmup() {
+	settings := config().settings
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+
+	var channels []Channel
+	for channel := range config().channelMap {
+		if !channel.IsUser() && channel.GetTeam() != nil {
+			channels = append(channels, channel)
+		}
+	}
+	shared := len(config().teams) > 1
+
+	var lock sync.Mutex
+	seen := make(map[Channel]bool)
+	var users []Channel
+	forEach(channels, settings.WarmupConcurrency, func(c Channel) {
+		team := c.GetTeam()
+		c.Archived(ctx)
+		if shared {
+			c.isShared()
+		}
+		if c.channelIconWanted() {
+			if _, err := team.ChannelEmoji(ctx, c.ChannelId); err != nil {
+				log.Printf("Unable to fetch channel icon for %v: %v", c, err)
+			}
+		}
+		members, err := team.Members(ctx, c.ChannelId, settings.WarmupMembers)
+		if err != nil {
+			log.Printf("Unable to list the members of %v: %v", c, err)
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, member := range members {
+			user := Channel{c.TeamId, member}
+			if !seen[user] {
+				seen[user] = true
+				users = append(users, user)
+			}
+		}
+	})
+
+	forEach(users, settings.WarmupConcurrency, func(user Channel) {
+		if ctx.Err() == nil {
+			user.GetTeam().GetUserInfo(user.ChannelId)
+		}
+	})
+	log.Printf("Warmed up %v channels and %v users", len(channels), len(users))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// handleMembers answers conversations.members with n members of each
+// channel, named after it: UA0, UA1 and so on for C0000000A.
+func handleMembers(slack *fakeSlack, n int) {
+	slack.Handle("conversations.members", func(call fakeCall) string {
+		suffix := strings.TrimPrefix(call.Get("channel"), "C0000000")
+		members := make([]string, n)
+		for i := range members {
+			members[i] = fmt.Sprintf(`"U%s%d"`, suffix, i)
+		}
+		return `{"ok":true,"members":[` + strings.Join(members, ",") + `]}`
+	})
+}
+
+func TestWarmup(t *testing.T) {
+	tests := []struct {
+		name         string
+		settings     string
+		destination  string
+		wantUsers    int
+		wantArchived bool
+		wantIcon     bool
+	}{
+		{"defaults", `{}`, `{}`, 6, true, false},
+		{"channel icons", `{}`, `{"channel_icon": true}`, 6, true, true},
+		{"archive checks off", `{"archive_check_interval": "0s"}`, `{}`, 6, false, false},
+		{"member limit", `{"warmup_members": 2}`, `{}`, 4, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slack := newFakeSlack(t)
+			handleMembers(slack, 3)
+			slack.Handle("conversations.info", func(fakeCall) string {
+				return `{"ok":true,"channel":{"topic":{"value":":rocket: releases"}}}`
+			})
+			useConfig(t, testConfig("", `"settings": `+test.settings, `"destinations": {"`+teamB+"/"+chanB+`": `+test.destination+`}`))
+
+			Warmup()
+
+			if calls := len(slack.Calls("users.info")); calls != test.wantUsers {
+				t.Errorf("Looked up %d users, want %d", calls, test.wantUsers)
+			}
+			if _, present := userInfos.Get(teamA + "/UA0"); !present {
+				t.Errorf("Warmup didn't cache the members of %v", chanA)
+			}
+			for _, c := range []Channel{{teamA, chanA}, {teamB, chanB}} {
+				if _, present := archivedChannels.Get(c.String()); present != test.wantArchived {
+					t.Errorf("Archived state of %v cached %v, want %v", c, present, test.wantArchived)
+				}
+				if _, present := sharedChannels.Get(c.String()); !present {
+					t.Errorf("Shared state of %v not cached", c)
+				}
+			}
+			// Only the source of the channel icons is looked up.
+			if _, present := channelIcons.Get(teamA + "/" + chanA); present != test.wantIcon {
+				t.Errorf("Channel icon of %v cached %v, want %v", chanA, present, test.wantIcon)
+			}
+			if _, present := channelIcons.Get(teamB + "/" + chanB); present {
+				t.Errorf("Channel icon of %v cached, though no destination uses it", chanB)
+			}
+			if _, present := channelNames.Get(teamA + "/" + chanA); present {
+				t.Errorf("Warmup looked up the name of a mapped channel")
+			}
+		})
+	}
+}
+
+func TestWarmupConcurrency(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		members     int
+	}{
+		{1, 4},
+		{2, 6},
+		{4, 8},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.concurrency), func(t *testing.T) {
+			slack := newFakeSlack(t)
+			handleMembers(slack, test.members)
+			var mu sync.Mutex
+			inFlight, peak := 0, 0
+			slack.Handle("users.info", func(call fakeCall) string {
+				mu.Lock()
+				inFlight++
+				if inFlight > peak {
+					peak = inFlight
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+				return `{"ok":true,"user":{"id":"` + call.Get("user") + `","name":"someone"}}`
+			})
+			useConfig(t, testConfig("", fmt.Sprintf(`"settings": {"warmup_concurrency": %d}`, test.concurrency)))
+
+			Warmup()
+
+			if calls := len(slack.Calls("users.info")); calls != 2*test.members {
+				t.Errorf("Looked up %d users, want %d", calls, 2*test.members)
+			}
+			if peak != test.concurrency {
+				t.Errorf("Made up to %d lookups at once, want %d", peak, test.concurrency)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// WebhookOptions configures a generic, non-Slack webhook that a group's
+// messages are also sent to.
+type WebhookOptions struct {
+	URL string `json:"url"`
+	// Method is POST by default; PUT and PATCH are also accepted.
+	Method string `json:"method"`
+	// Authorization is sent as the Authorization header, for example
+	// "Bearer TOKEN". AuthorizationFile instead reads it from a file, such
+	// as a mounted secret, on every request so it can be rotated.
+	Authorization     string `json:"authorization"`
+	AuthorizationFile string `json:"authorization_file"`
+	// Username and Password send HTTP basic auth instead.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Format converts the text for the receiver: "slack" (the default)
+	// sends it unchanged, "markdown" as standard Markdown and "plain"
+	// without formatting.
+	Format string `json:"format"`
+	// ExpandEmoji replaces standard emoji shortcodes, such as :smile:, with
+	// their unicode characters. Custom emoji are left as shortcodes.
+	ExpandEmoji bool `json:"expand_emoji"`
+}
+
+func (w WebhookOptions) validate() error {
+	if w.URL == "" {
+		return fmt.Errorf("Webhook without a url")
+	}
+	switch w.Method {
+	case "", "POST", "PUT", "PATCH":
+	default:
+		return fmt.Errorf("Invalid method %q for webhook %v", w.Method, w.URL)
+	}
+	switch w.Format {
+	case "", formatSlack, formatMarkdown, formatPlain:
+	default:
+		return fmt.Errorf("Invalid format %q for webhook %v", w.Format, w.URL)
+	}
+	return nil
+}
+
+type webhookPayload struct {
+	Team      string `json:"team"`
+	Channel   string `json:"channel"`
+	User      string `json:"user"`
+	Text      string `json:"text"`
+	Timestamp string `json:"ts,omitempty"`
+	ThreadTs  string `json:"thread_ts,omitempty"`
+	Permalink string `json:"permalink,omitempty"`
+}
+
+// Post sends msg to the webhook as JSON.
+func (w WebhookOptions) Post(ctx context.Context, msg slackMessage) error {
+	text := formatText(msg.Text, w.Format)
+	if w.ExpandEmoji {
+		text = expandEmoji(text)
+	}
+	body, err := json.Marshal(webhookPayload{
+		Team:      msg.TeamId,
+		Channel:   msg.ChannelId,
+		User:      msg.Username,
+		Text:      text,
+		Timestamp: msg.Timestamp,
+		ThreadTs:  msg.ThreadTimestamp,
+		Permalink: msg.Permalink,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Posting message to webhook %v", w.URL)
+	return w.send(ctx, body)
+}
+
+// send posts the JSON body to the webhook with its method and
+// credentials.
+func (w WebhookOptions) send(ctx context.Context, body []byte) error {
+	method := w.Method
+	if method == "" {
+		method = "POST"
+	}
+	req, err := http.NewRequest(method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if id := config().settings.InstanceId; id != "" {
+		req.Header.Set(instanceHeader, id)
+	}
+
+	switch {
+	case w.AuthorizationFile != "":
+		content, err := ioutil.ReadFile(w.AuthorizationFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", strings.TrimSpace(string(content)))
+	case w.Authorization != "":
+		req.Header.Set("Authorization", w.Authorization)
+	case w.Username != "":
+		req.SetBasicAuth(w.Username, w.Password)
+	}
+
+	if err := acquireOutbound(ctx); err != nil {
+		return err
+	}
+	defer releaseOutbound()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("Webhook %v: %v", w.URL, res.Status)
+	}
+	return nil
+}
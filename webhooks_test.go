@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebhookPost(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "authorization")
+	if err := ioutil.WriteFile(secret, []byte("Bearer from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		options    WebhookOptions
+		status     int
+		wantMethod string
+		wantAuth   string
+		wantErr    bool
+	}{
+		{"defaults", WebhookOptions{}, 200, "POST", "", false},
+		{"put with bearer", WebhookOptions{Method: "PUT", Authorization: "Bearer secret"}, 200, "PUT", "Bearer secret", false},
+		{"secret file", WebhookOptions{Method: "PATCH", AuthorizationFile: secret}, 204, "PATCH", "Bearer from-file", false},
+		{"basic auth", WebhookOptions{Username: "bridge", Password: "pw"}, 200, "POST",
+			"Basic " + base64.StdEncoding.EncodeToString([]byte("bridge:pw")), false},
+		{"missing secret file", WebhookOptions{AuthorizationFile: secret + ".missing"}, 200, "", "", true},
+		{"refused", WebhookOptions{}, 401, "POST", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, testConfig(""))
+			var method, auth string
+			var payload webhookPayload
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, auth = r.Method, r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&payload)
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			hook := test.options
+			hook.URL = server.URL
+			msg := slackMessage{Channel: Channel{teamA, chanA}, Username: "alice", Text: "hello", Timestamp: "1.000"}
+			err := hook.Post(testContext(t), msg)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Post = %v, want error %v", err, test.wantErr)
+			}
+			if method != test.wantMethod || auth != test.wantAuth {
+				t.Errorf("Sent %q with Authorization %q, want %q with %q", method, auth, test.wantMethod, test.wantAuth)
+			}
+			if method != "" && (payload.Text != "hello" || payload.User != "alice" || payload.Channel != chanA) {
+				t.Errorf("Sent payload %+v", payload)
+			}
+		})
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		options WebhookOptions
+		wantErr bool
+	}{
+		{WebhookOptions{URL: "https://example.com"}, false},
+		{WebhookOptions{URL: "https://example.com", Method: "PUT", Format: formatMarkdown}, false},
+		{WebhookOptions{}, true},
+		{WebhookOptions{URL: "https://example.com", Method: "GET"}, true},
+		{WebhookOptions{URL: "https://example.com", Format: "html"}, true},
+	}
+	for _, test := range tests {
+		if err := test.options.validate(); (err != nil) != test.wantErr {
+			t.Errorf("validate(%+v) = %v, want error %v", test.options, err, test.wantErr)
+		}
+	}
+}